@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mikemackintosh/wonka/src/cloudinit"
+)
+
+// runCloudInit applies the users and groups of cloud-config user-data to
+// the root, so images can be prepared offline.
+func runCloudInit(args []string) int {
+	fs, root := newFlagSet("cloud-init")
+	dryRun := fs.Bool("dry-run", false, "only print what would change")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wonka cloud-init [flags] user-data")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	c, err := cloudinit.LoadFromFile(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	i, err := load(*root)
+	if err != nil {
+		return fail(err)
+	}
+
+	changes, err := i.ApplyCloudInit(c)
+	if err != nil {
+		return fail(err)
+	}
+
+	if !*dryRun && len(changes) > 0 {
+		if err := i.Save(); err != nil {
+			return fail(err)
+		}
+	}
+
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+
+	return 0
+}
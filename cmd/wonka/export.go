@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mikemackintosh/wonka/src/export"
+)
+
+// runExport writes a database, or the joined users view, as JSON, YAML or
+// CSV.
+func runExport(args []string) int {
+	fs, root := newFlagSet("export")
+	format := fs.String("format", export.FormatJSON, "output format: json, yaml or csv")
+	fields := fs.String("fields", "", "comma separated fields to export, all by default")
+	showHashes := fs.Bool("show-hashes", false, "export password hashes instead of redacting them")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wonka export [flags] passwd|shadow|group|users")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	i, err := load(*root)
+	if err != nil {
+		return fail(err)
+	}
+
+	table, err := i.Export(fs.Arg(0), export.Options{ShowHashes: *showHashes})
+	if err != nil {
+		return fail(err)
+	}
+
+	if len(*fields) > 0 {
+		if table, err = table.Select(strings.Split(*fields, ",")); err != nil {
+			return fail(err)
+		}
+	}
+
+	b, err := table.Marshal(*format)
+	if err != nil {
+		return fail(err)
+	}
+
+	os.Stdout.Write(b)
+	return 0
+}
@@ -0,0 +1,46 @@
+package main
+
+import "fmt"
+
+// Exit statuses of getent(1).
+const (
+	getentMissingArgs = 1
+	getentNotFound    = 2
+)
+
+// runGetent prints the entries of a database matching the keys, or every
+// entry, like getent(1) but below the root.
+func runGetent(args []string) int {
+	fs, root := newFlagSet("getent")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wonka getent [flags] passwd|shadow|group|gshadow [key ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return getentMissingArgs
+	}
+
+	i, err := load(*root)
+	if err != nil {
+		return fail(err)
+	}
+
+	lines, missing, err := i.Getent(fs.Arg(0), fs.Args()[1:])
+	if err != nil {
+		fail(err)
+		return getentMissingArgs
+	}
+
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+
+	if len(missing) > 0 {
+		return getentNotFound
+	}
+
+	return 0
+}
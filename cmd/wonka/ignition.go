@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mikemackintosh/wonka/src/ignition"
+)
+
+// runIgnition applies the passwd section of an Ignition config to the
+// root, so configs can be tested on a plain directory tree.
+func runIgnition(args []string) int {
+	fs, root := newFlagSet("ignition")
+	dryRun := fs.Bool("dry-run", false, "only print what would change")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wonka ignition [flags] config.ign")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	c, err := ignition.LoadFromFile(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	i, err := load(*root)
+	if err != nil {
+		return fail(err)
+	}
+
+	changes, err := i.ApplyIgnition(c)
+	if err != nil {
+		return fail(err)
+	}
+
+	if !*dryRun && len(changes) > 0 {
+		if err := i.Save(); err != nil {
+			return fail(err)
+		}
+	}
+
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+
+	return 0
+}
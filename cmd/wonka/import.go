@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mikemackintosh/wonka/src/importer"
+)
+
+// runImport creates the users listed in a CSV or JSON file. No user is
+// created unless every row is valid.
+func runImport(args []string) int {
+	fs, root := newFlagSet("import")
+	format := fs.String("format", "", "input format, csv or json, from the file extension by default")
+	mapping := fs.String("mapping", "", "file mapping columns to fields, columns named after the fields by default")
+	dryRun := fs.Bool("dry-run", false, "only check the rows and print what would change")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wonka import [flags] file")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	m := importer.DefaultMapping()
+	if len(*mapping) > 0 {
+		var err error
+		if m, err = importer.LoadFromFile(*mapping); err != nil {
+			return fail(err)
+		}
+
+		for _, err := range m.Errors {
+			fmt.Fprintf(os.Stderr, "wonka: %s: %s\n", *mapping, err)
+		}
+		if len(m.Errors) > 0 {
+			return 1
+		}
+	}
+
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	if len(*format) == 0 {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fs.Arg(0))), ".")
+	}
+
+	var records importer.Records
+	switch *format {
+	case "csv":
+		records, err = m.ReadCSV(data)
+	case "json":
+		records, err = m.ReadJSON(data)
+	default:
+		return fail(fmt.Errorf("unknown format %q, expected csv or json", *format))
+	}
+	// Rows which failed to read are still checked against the databases,
+	// so every problem is reported at once.
+	parsed, ok := err.(importer.Errors)
+	if err != nil && !ok {
+		return failRows(fs.Arg(0), err)
+	}
+
+	i, err := load(*root)
+	if err != nil {
+		return fail(err)
+	}
+
+	if errs := i.CheckImport(records, parsed); len(errs) > 0 {
+		return failRows(fs.Arg(0), errs)
+	}
+
+	changes, err := i.ImportUsers(records)
+	if err != nil {
+		return failRows(fs.Arg(0), err)
+	}
+
+	if !*dryRun && len(changes) > 0 {
+		if err := i.Save(); err != nil {
+			return fail(err)
+		}
+	}
+
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+
+	return 0
+}
+
+// failRows prints the errors of every invalid row, or any other error, and
+// returns the exit status for them.
+func failRows(file string, err error) int {
+	errs, ok := err.(importer.Errors)
+	if !ok {
+		return fail(fmt.Errorf("%s: %s", file, err))
+	}
+
+	// A row can have several errors, so count the rows.
+	rows := map[int]bool{}
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "wonka: %s: %s\n", file, e)
+		rows[e.Row] = true
+	}
+	fmt.Fprintf(os.Stderr, "wonka: %d invalid rows, nothing was imported\n", len(rows))
+
+	return 1
+}
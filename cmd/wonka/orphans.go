@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mikemackintosh/wonka/src/orphans"
+)
+
+// runOrphans reports, and optionally reassigns, files whose owner or group
+// has no account.
+func runOrphans(args []string) int {
+	fs, root := newFlagSet("orphans")
+	asJSON := fs.Bool("json", false, "print the orphans as JSON")
+	xdev := fs.Bool("xdev", false, "do not descend into other filesystems")
+	skip := fs.String("skip", strings.Join(orphans.DefaultSkip, ","), "comma separated paths to skip")
+	user := fs.String("reassign-user", "", "chown orphaned owners to this user name or UID")
+	group := fs.String("reassign-group", "", "chgrp orphaned groups to this group name or GID")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wonka orphans [flags] [path ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	i, err := load(*root)
+	if err != nil {
+		return fail(err)
+	}
+
+	uid, err := lookupID(*user, func(name string) (int, bool) {
+		if u := i.Passwd.GetUser(name); u != nil {
+			return u.UID, true
+		}
+		return -1, false
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	gid, err := lookupID(*group, func(name string) (int, bool) {
+		if g := i.Groups.GetGroup(name); g != nil {
+			return g.GID, true
+		}
+		return -1, false
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+
+	// Paths, including the skip list, are below the root like the account
+	// files are.
+	opts := orphans.Options{OneFileSystem: *xdev}
+	for _, s := range strings.Split(*skip, ",") {
+		if len(s) > 0 {
+			opts.Skip = append(opts.Skip, s)
+		}
+	}
+
+	found := []orphans.Orphan{}
+	for _, path := range paths {
+		o, unreadable, err := orphans.Find(*root, path, *i.Passwd, *i.Groups, opts)
+		if err != nil {
+			return fail(err)
+		}
+
+		for _, err := range unreadable {
+			fmt.Fprintf(os.Stderr, "wonka: warning: %s\n", err)
+		}
+		found = append(found, o...)
+	}
+
+	if uid >= 0 || gid >= 0 {
+		if err := orphans.Reassign(*root, found, uid, gid); err != nil {
+			return fail(err)
+		}
+	}
+
+	if *asJSON {
+		if err := printJSON(found); err != nil {
+			return fail(err)
+		}
+		return 0
+	}
+
+	for _, o := range found {
+		fmt.Printf("%s\t%d\t%d\n", o.Path, o.UID, o.GID)
+	}
+
+	return 0
+}
+
+// lookupID resolves a name or number with lookup. An empty value returns -1.
+func lookupID(value string, lookup func(string) (int, bool)) (int, error) {
+	if len(value) == 0 {
+		return -1, nil
+	}
+
+	if id, ok := lookup(value); ok {
+		return id, nil
+	}
+
+	if id, err := strconv.Atoi(value); err == nil && id >= 0 {
+		return id, nil
+	}
+
+	return -1, fmt.Errorf("%s does not exist", value)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+
+	wonka "github.com/mikemackintosh/wonka/src"
+	"github.com/mikemackintosh/wonka/src/spec"
+)
+
+// runPlan prints the changes applying a spec would make.
+func runPlan(args []string) int {
+	return planOrApply("plan", args, false)
+}
+
+// runApply applies a spec and saves the databases.
+func runApply(args []string) int {
+	return planOrApply("apply", args, true)
+}
+
+// planOrApply loads a spec, prints its plan and, when apply is set,
+// applies and saves it.
+func planOrApply(name string, args []string, apply bool) int {
+	fs, root := newFlagSet(name)
+	asJSON := fs.Bool("json", false, "print the plan as JSON")
+	prune := fs.Bool("prune", false, "remove managed users and groups no longer in the spec")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: wonka %s [flags] spec.json\n", name)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	s, err := spec.LoadFromFile(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	i, err := load(*root)
+	if err != nil {
+		return fail(err)
+	}
+
+	plan, err := i.PlanWithOptions(s, wonka.PlanOptions{Prune: *prune})
+	if err != nil {
+		return fail(err)
+	}
+
+	if apply && !plan.Empty() {
+		if err := applyPlan(i, plan); err != nil {
+			return fail(err)
+		}
+	}
+
+	if *asJSON {
+		if plan.Steps == nil {
+			plan.Steps = []wonka.Step{}
+		}
+
+		if err := printJSON(plan); err != nil {
+			return fail(err)
+		}
+		return 0
+	}
+
+	fmt.Print(plan.String())
+	return 0
+}
+
+// applyPlan applies a plan and saves the databases.
+func applyPlan(i *wonka.Instance, plan *wonka.Plan) error {
+	if err := i.Apply(plan); err != nil {
+		return err
+	}
+
+	return i.Save()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	wonka "github.com/mikemackintosh/wonka/src"
+	"github.com/mikemackintosh/wonka/src/reap"
+)
+
+// runReap reports, locks or deletes stale accounts.
+func runReap(args []string) int {
+	fs, root := newFlagSet("reap")
+	file := fs.String("policy", "", "policy file, "+reap.FILE_REAP+" below the root by default")
+	action := fs.String("action", "", "override the policy action: report, lock or delete")
+	dryRun := fs.Bool("dry-run", false, "only report what would be done")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	policy, err := loadReapPolicy(*root, *file)
+	if err != nil {
+		return fail(err)
+	}
+
+	if len(*action) > 0 {
+		if err := policy.Set("ACTION", *action); err != nil {
+			return fail(err)
+		}
+	}
+
+	i, err := load(*root)
+	if err != nil {
+		return fail(err)
+	}
+
+	now := time.Now()
+	stale, err := i.Stale(policy, now)
+	if !*dryRun && policy.Action != reap.ActionReport && err == nil {
+		stale, err = i.Reap(policy, now)
+		if err == nil {
+			err = i.Save()
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	// Accounts which could not be reaped are reported, while the others
+	// have been saved.
+	status := 0
+	for _, s := range stale {
+		if len(s.Error) > 0 {
+			fmt.Fprintf(os.Stderr, "wonka: %s %s: %s\n", s.Action, s.User, s.Error)
+			status = 1
+		}
+	}
+
+	if *asJSON {
+		if stale == nil {
+			stale = []wonka.Stale{}
+		}
+		if err := printJSON(stale); err != nil {
+			return fail(err)
+		}
+		return status
+	}
+
+	for _, s := range stale {
+		last := "never"
+		if !s.LastLogin.IsZero() {
+			last = s.LastLogin.Format("2006-01-02")
+		}
+
+		fmt.Printf("%s\t%d\t%s\t%s\t%s\n", s.User, s.UID, last, s.Action, strings.Join(s.Reasons, "; "))
+	}
+
+	return status
+}
+
+// loadReapPolicy reads the policy file. The default file is optional, in
+// which case the default policy is used.
+func loadReapPolicy(root, file string) (*reap.Policy, error) {
+	optional := len(file) == 0
+	if optional {
+		file = filepath.Join(root, reap.FILE_REAP)
+	}
+
+	policy, err := reap.LoadFromFile(file)
+	if optional && os.IsNotExist(err) {
+		return reap.Default(), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(policy.Errors) > 0 {
+		return nil, policy.Errors[0]
+	}
+
+	return policy, nil
+}
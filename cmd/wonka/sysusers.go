@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mikemackintosh/wonka/src/sysusers"
+)
+
+// runSysusers creates the accounts of sysusers.d files, like
+// systemd-sysusers --root.
+func runSysusers(args []string) int {
+	fs, root := newFlagSet("sysusers")
+	dryRun := fs.Bool("dry-run", false, "only print what would be created")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wonka sysusers [flags] [file ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	entries := &sysusers.Entries{}
+	if fs.NArg() == 0 {
+		var err error
+		if entries, err = sysusers.Load(*root); err != nil {
+			return fail(err)
+		}
+	}
+
+	for _, file := range fs.Args() {
+		e, err := sysusers.LoadFromFile(file)
+		if err != nil {
+			return fail(err)
+		}
+		*entries = append(*entries, *e...)
+	}
+
+	i, err := load(*root)
+	if err != nil {
+		return fail(err)
+	}
+
+	changes, err := i.ApplySysusers(*entries)
+	if err != nil {
+		return fail(err)
+	}
+
+	if !*dryRun && len(changes) > 0 {
+		if err := i.Save(); err != nil {
+			return fail(err)
+		}
+	}
+
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+
+	return 0
+}
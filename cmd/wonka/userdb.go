@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mikemackintosh/wonka/src/userdb"
+)
+
+// runUserdb exports the accounts as systemd userdb drop-ins, or imports
+// them from drop-ins.
+func runUserdb(args []string) int {
+	fs, root := newFlagSet("userdb")
+	dir := fs.String("dir", "", "drop-in directory, /etc/userdb below the root by default")
+	dryRun := fs.Bool("dry-run", false, "only print what an import would change")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wonka userdb [flags] export|import")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	i, err := load(*root)
+	if err != nil {
+		return fail(err)
+	}
+
+	if len(*dir) == 0 {
+		*dir = filepath.Join(*root, userdb.DIR_USERDB)
+	}
+
+	switch fs.Arg(0) {
+	case "export":
+		r, err := i.UserdbRecords()
+		if err != nil {
+			return fail(err)
+		}
+
+		if err := r.SaveDir(*dir); err != nil {
+			return fail(err)
+		}
+	case "import":
+		r, err := userdb.LoadDir(*dir)
+		if err != nil {
+			return fail(err)
+		}
+
+		changes, err := i.ImportUserdb(r)
+		if err != nil {
+			return fail(err)
+		}
+
+		if !*dryRun && len(changes) > 0 {
+			if err := i.Save(); err != nil {
+				return fail(err)
+			}
+		}
+
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	wonka "github.com/mikemackintosh/wonka/src"
+)
+
+// command is a wonka subcommand. run returns the exit status.
+type command struct {
+	usage string
+	run   func(args []string) int
+}
+
+var commands = map[string]command{
+	"apply":      {"apply a desired state spec", runApply},
+	"cloud-init": {"apply the users and groups of cloud-config user-data", runCloudInit},
+	"export":     {"write a database as JSON, YAML or CSV", runExport},
+	"getent":     {"look up entries of a database like getent", runGetent},
+	"ignition":   {"apply the passwd section of an Ignition config", runIgnition},
+	"import":     {"create the users listed in a CSV or JSON file", runImport},
+	"orphans":    {"find files owned by UIDs or GIDs with no account", runOrphans},
+	"plan":       {"show the changes a desired state spec would make", runPlan},
+	"reap":       {"list, lock or delete stale accounts", runReap},
+	"sysusers":   {"create the accounts of sysusers.d files", runSysusers},
+	"userdb":     {"export or import systemd userdb records", runUserdb},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "wonka: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	os.Exit(cmd.run(os.Args[2:]))
+}
+
+// usage prints the list of commands.
+func usage() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: wonka <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
+
+// newFlagSet returns the flags for a command, with -root already defined.
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("wonka "+name, flag.ExitOnError)
+	root := fs.String("root", "/", "directory the account files are read from")
+	return fs, root
+}
+
+// load reads the account databases below root.
+func load(root string) (*wonka.Instance, error) {
+	i := wonka.NewWithOptions(wonka.Options{Root: root})
+	if err := i.Load(); err != nil {
+		return nil, err
+	}
+
+	// Problems in login.defs fall back to defaults, so only warn.
+	for _, err := range i.Policy.Errors {
+		fmt.Fprintf(os.Stderr, "wonka: warning: login.defs: %s\n", err)
+	}
+
+	return &i, nil
+}
+
+// fail prints an error and returns the exit status for it.
+func fail(err error) int {
+	fmt.Fprintf(os.Stderr, "wonka: %s\n", err)
+	return 1
+}
+
+// printJSON writes v as indented JSON to stdout.
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
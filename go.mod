@@ -2,4 +2,7 @@ module github.com/mikemackintosh/wonka
 
 go 1.13
 
-require github.com/tredoe/osutil v1.0.4
+require (
+	github.com/tredoe/osutil v1.0.4
+	gopkg.in/yaml.v2 v2.4.0
+)
@@ -0,0 +1,155 @@
+package alloc
+
+import (
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/logindefs"
+	"github.com/mikemackintosh/wonka/src/passwd"
+)
+
+// Allocator hands out free IDs from the range Min..Max. Regular accounts
+// count up from the highest ID in use, system accounts count down from Max,
+// which is how shadow-utils picks IDs.
+type Allocator struct {
+	Min     int
+	Max     int
+	TopDown bool
+
+	used   map[int]bool
+	ranges [][2]int
+}
+
+// New returns an Allocator for the range min..max.
+func New(min, max int, topDown bool) *Allocator {
+	return &Allocator{
+		Min:     min,
+		Max:     max,
+		TopDown: topDown,
+		used:    map[int]bool{},
+	}
+}
+
+// UIDs returns an Allocator over the login.defs UID range, with every UID in
+// the passwd entries marked as used.
+func UIDs(policy *logindefs.Policy, system bool, users passwd.Entries) *Allocator {
+	a := New(policy.UIDMin, policy.UIDMax, system)
+	if system {
+		a.Min, a.Max = policy.SysUIDMin, policy.SysUIDMax
+	}
+
+	for _, user := range users {
+		a.Reserve(user.UID)
+	}
+
+	return a
+}
+
+// GIDs returns an Allocator over the login.defs GID range, with every GID in
+// the group entries marked as used.
+func GIDs(policy *logindefs.Policy, system bool, grps groups.Entries) *Allocator {
+	a := New(policy.GIDMin, policy.GIDMax, system)
+	if system {
+		a.Min, a.Max = policy.SysGIDMin, policy.SysGIDMax
+	}
+
+	for _, group := range grps {
+		a.Reserve(group.GID)
+	}
+
+	return a
+}
+
+// Reserve marks an ID as used.
+func (a *Allocator) Reserve(id int) {
+	a.used[id] = true
+}
+
+// ReserveRange marks count IDs starting at start as used, for example a
+// subordinate ID range.
+func (a *Allocator) ReserveRange(start, count int) {
+	if count > 0 {
+		a.ranges = append(a.ranges, [2]int{start, start + count - 1})
+	}
+}
+
+// IsFree returns true if the ID is not used or inside a reserved range.
+func (a *Allocator) IsFree(id int) bool {
+	if a.used[id] {
+		return false
+	}
+
+	for _, r := range a.ranges {
+		if id >= r[0] && id <= r[1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Next returns the next free ID and reserves it.
+func (a *Allocator) Next() (int, error) {
+	return a.NextFunc(nil)
+}
+
+// NextFunc returns the next free ID that also satisfies ok, and reserves it.
+// A nil ok accepts every free ID.
+func (a *Allocator) NextFunc(ok func(int) bool) (int, error) {
+	free := func(id int) bool {
+		return a.IsFree(id) && (ok == nil || ok(id))
+	}
+
+	id, found := a.search(free)
+	if !found {
+		return -1, &ErrExhausted{a.Min, a.Max}
+	}
+
+	a.Reserve(id)
+	return id, nil
+}
+
+// search walks the range in allocation order.
+func (a *Allocator) search(free func(int) bool) (int, bool) {
+	if a.TopDown {
+		for id := a.Max; id >= a.Min; id-- {
+			if free(id) {
+				return id, true
+			}
+		}
+
+		return -1, false
+	}
+
+	// Prefer one past the highest ID in use, then fall back to gaps.
+	highest := a.Min - 1
+	for id := range a.used {
+		if id >= a.Min && id <= a.Max && id > highest {
+			highest = id
+		}
+	}
+
+	for id := highest + 1; id <= a.Max; id++ {
+		if free(id) {
+			return id, true
+		}
+	}
+
+	for id := a.Min; id <= highest; id++ {
+		if free(id) {
+			return id, true
+		}
+	}
+
+	return -1, false
+}
+
+// NextPair returns an ID free in both allocators and reserves it in each,
+// so a user and its private group can share the same number.
+func NextPair(uids, gids *Allocator) (int, error) {
+	id, err := uids.NextFunc(gids.IsFree)
+	if err != nil {
+		return -1, err
+	}
+
+	gids.Reserve(id)
+	return id, nil
+}
@@ -0,0 +1,81 @@
+package alloc
+
+import (
+	"testing"
+
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/logindefs"
+	"github.com/mikemackintosh/wonka/src/passwd"
+)
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		Min     int
+		Max     int
+		TopDown bool
+		Used    []int
+		Want    int
+	}{
+		// Empty ranges start at the bottom.
+		{Min: 1000, Max: 1010, Used: nil, Want: 1000},
+		// One past the highest ID, even with gaps below it.
+		{Min: 1000, Max: 1010, Used: []int{1000, 1005}, Want: 1006},
+		// Fall back to gaps once the top is used.
+		{Min: 1000, Max: 1002, Used: []int{1000, 1002}, Want: 1001},
+		// System accounts count down.
+		{Min: 100, Max: 999, TopDown: true, Used: []int{999, 998}, Want: 997},
+		// IDs outside the range are ignored.
+		{Min: 1000, Max: 1010, Used: []int{0, 65534}, Want: 1000},
+	}
+
+	for testNum, test := range tests {
+		a := New(test.Min, test.Max, test.TopDown)
+		for _, id := range test.Used {
+			a.Reserve(id)
+		}
+
+		id, err := a.Next()
+		if err != nil {
+			t.Fatalf("%d) %s", testNum, err)
+		}
+
+		if id != test.Want {
+			t.Errorf("%d) expected %d, got %d", testNum, test.Want, id)
+		}
+	}
+}
+
+func TestExhausted(t *testing.T) {
+	a := New(1000, 1001, false)
+	a.ReserveRange(1000, 2)
+
+	if _, err := a.Next(); err == nil {
+		t.Fatal("expected range to be exhausted")
+	} else if _, ok := err.(*ErrExhausted); !ok {
+		t.Fatalf("unexpected error %T", err)
+	}
+}
+
+func TestNextPair(t *testing.T) {
+	policy := logindefs.Default()
+	users := passwd.Entries{{Username: "alice", UID: 1000, GID: 1000}}
+	grps := groups.Entries{{Name: "alice", GID: 1000}, {Name: "shared", GID: 1001}}
+
+	id, err := NextPair(UIDs(policy, false, users), GIDs(policy, false, grps))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != 1002 {
+		t.Errorf("expected 1002, got %d", id)
+	}
+
+	id, err = UIDs(policy, true, users).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != policy.SysUIDMax {
+		t.Errorf("expected %d, got %d", policy.SysUIDMax, id)
+	}
+}
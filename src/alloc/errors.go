@@ -0,0 +1,14 @@
+package alloc
+
+import "fmt"
+
+// ErrExhausted is used when a range has no free IDs left.
+type ErrExhausted struct {
+	Min int
+	Max int
+}
+
+// Error takes an error and returns a string. Satisfies the interface.
+func (e *ErrExhausted) Error() string {
+	return fmt.Sprintf("no free id between %d and %d", e.Min, e.Max)
+}
@@ -0,0 +1,100 @@
+package wonka
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/procs"
+	"github.com/mikemackintosh/wonka/src/utmp"
+)
+
+// defaultGrace is how long terminated processes get to exit before they
+// are killed.
+const defaultGrace = 5 * time.Second
+
+// checkBusy refuses to go on while name has running processes or utmp
+// sessions, unless force is set. With kill set the processes are
+// terminated by Save instead, waiting up to grace before killing them.
+// Kill is refused for root and for a UID another account shares, since
+// their processes are not only those of name.
+//
+// Like userdel and usermod with --prefix, nothing is checked when the
+// instance root is not "/", since the running processes belong to another
+// system.
+func (i *Instance) checkBusy(name string, uid int, force, kill bool, grace time.Duration) error {
+	if kill {
+		if uid == 0 {
+			return &ErrBusy{fmt.Sprintf("refusing to kill the processes of %s, which has uid 0", name)}
+		}
+
+		for _, entry := range *i.Passwd {
+			if entry.UID == uid && entry.Username != name {
+				return &ErrBusy{fmt.Sprintf("refusing to kill the processes of %s, whose uid %d is shared with %s", name, uid, entry.Username)}
+			}
+		}
+	}
+
+	if len(i.Options.procDir) == 0 || (force && !kill) {
+		return nil
+	}
+
+	running, err := procs.Find(i.Options.procDir, uid)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := i.sessions(name)
+	if err != nil {
+		return err
+	}
+
+	if len(running) == 0 && len(sessions) == 0 {
+		return nil
+	}
+
+	if kill {
+		if grace <= 0 {
+			grace = defaultGrace
+		}
+
+		// Killing cannot be undone, so it runs before Save writes anything,
+		// and a failure leaves the databases untouched. A later failure
+		// cannot bring the processes back.
+		dir := i.Options.procDir
+		i.before(func() error {
+			// Look again, since processes may have come and gone.
+			running, err := procs.Find(dir, uid)
+			if err != nil {
+				return err
+			}
+
+			return procs.Terminate(dir, running, grace)
+		})
+
+		return nil
+	}
+
+	if force {
+		return nil
+	}
+
+	if len(sessions) > 0 {
+		return &ErrBusy{fmt.Sprintf("user %s is logged in on %s", name, sessions[0].Line)}
+	}
+
+	return &ErrBusy{fmt.Sprintf("user %s is used by process %d (%s)", name, running[0].PID, running[0].Name)}
+}
+
+// sessions returns the utmp login sessions of name. A missing utmp file
+// means nobody is logged in.
+func (i *Instance) sessions(name string) (utmp.Entries, error) {
+	entries, err := utmp.LoadFromFile(i.path(i.Options.fileUtmp))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return entries.Sessions(name), nil
+}
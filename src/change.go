@@ -0,0 +1,17 @@
+package wonka
+
+import "fmt"
+
+// Change describes a single modification made to an account database or
+// file.
+type Change struct {
+	// Target is the database or path which was changed.
+	Target string
+	// Detail describes the change.
+	Detail string
+}
+
+// String returns the change as a single line.
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s", c.Target, c.Detail)
+}
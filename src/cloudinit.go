@@ -0,0 +1,282 @@
+package wonka
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/mikemackintosh/wonka/src/cloudinit"
+	"github.com/mikemackintosh/wonka/src/home"
+	"github.com/mikemackintosh/wonka/src/shadow"
+	"github.com/mikemackintosh/wonka/src/sshkeys"
+)
+
+// sudoersMode is the mode sudo requires of files in sudoers.d.
+const sudoersMode os.FileMode = 0440
+
+// ApplyCloudInit creates the groups and users of cloud-config user-data the
+// way cloud-init does on first boot. Groups are created with their members,
+// then users are created unless they exist, with any missing primary or
+// supplementary group. Existing and new users alike get the listed groups,
+// the password hash, the lock, the ssh keys and the sudo rules. The
+// "default" user is skipped. Nothing is written until Save is called.
+func (i *Instance) ApplyCloudInit(c *cloudinit.Config) ([]Change, error) {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return nil, errNotLoaded
+	}
+
+	var changes []Change
+	for _, g := range c.Groups {
+		created, err := i.cloudInitGroup(g.Name, false)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, created...)
+
+		for _, member := range g.Members {
+			// Like cloud-init, members which do not exist are skipped.
+			if i.Passwd.GetUser(member) == nil {
+				continue
+			}
+
+			if i.addMember(g.Name, member) {
+				changes = append(changes, Change{i.Options.fileGroups, fmt.Sprintf("added %s to group %s", member, g.Name)})
+			}
+		}
+	}
+
+	// Check every sudo rule before changing any user.
+	var rules []string
+	for _, u := range c.Users {
+		if u.Name == cloudinit.DefaultUser {
+			continue
+		}
+
+		userRules, err := u.SudoRules()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, userRules...)
+	}
+
+	for _, u := range c.Users {
+		if u.Name == cloudinit.DefaultUser {
+			continue
+		}
+
+		applied, err := i.cloudInitUser(u)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, applied...)
+	}
+
+	if len(rules) > 0 {
+		i.addSudoRules(rules)
+		changes = append(changes, Change{cloudinit.FILE_SUDOERS, fmt.Sprintf("added %d sudo rules", len(rules))})
+	}
+
+	return changes, nil
+}
+
+// cloudInitGroup creates a group unless it exists.
+func (i *Instance) cloudInitGroup(name string, system bool) ([]Change, error) {
+	if i.Groups.GetGroup(name) != nil {
+		return nil, nil
+	}
+
+	group, err := i.AddGroup(Group{Name: name, System: system})
+	if err != nil {
+		return nil, err
+	}
+
+	return []Change{{i.Options.fileGroups, fmt.Sprintf("created group %s with gid %d", name, group.GID)}}, nil
+}
+
+// cloudInitUser creates a user of the users list unless it exists, then
+// applies its groups, password, lock and ssh keys.
+func (i *Instance) cloudInitUser(u cloudinit.User) ([]Change, error) {
+	if err := ValidName(u.Name); err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	entry := i.Passwd.GetUser(u.Name)
+	if entry == nil {
+		if len(u.PrimaryGroup) > 0 {
+			created, err := i.cloudInitGroup(u.PrimaryGroup, u.System)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, created...)
+		}
+
+		createHome := !u.System && !u.NoCreateHome
+		created, err := i.AddUser(User{
+			Name:       u.Name,
+			UID:        u.UID,
+			Group:      u.PrimaryGroup,
+			Info:       u.Gecos,
+			HomeDir:    u.Homedir,
+			Shell:      u.Shell,
+			System:     u.System,
+			CreateHome: &createHome,
+		})
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, Change{i.Options.filePasswd, fmt.Sprintf("created user %s with uid %d", u.Name, created.UID)})
+		entry = i.Passwd.GetUser(u.Name)
+	}
+
+	for _, name := range u.Groups {
+		created, err := i.cloudInitGroup(name, false)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, created...)
+
+		if i.addMember(name, u.Name) {
+			changes = append(changes, Change{i.Options.fileGroups, fmt.Sprintf("added %s to group %s", u.Name, name)})
+		}
+	}
+
+	shd := i.Shadow.GetUserEntry(u.Name)
+	if shd == nil {
+		shd = shadow.NewEntry(u.Name, i.Policy)
+		i.Shadow.NewEntry(shd)
+	}
+
+	if len(u.Passwd) > 0 && strings.TrimPrefix(shd.Password, "!") != u.Passwd {
+		shd.Password = u.Passwd
+		shd.LastPasswordChange = shadow.Today()
+		changes = append(changes, Change{i.Options.fileShadow, fmt.Sprintf("set the password of %s", u.Name)})
+	}
+
+	if u.Locked() && !shd.IsLocked() {
+		shd.Lock()
+		changes = append(changes, Change{i.Options.fileShadow, fmt.Sprintf("locked the password of %s", u.Name)})
+	}
+
+	if len(u.SSHAuthorizedKeys) > 0 {
+		if len(entry.HomeDir) == 0 {
+			return nil, fmt.Errorf("user %s has ssh keys but no home directory", u.Name)
+		}
+
+		i.addAuthorizedKeys(*entry, u.SSHAuthorizedKeys)
+		changes = append(changes, Change{filepath.Join(entry.HomeDir, sshkeys.FILE_AUTHORIZED_KEYS), fmt.Sprintf("added %d ssh keys", len(u.SSHAuthorizedKeys))})
+	}
+
+	return changes, nil
+}
+
+// addSudoRules queues appending the missing rules to the cloud-init
+// sudoers file, putting the previous file back if a later change fails.
+func (i *Instance) addSudoRules(rules []string) {
+	var old []byte
+	var existed bool
+	i.after(func() error {
+		file, err := home.Resolve(i.Options.Root, cloudinit.FILE_SUDOERS)
+		if err != nil {
+			return err
+		}
+
+		old, err = ioutil.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		existed = err == nil
+
+		data := string(old)
+		for _, rule := range rules {
+			if !contains(strings.Split(data, "\n"), rule) {
+				if len(data) > 0 && !strings.HasSuffix(data, "\n") {
+					data += "\n"
+				}
+				data += rule + "\n"
+			}
+		}
+
+		if err := checkSudoers([]byte(data)); err != nil {
+			return err
+		}
+
+		return writeSudoers(file, []byte(data))
+	}, func() error {
+		file, err := home.Resolve(i.Options.Root, cloudinit.FILE_SUDOERS)
+		if err != nil {
+			return err
+		}
+
+		if existed {
+			return writeSudoers(file, old)
+		}
+
+		return os.Remove(file)
+	})
+}
+
+// checkSudoers runs visudo -c on a sudoers file before it is written, so
+// a bad rule cannot break sudo for the whole host. Without visudo, the
+// rules are trusted.
+func checkSudoers(data []byte) error {
+	visudo, err := exec.LookPath("visudo")
+	if err != nil {
+		return nil
+	}
+
+	f, err := ioutil.TempFile("", "sudoers")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Chmod(sudoersMode); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if out, err := exec.Command(visudo, "-c", "-f", f.Name()).CombinedOutput(); err != nil {
+		return fmt.Errorf("invalid sudo rules: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// writeSudoers writes a sudoers.d file with the mode sudo requires, never
+// through a symlink.
+func writeSudoers(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0750); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_NOFOLLOW, sudoersMode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Chmod(sudoersMode); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
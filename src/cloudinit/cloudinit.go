@@ -0,0 +1,314 @@
+package cloudinit
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FILE_SUDOERS is where cloud-init writes the sudo rules of its users.
+const FILE_SUDOERS = "/etc/sudoers.d/90-cloud-init-users"
+
+// DefaultUser is the users entry cloud-init replaces with the default user
+// of the distribution, which is not known offline and is skipped.
+const DefaultUser = "default"
+
+// Config is the users and groups part of cloud-config user-data:
+//
+//	#cloud-config
+//	groups:
+//	  - admins: [root]
+//	  - developers
+//	users:
+//	  - default
+//	  - name: alice
+//	    groups: developers, admins
+//	    ssh_authorized_keys: ["ssh-ed25519 AAAA... alice"]
+//	    sudo: ALL=(ALL) NOPASSWD:ALL
+//
+// Other keys of the user-data are ignored.
+type Config struct {
+	Groups Groups `yaml:"groups"`
+	Users  Users  `yaml:"users"`
+}
+
+// Group is a group to create, with the users to add to it.
+type Group struct {
+	Name    string
+	Members []string
+}
+
+// Groups accepts a list of names and of single key maps from a name to its
+// members, a map from names to members, or a comma separated string.
+type Groups []Group
+
+// User is an entry of the users list. Only the keys below are supported.
+type User struct {
+	Name         string `yaml:"name"`
+	Gecos        string `yaml:"gecos"`
+	PrimaryGroup string `yaml:"primary_group"`
+	// Groups are the supplementary groups, as a list or a comma separated
+	// string.
+	Groups       List   `yaml:"groups"`
+	Homedir      string `yaml:"homedir"`
+	NoCreateHome bool   `yaml:"no_create_home"`
+	Shell        string `yaml:"shell"`
+	// LockPasswd locks the password and defaults to true, like cloud-init.
+	LockPasswd *bool `yaml:"lock_passwd"`
+	// Passwd is a crypt(3) hash.
+	Passwd            string   `yaml:"passwd"`
+	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys"`
+	// Sudo holds sudoers rules, without the user name. False or null
+	// means none.
+	Sudo   List `yaml:"sudo"`
+	System bool `yaml:"system"`
+	UID    *int `yaml:"-"`
+}
+
+// Users accepts a list of names and user maps, or a comma separated string
+// of names.
+type Users []User
+
+// List accepts a list of strings, a comma separated string, or false or null
+// for an empty list.
+type List []string
+
+// Locked returns true if the password of the user is to be locked.
+func (u *User) Locked() bool {
+	return u.LockPasswd == nil || *u.LockPasswd
+}
+
+// UnmarshalYAML reads a string or a list of strings.
+func (l *List) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case nil:
+		*l = nil
+	case bool:
+		if v {
+			return errors.New("expected a string, a list or false")
+		}
+		*l = nil
+	case string:
+		*l = split(v)
+	case []interface{}:
+		*l = nil
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return errors.New("expected a list of strings")
+			}
+			*l = append(*l, s)
+		}
+	default:
+		return errors.New("expected a string, a list or false")
+	}
+
+	return nil
+}
+
+// UnmarshalYAML reads the forms of the groups key.
+func (g *Groups) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	if s, ok := v.(string); ok {
+		for _, name := range split(s) {
+			*g = append(*g, Group{Name: name})
+		}
+		return nil
+	}
+
+	var m map[string]List
+	if err := unmarshal(&m); err == nil {
+		*g = append(*g, groupsFromMap(m)...)
+		return nil
+	}
+
+	var items []interface{}
+	if err := unmarshal(&items); err != nil {
+		return errors.New("groups must be a list, a map or a string")
+	}
+
+	for n, item := range items {
+		switch v := item.(type) {
+		case string:
+			*g = append(*g, Group{Name: strings.TrimSpace(v)})
+		case map[interface{}]interface{}:
+			b, _ := yaml.Marshal(v)
+			var m map[string]List
+			if err := yaml.Unmarshal(b, &m); err != nil {
+				return fmt.Errorf("groups entry %d: %s", n+1, err)
+			}
+			*g = append(*g, groupsFromMap(m)...)
+		default:
+			return fmt.Errorf("groups entry %d must be a name or a map", n+1)
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalYAML reads the forms of the users key.
+func (u *Users) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	if s, ok := v.(string); ok {
+		for _, name := range split(s) {
+			*u = append(*u, User{Name: name})
+		}
+		return nil
+	}
+
+	var items []interface{}
+	if err := unmarshal(&items); err != nil {
+		return errors.New("users must be a list or a string")
+	}
+
+	for n, item := range items {
+		switch v := item.(type) {
+		case string:
+			*u = append(*u, User{Name: strings.TrimSpace(v)})
+		case map[interface{}]interface{}:
+			b, _ := yaml.Marshal(v)
+			var user User
+			if err := yaml.Unmarshal(b, &user); err != nil {
+				return fmt.Errorf("users entry %d: %s", n+1, err)
+			}
+			*u = append(*u, user)
+		default:
+			return fmt.Errorf("users entry %d must be a name or a map", n+1)
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalYAML reads a user map, accepting the uid as a number or a
+// string.
+func (u *User) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain User
+	if err := unmarshal((*plain)(u)); err != nil {
+		return err
+	}
+
+	var id struct {
+		UID interface{} `yaml:"uid"`
+	}
+	if err := unmarshal(&id); err != nil {
+		return err
+	}
+
+	switch v := id.UID.(type) {
+	case nil:
+	case int:
+		u.UID = &v
+	case string:
+		uid, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("invalid uid %q", v)
+		}
+		u.UID = &uid
+	default:
+		return fmt.Errorf("invalid uid %v", v)
+	}
+
+	if len(u.Name) == 0 {
+		return errors.New("user without a name")
+	}
+
+	if _, err := u.SudoRules(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Unmarshal will unmarshal cloud-config user-data into a Config.
+func Unmarshal(data []byte, dest interface{}) error {
+	switch dest.(type) {
+	case *Config:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of cloudinit.Config")
+	}
+
+	return yaml.Unmarshal(data, dest)
+}
+
+// LoadFromFile will read cloud-config user-data and return the parsed
+// Config or error.
+func LoadFromFile(file string) (*Config, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{}
+	if err := Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	return c, nil
+}
+
+// SudoRules returns the sudoers lines of a user, one per rule. A rule with
+// a line break is refused, since it could add any sudoers line. Otherwise
+// rules are trusted and written as is, like cloud-init does.
+func (u *User) SudoRules() ([]string, error) {
+	var rules []string
+	for _, rule := range u.Sudo {
+		if strings.ContainsAny(rule, "\r\n\x00") {
+			return nil, fmt.Errorf("sudo rule of %s contains a line break", u.Name)
+		}
+
+		if rule = strings.TrimSpace(rule); len(rule) > 0 {
+			rules = append(rules, u.Name+" "+rule)
+		}
+	}
+
+	return rules, nil
+}
+
+// groupsFromMap returns the groups of a name to members map, sorted by name
+// since maps have no order.
+func groupsFromMap(m map[string]List) []Group {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var grps []Group
+	for _, name := range names {
+		grps = append(grps, Group{Name: name, Members: m[name]})
+	}
+
+	return grps
+}
+
+// split splits a comma separated string, dropping empty items.
+func split(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			out = append(out, item)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,111 @@
+package cloudinit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+	data := []byte(`#cloud-config
+hostname: ignored
+groups:
+  - admins: [root, sys]
+  - developers
+  - ops: alice
+users:
+  - default
+  - bob
+  - name: alice
+    gecos: Alice
+    primary_group: staff
+    groups: developers, admins
+    shell: /bin/bash
+    lock_passwd: false
+    passwd: $6$salt$hash
+    ssh_authorized_keys:
+      - ssh-ed25519 AAAA alice
+    sudo: ALL=(ALL) NOPASSWD:ALL
+    system: false
+    uid: "1500"
+  - name: svc
+    system: true
+    sudo: false
+    uid: 900
+`)
+
+	c := &Config{}
+	if err := Unmarshal(data, c); err != nil {
+		t.Fatal(err)
+	}
+
+	groups := Groups{{"admins", []string{"root", "sys"}}, {"developers", nil}, {"ops", []string{"alice"}}}
+	if !reflect.DeepEqual(c.Groups, groups) {
+		t.Errorf("expected %#v, got %#v", groups, c.Groups)
+	}
+
+	if len(c.Users) != 4 || c.Users[0].Name != DefaultUser || c.Users[1].Name != "bob" || !c.Users[1].Locked() {
+		t.Fatalf("unexpected users %#v", c.Users)
+	}
+
+	alice := c.Users[2]
+	if alice.Gecos != "Alice" || alice.PrimaryGroup != "staff" || alice.Shell != "/bin/bash" || alice.Locked() || alice.Passwd != "$6$salt$hash" || *alice.UID != 1500 {
+		t.Errorf("unexpected user %#v", alice)
+	}
+
+	if !reflect.DeepEqual([]string(alice.Groups), []string{"developers", "admins"}) {
+		t.Errorf("unexpected groups %q", alice.Groups)
+	}
+
+	if rules, err := alice.SudoRules(); err != nil || len(rules) != 1 || rules[0] != "alice ALL=(ALL) NOPASSWD:ALL" {
+		t.Errorf("unexpected sudo rules %q %v", rules, err)
+	}
+
+	svc := c.Users[3]
+	if rules, _ := svc.SudoRules(); !svc.System || *svc.UID != 900 || len(rules) != 0 {
+		t.Errorf("unexpected user %#v", svc)
+	}
+}
+
+func TestUnmarshalForms(t *testing.T) {
+	var tests = []struct {
+		data   string
+		users  []string
+		groups []string
+		fails  bool
+	}{
+		{"users: alice, bob\ngroups: a, b\n", []string{"alice", "bob"}, []string{"a", "b"}, false},
+		{"groups:\n  b: [alice]\n  a: []\n", nil, []string{"a", "b"}, false},
+		{"users:\n  - gecos: nameless\n", nil, nil, true},
+		{"users:\n  - name: alice\n    uid: abc\n", nil, nil, true},
+		{"users:\n  - name: alice\n    sudo: true\n", nil, nil, true},
+		{"users:\n  - name: alice\n    sudo: \"ALL=(ALL) ALL\\nroot ALL=(ALL) ALL\"\n", nil, nil, true},
+		{"users:\n  - name: alice\n    sudo: [\"ALL=(ALL) ALL\\r#include /tmp/evil\"]\n", nil, nil, true},
+		{"users: 5\n", nil, nil, true},
+	}
+
+	for testNum, test := range tests {
+		c := &Config{}
+		err := Unmarshal([]byte(test.data), c)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%d) expected an error", testNum)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%d) unexpected error %s", testNum, err)
+			continue
+		}
+
+		var users, groups []string
+		for _, u := range c.Users {
+			users = append(users, u.Name)
+		}
+		for _, g := range c.Groups {
+			groups = append(groups, g.Name)
+		}
+
+		if !reflect.DeepEqual(users, test.users) || !reflect.DeepEqual(groups, test.groups) {
+			t.Errorf("%d) expected %q and %q, got %q and %q", testNum, test.users, test.groups, users, groups)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package cron
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mikemackintosh/wonka/src/home"
+)
+
+// Dirs are the crontab spools used by Debian and Red Hat style systems.
+var Dirs = []string{"/var/spool/cron/crontabs", "/var/spool/cron"}
+
+// Find returns the spool directories holding a crontab for username below
+// root.
+func Find(root, username string) []string {
+	var dirs []string
+	for _, dir := range Dirs {
+		path, err := home.Resolve(root, filepath.Join(dir, username))
+		if err != nil {
+			continue
+		}
+
+		if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
+
+// Rename moves the crontab of old in dir to new. An existing crontab for
+// new is never overwritten.
+func Rename(root, dir, old, new string) error {
+	src, err := home.Resolve(root, filepath.Join(dir, old))
+	if err != nil {
+		return err
+	}
+
+	dst, err := home.Resolve(root, filepath.Join(dir, new))
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(dst); err == nil {
+		return &os.PathError{Op: "rename", Path: dst, Err: os.ErrExist}
+	}
+
+	return os.Rename(src, dst)
+}
@@ -0,0 +1,192 @@
+package wonka
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mikemackintosh/wonka/src/spec"
+)
+
+// EnsureUser creates, updates or removes a user so it matches u, leaving
+// fields u does not set alone. When u lists its groups, the user is added
+// to those and removed from every other group. It returns whether anything
+// changed, and each field that did. Nothing is written until Save is
+// called.
+func (i *Instance) EnsureUser(u spec.User) (bool, []FieldChange, error) {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return false, nil, errNotLoaded
+	}
+
+	if err := i.checkSpec(&spec.Spec{Users: []spec.User{u}}); err != nil {
+		return false, nil, err
+	}
+
+	existing := i.Passwd.GetUser(u.Name)
+	if !u.Present() {
+		if existing == nil {
+			return false, nil, nil
+		}
+
+		if err := i.deleteUserStep(u.Name).apply(); err != nil {
+			return false, nil, err
+		}
+
+		return true, []FieldChange{{Field: "state", Old: spec.StatePresent, New: spec.StateAbsent}}, nil
+	}
+
+	var changes []FieldChange
+	if existing == nil {
+		if err := i.createUserStep(u).apply(); err != nil {
+			return false, nil, err
+		}
+		changes = i.userFields(u.Name)
+	} else {
+		step, err := i.updateUserStep(u, existing)
+		if err != nil {
+			return false, nil, err
+		}
+
+		if err := step.apply(); err != nil {
+			return false, nil, err
+		}
+		changes = step.Fields
+	}
+
+	if u.Groups != nil {
+		if change, ok := i.ensureMemberships(u.Name, u.Groups); ok {
+			changes = append(changes, change)
+		}
+	}
+
+	return len(changes) > 0, changes, nil
+}
+
+// EnsureGroup creates, updates or removes a group so it matches g. When g
+// lists its members they replace the current ones. It returns whether
+// anything changed, and each field that did. Nothing is written until Save
+// is called.
+func (i *Instance) EnsureGroup(g spec.Group) (bool, []FieldChange, error) {
+	if i.Passwd == nil || i.Groups == nil {
+		return false, nil, errNotLoaded
+	}
+
+	s := &spec.Spec{Groups: []spec.Group{g}}
+	if err := i.checkSpec(s); err != nil {
+		return false, nil, err
+	}
+
+	existing := i.Groups.GetGroup(g.Name)
+	if !g.Present() {
+		if existing == nil {
+			return false, nil, nil
+		}
+
+		if err := i.deleteGroupStep(g.Name).apply(); err != nil {
+			return false, nil, err
+		}
+
+		return true, []FieldChange{{Field: "state", Old: spec.StatePresent, New: spec.StateAbsent}}, nil
+	}
+
+	if existing == nil {
+		if err := i.createGroupStep(g, desiredMembers(s, g.Name, nil)).apply(); err != nil {
+			return false, nil, err
+		}
+
+		return true, i.groupFields(g.Name), nil
+	}
+
+	step, err := i.updateGroupStep(s, g.Name, &g)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if err := step.apply(); err != nil {
+		return false, nil, err
+	}
+
+	return len(step.Fields) > 0, step.Fields, nil
+}
+
+// ensureMemberships makes groups the exact supplementary groups of a user,
+// returning the change of its group list.
+func (i *Instance) ensureMemberships(name string, groups []string) (FieldChange, bool) {
+	before := i.memberOf(name)
+
+	for _, group := range *i.Groups {
+		want := contains(groups, group.Name)
+		if want == group.HasUser(name) {
+			continue
+		}
+
+		members := append([]string{}, group.Users...)
+		if want {
+			members = append(members, name)
+		} else {
+			members = remove(members, name)
+		}
+		i.setMembers(group.Name, members)
+	}
+
+	after := i.memberOf(name)
+	if before == after {
+		return FieldChange{}, false
+	}
+
+	return FieldChange{Field: "groups", Old: none(before), New: none(after)}, true
+}
+
+// memberOf returns the sorted, comma separated groups a user is a member
+// of.
+func (i *Instance) memberOf(name string) string {
+	var names []string
+	for _, group := range *i.Groups {
+		if group.HasUser(name) {
+			names = append(names, group.Name)
+		}
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ",")
+}
+
+// userFields describes a newly created user.
+func (i *Instance) userFields(name string) []FieldChange {
+	entry := i.Passwd.GetUser(name)
+	fields := []FieldChange{
+		{Field: "uid", New: strconv.Itoa(entry.UID)},
+		{Field: "group", New: i.groupName(entry.GID)},
+	}
+
+	for _, f := range []FieldChange{{Field: "info", New: entry.Info}, {Field: "home", New: entry.HomeDir}, {Field: "shell", New: entry.Shell}} {
+		if len(f.New) > 0 {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// groupFields describes a newly created group.
+func (i *Instance) groupFields(name string) []FieldChange {
+	group := i.Groups.GetGroup(name)
+	fields := []FieldChange{{Field: "gid", New: strconv.Itoa(group.GID)}}
+	if len(group.Users) > 0 {
+		fields = append(fields, FieldChange{Field: "members", New: strings.Join(group.Users, ",")})
+	}
+
+	return fields
+}
+
+// remove returns list without s.
+func remove(list []string, s string) []string {
+	var out []string
+	for _, item := range list {
+		if item != s {
+			out = append(out, item)
+		}
+	}
+
+	return out
+}
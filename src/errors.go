@@ -0,0 +1,31 @@
+package wonka
+
+// ErrNotFound is used when a user or group is not found.
+type ErrNotFound struct {
+	err string
+}
+
+// Error takes an error and returns a string. Satisfies the interface.
+func (e *ErrNotFound) Error() string {
+	return e.err
+}
+
+// ErrExists is used when a user or group already exists.
+type ErrExists struct {
+	err string
+}
+
+// Error takes an error and returns a string. Satisfies the interface.
+func (e *ErrExists) Error() string {
+	return e.err
+}
+
+// ErrBusy is used when a user has running processes or is logged in.
+type ErrBusy struct {
+	err string
+}
+
+// Error takes an error and returns a string. Satisfies the interface.
+func (e *ErrBusy) Error() string {
+	return e.err
+}
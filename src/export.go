@@ -0,0 +1,37 @@
+package wonka
+
+import (
+	"fmt"
+
+	"github.com/mikemackintosh/wonka/src/export"
+)
+
+// Databases Export accepts. ExportUsers is the joined view of passwd,
+// shadow and group memberships.
+const (
+	ExportPasswd = "passwd"
+	ExportShadow = "shadow"
+	ExportGroup  = "group"
+	ExportUsers  = "users"
+)
+
+// Export returns a loaded database as a table, ready to be written as JSON,
+// YAML or CSV. Password hashes are redacted unless opts.ShowHashes is set.
+func (i *Instance) Export(db string, opts export.Options) (*export.Table, error) {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return nil, errNotLoaded
+	}
+
+	switch db {
+	case ExportPasswd:
+		return export.Passwd(*i.Passwd, opts), nil
+	case ExportShadow:
+		return export.Shadow(*i.Shadow, opts), nil
+	case ExportGroup:
+		return export.Groups(*i.Groups, opts), nil
+	case ExportUsers:
+		return export.Users(*i.Passwd, *i.Shadow, *i.Groups, opts), nil
+	}
+
+	return nil, fmt.Errorf("unknown database %q, expected passwd, shadow, group or users", db)
+}
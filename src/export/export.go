@@ -0,0 +1,292 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/shadow"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Formats a table can be written in.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatCSV  = "csv"
+)
+
+// Redacted replaces password hashes unless Options.ShowHashes is set.
+const Redacted = "(redacted)"
+
+// MustChange is the last change date of a password which must be changed
+// at the next login, which shadow stores as day 0.
+const MustChange = "(must change)"
+
+// Fields of each table, in the order they are written.
+var (
+	PasswdFields = []string{"name", "password", "uid", "gid", "info", "home", "shell"}
+	ShadowFields = []string{"name", "password", "last_change", "min_days", "max_days", "warn_days", "inactive_days", "expires"}
+	GroupFields  = []string{"name", "password", "gid", "members"}
+	// UserFields is the joined view of a user's passwd and shadow entries
+	// and group memberships.
+	UserFields = []string{"name", "uid", "gid", "group", "groups", "info", "home", "shell", "password", "locked", "last_change", "min_days", "max_days", "warn_days", "inactive_days", "expires"}
+)
+
+// Options control what is exported.
+type Options struct {
+	// ShowHashes exports password hashes instead of Redacted.
+	ShowHashes bool
+}
+
+// Table holds exported records as rows of values, one per field. Values
+// are strings, ints, bools, string lists, or nil for unset fields.
+type Table struct {
+	Fields []string
+	Rows   [][]interface{}
+}
+
+// Passwd returns a table of passwd entries.
+func Passwd(entries passwd.Entries, opts Options) *Table {
+	t := &Table{Fields: PasswdFields}
+	for _, e := range entries {
+		t.Rows = append(t.Rows, []interface{}{e.Username, password(e.Password, opts), e.UID, e.GID, e.Info, e.HomeDir, e.Shell})
+	}
+
+	return t
+}
+
+// Shadow returns a table of shadow entries, with dates as YYYY-MM-DD and
+// password aging in days.
+func Shadow(entries shadow.Entries, opts Options) *Table {
+	t := &Table{Fields: ShadowFields}
+	for _, e := range entries {
+		t.Rows = append(t.Rows, append([]interface{}{e.Username, password(e.Password, opts)}, aging(e)...))
+	}
+
+	return t
+}
+
+// Groups returns a table of group entries.
+func Groups(entries groups.Entries, opts Options) *Table {
+	t := &Table{Fields: GroupFields}
+	for _, g := range entries {
+		t.Rows = append(t.Rows, []interface{}{g.Name, password(g.Password, opts), g.GID, list(g.Users)})
+	}
+
+	return t
+}
+
+// Users returns the joined view of every passwd entry, with its shadow
+// entry and the groups it is a member of. Users without a shadow entry
+// have nil shadow fields.
+func Users(pwd passwd.Entries, shd shadow.Entries, grp groups.Entries, opts Options) *Table {
+	t := &Table{Fields: UserFields}
+	for _, e := range pwd {
+		var primary interface{}
+		var memberOf []string
+		for _, g := range grp {
+			if g.GID == e.GID && primary == nil {
+				primary = g.Name
+			}
+
+			if g.HasUser(e.Username) {
+				memberOf = append(memberOf, g.Name)
+			}
+		}
+		sort.Strings(memberOf)
+
+		row := []interface{}{e.Username, e.UID, e.GID, primary, list(memberOf), e.Info, e.HomeDir, e.Shell}
+		if s := shd.GetUserEntry(e.Username); s != nil {
+			row = append(row, password(s.Password, opts), s.IsLocked())
+			row = append(row, aging(s)...)
+		} else {
+			row = append(row, make([]interface{}, len(UserFields)-len(row))...)
+		}
+
+		t.Rows = append(t.Rows, row)
+	}
+
+	return t
+}
+
+// Select returns a table with only the listed fields, in that order.
+func (t *Table) Select(fields []string) (*Table, error) {
+	index := make([]int, len(fields))
+	for n, field := range fields {
+		index[n] = -1
+		for k, f := range t.Fields {
+			if f == field {
+				index[n] = k
+			}
+		}
+
+		if index[n] < 0 {
+			return nil, fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(t.Fields, ", "))
+		}
+	}
+
+	out := &Table{Fields: fields}
+	for _, row := range t.Rows {
+		selected := make([]interface{}, len(index))
+		for n, k := range index {
+			selected[n] = row[k]
+		}
+		out.Rows = append(out.Rows, selected)
+	}
+
+	return out, nil
+}
+
+// Marshal is a helper for export.Marshal().
+func (t *Table) Marshal(format string) ([]byte, error) {
+	return Marshal(t, format)
+}
+
+// Marshal writes a table as a JSON or YAML list of records with the fields
+// in order, or as CSV with a header line. In CSV, lists are comma
+// separated and unset fields are empty.
+func Marshal(t *Table, format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		records := make([]record, len(t.Rows))
+		for n, row := range t.Rows {
+			records[n] = record{t.Fields, row}
+		}
+
+		b, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		return append(b, '\n'), nil
+	case FormatYAML:
+		records := make([]yaml.MapSlice, len(t.Rows))
+		for n, row := range t.Rows {
+			for k, field := range t.Fields {
+				records[n] = append(records[n], yaml.MapItem{Key: field, Value: row[k]})
+			}
+		}
+
+		return yaml.Marshal(records)
+	case FormatCSV:
+		var b bytes.Buffer
+		w := csv.NewWriter(&b)
+		w.Write(t.Fields)
+		for _, row := range t.Rows {
+			line := make([]string, len(row))
+			for n, v := range row {
+				line[n] = csvValue(v)
+			}
+			w.Write(line)
+		}
+		w.Flush()
+
+		return b.Bytes(), w.Error()
+	}
+
+	return nil, fmt.Errorf("unknown format %q, expected json, yaml or csv", format)
+}
+
+// record is a row written as a JSON object with its fields in order.
+type record struct {
+	fields []string
+	values []interface{}
+}
+
+// MarshalJSON writes the fields in table order, which a map would not.
+func (r record) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for n, field := range r.fields {
+		if n > 0 {
+			b.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(field)
+		value, err := json.Marshal(r.values[n])
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+// csvValue formats a value as a CSV field.
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case []string:
+		return strings.Join(v, ",")
+	}
+
+	return fmt.Sprint(v)
+}
+
+// password returns a hash, or Redacted with the lock kept visible. Values
+// which are not hashes, like "x", "*" and "!", are never redacted.
+func password(p string, opts Options) string {
+	hash := strings.TrimLeft(p, "!")
+	if opts.ShowHashes || len(hash) == 0 || hash == "*" || hash == "x" {
+		return p
+	}
+
+	return p[:len(p)-len(hash)] + Redacted
+}
+
+// aging returns the date and password aging fields of a shadow entry.
+func aging(e *shadow.Entry) []interface{} {
+	lastChange := date(e.LastPasswordChange)
+	if e.LastPasswordChange.MustChange() {
+		lastChange = MustChange
+	}
+
+	return []interface{}{lastChange, days(e.MinimumPasswordAge), days(e.MaximumPasswordAge), days(e.WarningPeriod), days(e.InactivityPeriod), date(e.AccountExpiration)}
+}
+
+// date formats a shadow date as YYYY-MM-DD, or nil when unset.
+func date(d shadow.Date) interface{} {
+	if d.IsUnset() {
+		return nil
+	}
+
+	return d.Time().Format("2006-01-02")
+}
+
+// days returns a duration in days, or nil when unset.
+func days(d *time.Duration) interface{} {
+	if d == nil {
+		return nil
+	}
+
+	return int(*d / (24 * time.Hour))
+}
+
+// list returns a non-nil list, so empty lists are not written as null.
+func list(l []string) []string {
+	if l == nil {
+		return []string{}
+	}
+
+	return l
+}
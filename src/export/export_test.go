@@ -0,0 +1,141 @@
+package export
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/shadow"
+)
+
+func TestPassword(t *testing.T) {
+	var tests = []struct {
+		password string
+		show     bool
+		expected string
+	}{
+		{"$6$salt$hash", false, Redacted},
+		{"!$6$salt$hash", false, "!" + Redacted},
+		{"$6$salt$hash", true, "$6$salt$hash"},
+		{"*", false, "*"},
+		{"!*", false, "!*"},
+		{"!", false, "!"},
+		{"x", false, "x"},
+		{"", false, ""},
+	}
+
+	for _, test := range tests {
+		if got := password(test.password, Options{ShowHashes: test.show}); got != test.expected {
+			t.Errorf("expected %q for %q, got %q", test.expected, test.password, got)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	max := 90 * 24 * time.Hour
+	pwd := passwd.Entries{
+		{Username: "alice", Password: "x", UID: 1000, GID: 100, Info: "Alice, Room 1", HomeDir: "/home/alice", Shell: "/bin/bash"},
+		{Username: "bob", Password: "x", UID: 1001, GID: 100, HomeDir: "/home/bob", Shell: "/bin/sh"},
+	}
+	shd := shadow.Entries{{Username: "alice", Password: "!$6$salt$hash", LastPasswordChange: shadow.DateFromDays(18000), MaximumPasswordAge: &max}}
+	grp := groups.Entries{{Name: "users", Password: "x", GID: 100}, {Name: "wheel", Password: "x", GID: 10, Users: []string{"bob", "alice"}}}
+
+	table, err := Users(pwd, shd, grp, Options{}).Select([]string{"name", "group", "groups", "info", "password", "locked", "last_change", "max_days"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		format   string
+		expected string
+	}{
+		{FormatCSV, `name,group,groups,info,password,locked,last_change,max_days
+alice,users,wheel,"Alice, Room 1",!(redacted),true,2019-04-14,90
+bob,users,wheel,,,,,
+`},
+		{FormatJSON, `[
+  {
+    "name": "alice",
+    "group": "users",
+    "groups": [
+      "wheel"
+    ],
+    "info": "Alice, Room 1",
+    "password": "!(redacted)",
+    "locked": true,
+    "last_change": "2019-04-14",
+    "max_days": 90
+  },
+  {
+    "name": "bob",
+    "group": "users",
+    "groups": [
+      "wheel"
+    ],
+    "info": "",
+    "password": null,
+    "locked": null,
+    "last_change": null,
+    "max_days": null
+  }
+]
+`},
+		{FormatYAML, `- name: alice
+  group: users
+  groups:
+  - wheel
+  info: Alice, Room 1
+  password: '!(redacted)'
+  locked: true
+  last_change: "2019-04-14"
+  max_days: 90
+- name: bob
+  group: users
+  groups:
+  - wheel
+  info: ""
+  password: null
+  locked: null
+  last_change: null
+  max_days: null
+`},
+	}
+
+	for _, test := range tests {
+		b, err := table.Marshal(test.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != test.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.format, test.expected, b)
+		}
+	}
+
+	if _, err := table.Marshal("xml"); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+
+	if _, err := Passwd(pwd, Options{}).Select([]string{"name", "expires"}); err == nil || !strings.Contains(err.Error(), "expires") {
+		t.Errorf("expected an unknown field to fail, got %v", err)
+	}
+}
+
+func TestRedactAndMustChange(t *testing.T) {
+	pwd := passwd.Entries{{Username: "alice", Password: "$6$salt$hash", UID: 1000, GID: 100}}
+	if got := Passwd(pwd, Options{}).Rows[0][1]; got != Redacted {
+		t.Errorf("expected a redacted passwd hash, got %v", got)
+	}
+
+	shd := shadow.Entries{{Username: "alice", Password: "!", LastPasswordChange: shadow.DateMustChange, AccountExpiration: shadow.DateFromDays(0)}}
+	row := Shadow(shd, Options{}).Rows[0]
+	if row[2] != MustChange {
+		t.Errorf("expected last_change %q, got %v", MustChange, row[2])
+	}
+
+	if row[7] != "1970-01-01" {
+		t.Errorf("expected expires 1970-01-01, got %v", row[7])
+	}
+}
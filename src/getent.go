@@ -0,0 +1,105 @@
+package wonka
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/gshadow"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/shadow"
+)
+
+// Getent looks up keys in a database like getent(1), returning the lines
+// found, in the order of the keys, and the keys which were not. passwd and
+// group keys are looked up by ID when numeric and by name otherwise, while
+// shadow and gshadow keys are names. Without keys, every entry is
+// returned. A missing gshadow file has no entries.
+func (i *Instance) Getent(db string, keys []string) ([]string, []string, error) {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return nil, nil, errNotLoaded
+	}
+
+	var lookup func(key string) (marshaler, bool)
+	var all marshaler
+	switch db {
+	case "passwd":
+		all = *i.Passwd
+		lookup = func(key string) (marshaler, bool) {
+			entry := i.Passwd.GetUser(key)
+			if id, err := strconv.Atoi(key); err == nil {
+				entry = i.Passwd.GetUserByID(id)
+			}
+
+			if entry == nil {
+				return nil, false
+			}
+
+			return passwd.Entries{*entry}, true
+		}
+	case "shadow":
+		all = *i.Shadow
+		lookup = func(key string) (marshaler, bool) {
+			entry := i.Shadow.GetUserEntry(key)
+			return shadow.Entries{entry}, entry != nil
+		}
+	case "group":
+		all = *i.Groups
+		lookup = func(key string) (marshaler, bool) {
+			group := i.Groups.GetGroup(key)
+			if id, err := strconv.Atoi(key); err == nil {
+				group = i.Groups.GetGroupByID(id)
+			}
+
+			return groups.Entries{group}, group != nil
+		}
+	case "gshadow":
+		all = gshadow.Entries{}
+		if i.Gshadow != nil {
+			all = *i.Gshadow
+		}
+		lookup = func(key string) (marshaler, bool) {
+			entry := i.gshadowEntry(key)
+			return gshadow.Entries{entry}, entry != nil
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown database %q, expected passwd, shadow, group or gshadow", db)
+	}
+
+	if len(keys) == 0 {
+		lines, err := marshalLines(all)
+		return lines, nil, err
+	}
+
+	var found, missing []string
+	for _, key := range keys {
+		entries, ok := lookup(key)
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+
+		lines, err := marshalLines(entries)
+		if err != nil {
+			return nil, nil, err
+		}
+		found = append(found, lines...)
+	}
+
+	return found, missing, nil
+}
+
+// marshalLines returns the lines of a database as written to its file.
+func marshalLines(entries marshaler) ([]string, error) {
+	b, err := entries.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	if s := strings.TrimSuffix(string(b), "\n"); len(s) > 0 {
+		return strings.Split(s, "\n"), nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,133 @@
+package wonka
+
+import (
+	"fmt"
+
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/gshadow"
+	"github.com/mikemackintosh/wonka/src/managed"
+)
+
+// Group describes a group to create with AddGroup.
+type Group struct {
+	Name string
+	// GID is picked from the login.defs ranges when nil.
+	GID     *int
+	Members []string
+	// System groups use the system GID range.
+	System bool
+}
+
+// AddGroup creates a new group entry. Nothing is written until Save is
+// called.
+func (i *Instance) AddGroup(g Group) (*groups.Group, error) {
+	if i.Groups == nil {
+		return nil, errNotLoaded
+	}
+
+	if err := ValidName(g.Name); err != nil {
+		return nil, err
+	}
+
+	if i.Groups.GetGroup(g.Name) != nil {
+		return nil, &ErrExists{fmt.Sprintf("group %s already exists", g.Name)}
+	}
+
+	var gid int
+	if g.GID != nil {
+		if owner := i.Groups.GetGroupByID(*g.GID); owner != nil {
+			return nil, &ErrExists{fmt.Sprintf("gid %d is used by %s", *g.GID, owner.Name)}
+		}
+		gid = *g.GID
+	} else {
+		var err error
+		if gid, err = i.NextGID(g.System); err != nil {
+			return nil, err
+		}
+	}
+
+	group := &groups.Group{Name: g.Name, Password: "x", GID: gid}
+	for _, member := range g.Members {
+		group.AddUser(member)
+	}
+	i.Groups.NewGroup(group)
+	i.addGshadow(g.Name)
+
+	if entry := i.gshadowEntry(g.Name); entry != nil {
+		entry.Members = append(entry.Members, group.Users...)
+	}
+
+	return group, nil
+}
+
+// DeleteGroup removes a group. Like groupdel, it refuses to remove the
+// primary group of an existing user. Nothing is written until Save is
+// called.
+func (i *Instance) DeleteGroup(name string) error {
+	if i.Passwd == nil || i.Groups == nil {
+		return errNotLoaded
+	}
+
+	group := i.Groups.GetGroup(name)
+	if group == nil {
+		return &ErrNotFound{fmt.Sprintf("group %s does not exist", name)}
+	}
+
+	for _, user := range *i.Passwd {
+		if user.GID == group.GID {
+			return fmt.Errorf("cannot remove the primary group of user %s", user.Username)
+		}
+	}
+
+	if err := i.Groups.RemoveGroup(group); err != nil {
+		return err
+	}
+	i.removeGshadow(name)
+	i.unmanage(managed.KindGroup, name)
+
+	return nil
+}
+
+// addGshadow adds a locked gshadow entry for a new group, when the
+// gshadow file exists.
+func (i *Instance) addGshadow(name string) {
+	if i.Gshadow != nil && i.Gshadow.GetEntry(name) == nil {
+		i.Gshadow.NewEntry(&gshadow.Entry{Name: name, Password: "!"})
+	}
+}
+
+// gshadowEntry returns the gshadow entry of a group, or nil.
+func (i *Instance) gshadowEntry(name string) *gshadow.Entry {
+	if i.Gshadow == nil {
+		return nil
+	}
+
+	return i.Gshadow.GetEntry(name)
+}
+
+// removeGshadow removes the gshadow entry of a group, if there is one.
+func (i *Instance) removeGshadow(name string) {
+	if i.Gshadow == nil {
+		return
+	}
+
+	if entry := i.Gshadow.GetEntry(name); entry != nil {
+		i.Gshadow.RemoveEntry(entry)
+	}
+}
+
+// addMember adds user to the member list of a group, in group and gshadow.
+// It returns false if the group does not exist or already has the user.
+func (i *Instance) addMember(name, user string) bool {
+	group := i.Groups.GetGroup(name)
+	if group == nil || group.HasUser(user) {
+		return false
+	}
+
+	group.AddUser(user)
+	if entry := i.gshadowEntry(name); entry != nil && !contains(entry.Members, user) {
+		entry.Members = append(entry.Members, user)
+	}
+
+	return true
+}
@@ -67,8 +67,10 @@ func Unmarshal(data []byte, dest interface{}) error {
 			errs = append(errs, errors.New("invalid gid"))
 		}
 
-		// Split the lines on the delim, ":".
-		users = strings.Split(parts[3], ",")
+		// Split the lines on the delim, ":". An empty list has no users.
+		if len(parts[3]) > 0 {
+			users = strings.Split(parts[3], ",")
+		}
 
 		// Populate the new Group.
 		Group := &Group{
@@ -120,13 +122,18 @@ func Marshal(in Entries) ([]byte, error) {
 
 // Save will take in entries.
 func (e Entries) Save() error {
+	return e.SaveToFile(FILE_GROUP)
+}
+
+// SaveToFile will write the entries to the provided file.
+func (e Entries) SaveToFile(file string) error {
 	b, err := e.Marshal()
 	if err != nil {
 		return err
 	}
 
 	// Will write the entries list with.
-	if err = locker.WriteWithLock(FILE_GROUP, b); err != nil {
+	if err = locker.WriteWithLock(file, b); err != nil {
 		return err
 	}
 
@@ -135,7 +142,13 @@ func (e Entries) Save() error {
 
 // LoadFromDisk will read an /etc/passwd file and return parsed Entries or error.
 func LoadFromDisk() (*Entries, error) {
-	b, err := ioutil.ReadFile(FILE_GROUP)
+	return LoadFromFile(FILE_GROUP)
+}
+
+// LoadFromFile will read the provided /etc/group formatted file and return parsed
+// Entries or error.
+func LoadFromFile(file string) (*Entries, error) {
+	b, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
@@ -196,11 +209,38 @@ func (e *Entries) GetGroupByID(id int) *Group {
 	return nil
 }
 
-// TODO: add check for existing user
+// AddUser adds a user to the member list, unless it is already a member.
 func (g *Group) AddUser(name string) {
+	if g.HasUser(name) {
+		return
+	}
+
 	g.Users = append(g.Users, name)
 }
 
+// HasUser returns true if name is in the member list.
+func (g *Group) HasUser(name string) bool {
+	for _, user := range g.Users {
+		if user == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RenameUser renames a member, returning true if it was in the list.
+func (g *Group) RenameUser(old, new string) bool {
+	for i, user := range g.Users {
+		if user == old {
+			g.Users[i] = new
+			return true
+		}
+	}
+
+	return false
+}
+
 // TODO: add check for existing user.
 func (g *Group) RemoveUser(name string) error {
 	// Look for the username, then remove it.
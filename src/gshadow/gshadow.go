@@ -0,0 +1,231 @@
+package gshadow
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mikemackintosh/wonka/src/libs/locker"
+)
+
+const FILE_GSHADOW = "/etc/gshadow"
+
+type Entries []*Entry
+
+// Entry is the shadowed part of a group: its password, administrators and
+// members. Line holds the original text of lines which failed to parse,
+// which are written back unchanged.
+type Entry struct {
+	Name     string
+	Password string
+	Admins   []string
+	Members  []string
+	Errors   []error
+	Line     string
+}
+
+// Unmarshal will unmarshal a provided gshadow formatted file.
+func Unmarshal(data []byte, dest interface{}) error {
+	switch dest.(type) {
+	case *Entries:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of gshadow.Entries")
+	}
+
+	outfile := dest.(*Entries)
+	file := strings.TrimSpace(string(data))
+	lines := strings.Split(file, "\n")
+
+	for _, line := range lines {
+		line := strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") || len(line) == 0 {
+			continue
+		}
+
+		var errs []error
+
+		// Split the lines on the delim, ":".
+		parts := strings.Split(line, ":")
+		if len(parts) != 4 {
+			errs = append(errs, errors.New("gshadow entry does not have 4 segments"))
+			parts = append(parts, "", "", "")
+		}
+
+		// Check if name is provided or not.
+		if len(parts[0]) < 1 {
+			errs = append(errs, errors.New("invalid name parsed"))
+		}
+
+		entry := &Entry{
+			Name:     parts[0],
+			Password: parts[1],
+			Admins:   splitList(parts[2]),
+			Members:  splitList(parts[3]),
+			Errors:   errs,
+		}
+
+		if len(errs) > 0 {
+			entry.Line = line
+		}
+
+		*outfile = append(*outfile, entry)
+	}
+
+	return nil
+}
+
+// splitList splits a comma separated list, returning nil for an empty one.
+func splitList(field string) []string {
+	if len(field) == 0 {
+		return nil
+	}
+
+	return strings.Split(field, ",")
+}
+
+// Marshal is a helper for gshadow.Marshal().
+func (e Entries) Marshal() ([]byte, error) {
+	return Marshal(e)
+}
+
+// Marshal will parse the provided entries into a byte array for writing.
+// Lines which failed to parse are kept as they were read.
+func Marshal(in Entries) ([]byte, error) {
+	var out []string
+
+	for _, entry := range in {
+		if len(entry.Line) > 0 {
+			out = append(out, entry.Line)
+			continue
+		}
+
+		if len(entry.Name) == 0 {
+			return nil, errors.New("attempting to save invalid entry")
+		}
+
+		out = append(out, fmt.Sprintf(
+			"%s:%s:%s:%s",
+			entry.Name,
+			entry.Password,
+			strings.Join(entry.Admins, ","),
+			strings.Join(entry.Members, ","),
+		))
+	}
+
+	// Join the slices by new lines.
+	return []byte(strings.Join(out, "\n") + "\n"), nil
+}
+
+// Save will take in entries.
+func (e Entries) Save() error {
+	return e.SaveToFile(FILE_GSHADOW)
+}
+
+// SaveToFile will write the entries to the provided file.
+func (e Entries) SaveToFile(file string) error {
+	b, err := e.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return locker.WriteWithLock(file, b)
+}
+
+// LoadFromDisk will read an /etc/gshadow file and return parsed Entries or
+// error.
+func LoadFromDisk() (*Entries, error) {
+	return LoadFromFile(FILE_GSHADOW)
+}
+
+// LoadFromFile will read the provided /etc/gshadow formatted file and return
+// parsed Entries or error.
+func LoadFromFile(file string) (*Entries, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entries
+	err = Unmarshal(b, &e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// NewEntry adds a new entry to Entries.
+func (e *Entries) NewEntry(new *Entry) {
+	*e = append(*e, new)
+}
+
+// RemoveEntry removes an entry from Entries.
+func (e *Entries) RemoveEntry(rm *Entry) error {
+	if len(rm.Name) == 0 {
+		return errors.New("must provide name to be removed")
+	}
+
+	for i, entry := range *e {
+		if entry.Name == rm.Name {
+			s := *e
+			s = append(s[:i], s[i+1:]...)
+			*e = s
+			return nil
+		}
+	}
+
+	return &ErrNotFound{"entry not found"}
+}
+
+// GetEntry will get an entry by group name.
+func (e *Entries) GetEntry(name string) *Entry {
+	for _, entry := range *e {
+		if entry.Name == name {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+// RemoveUser drops a user from the admin and member lists, returning true if
+// anything changed.
+func (g *Entry) RemoveUser(name string) bool {
+	var changed bool
+	g.Admins, changed = without(g.Admins, name)
+
+	var members bool
+	g.Members, members = without(g.Members, name)
+
+	return changed || members
+}
+
+// RenameUser renames a user in the admin and member lists, returning true
+// if anything changed.
+func (g *Entry) RenameUser(old, new string) bool {
+	changed := false
+	for _, list := range [][]string{g.Admins, g.Members} {
+		for n, user := range list {
+			if user == old {
+				list[n] = new
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+// without returns list with every occurrence of name removed.
+func without(list []string, name string) ([]string, bool) {
+	var out []string
+	for _, user := range list {
+		if user != name {
+			out = append(out, user)
+		}
+	}
+
+	return out, len(out) != len(list)
+}
@@ -0,0 +1,32 @@
+package gshadow
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := [][]byte{
+		[]byte("wheel:!:root:root,alice\n"),
+		[]byte("staff:!::\n"),
+		[]byte("broken:!:root\n"),
+		[]byte(":!::\n"),
+		[]byte("wheel:!:root:alice\nbroken\nstaff:!::\n"),
+	}
+
+	for testNum, test := range tests {
+		var entries Entries
+		if err := Unmarshal(test, &entries); err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := entries.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(output, test) {
+			t.Errorf("%d) expected %q, got %q", testNum, test, output)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package home
+
+// ErrExists is used when a home directory already exists.
+type ErrExists struct {
+	err string
+}
+
+// Error takes an error and returns a string. Satisfies the interface.
+func (e *ErrExists) Error() string {
+	return e.err
+}
+
+// ErrUnsafePath is used when a path would lead outside of the root or the
+// home directory.
+type ErrUnsafePath struct {
+	err string
+}
+
+// Error takes an error and returns a string. Satisfies the interface.
+func (e *ErrUnsafePath) Error() string {
+	return e.err
+}
+
+// ErrRefused is used when a home directory is not safe to move or remove.
+type ErrRefused struct {
+	err string
+}
+
+// Error takes an error and returns a string. Satisfies the interface.
+func (e *ErrRefused) Error() string {
+	return e.err
+}
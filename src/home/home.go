@@ -0,0 +1,255 @@
+package home
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Create makes the home directory dir below root with the provided mode,
+// copies the skeleton directory skel (also below root) into it, and chowns
+// everything to uid and gid. An empty skel skips the copy.
+func Create(root, dir, skel string, uid, gid int, mode os.FileMode) error {
+	target, err := Resolve(root, dir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(target); err == nil {
+		return &ErrExists{fmt.Sprintf("home directory %s already exists", dir)}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Mkdir(target, mode); err != nil {
+		return err
+	}
+
+	// Chown first, since it clears setuid and setgid bits, then set the
+	// mode without the umask applied.
+	if err := os.Lchown(target, uid, gid); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(target, mode); err != nil {
+		return err
+	}
+
+	if len(skel) == 0 {
+		return nil
+	}
+
+	src, err := Resolve(root, skel)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(src)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("skeleton %s is not a directory", skel)
+	}
+
+	return CopyTree(src, target, uid, gid)
+}
+
+// CopyTree copies the contents of src into the existing directory dst,
+// keeping modes and copying symlinks as links. Every copy is owned by uid
+// and gid. Nothing is written through an existing symlink in dst.
+func CopyTree(src, dst string, uid, gid int) error {
+	return copyTree(src, dst, func(os.FileInfo) (int, int) {
+		return uid, gid
+	}, false)
+}
+
+// copyTree copies the contents of src into dst, with owner picking the
+// ownership of each copy. Files with several hard links inside src are
+// linked the same way in dst. When preserve is set, extended attributes
+// (which include ACLs) and modification times are copied as well.
+func copyTree(src, dst string, owner func(os.FileInfo) (int, int), preserve bool) error {
+	var dirs []string
+	var times []os.FileInfo
+	links := map[[2]uint64]string{}
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		if rel == "." {
+			return nil
+		}
+
+		if info.IsDir() {
+			dirs = append(dirs, filepath.Join(dst, rel))
+			times = append(times, info)
+		}
+
+		target := filepath.Join(dst, rel)
+		if key, ok := inode(info); ok && !info.IsDir() {
+			if first, ok := links[key]; ok {
+				return os.Link(first, target)
+			}
+			links[key] = target
+		}
+
+		uid, gid := owner(info)
+		return copyEntry(path, target, info, uid, gid, preserve)
+	})
+	if err != nil || !preserve {
+		return err
+	}
+
+	// Copying into a directory changes its modification time, so set the
+	// directory times once everything is in place.
+	for n, dir := range dirs {
+		if err := os.Chtimes(dir, times[n].ModTime(), times[n].ModTime()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyEntry copies one directory, symlink, regular file, device, FIFO or
+// socket.
+func copyEntry(src, dst string, info os.FileInfo, uid, gid int, preserve bool) error {
+	mode := info.Mode()
+
+	switch {
+	case mode.IsDir():
+		if err := os.Mkdir(dst, mode.Perm()); err != nil {
+			return err
+		}
+
+	case mode&os.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Symlink(link, dst); err != nil {
+			return err
+		}
+
+		return os.Lchown(dst, uid, gid)
+
+	case mode.IsRegular():
+		if err := copyFile(src, dst, mode.Perm()); err != nil {
+			return err
+		}
+
+	default:
+		if err := makeSpecial(dst, info); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Lchown(dst, uid, gid); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(dst, fileMode(mode)); err != nil {
+		return err
+	}
+
+	if !preserve {
+		return nil
+	}
+
+	if err := copyXattrs(src, dst); err != nil {
+		return err
+	}
+
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// copyFile copies a regular file, refusing to open dst if anything already
+// exists there.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// fileMode returns the permission bits including setuid, setgid and sticky.
+func fileMode(mode os.FileMode) os.FileMode {
+	return mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// Resolve returns path below root, refusing paths whose existing parent
+// directories resolve through a symlink to somewhere outside root.
+func Resolve(root, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", &ErrUnsafePath{fmt.Sprintf("%s is not an absolute path", path)}
+	}
+
+	base, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(base, path)
+
+	// Find the deepest existing parent and make sure it is still inside root.
+	parent := filepath.Dir(target)
+	for {
+		if _, err := os.Lstat(parent); err == nil {
+			break
+		}
+
+		if parent == base {
+			break
+		}
+		parent = filepath.Dir(parent)
+	}
+
+	resolved, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+
+	if !within(base, resolved) {
+		return "", &ErrUnsafePath{fmt.Sprintf("%s resolves outside of %s", path, root)}
+	}
+
+	return target, nil
+}
+
+// within returns true if path is base or below it.
+func within(base, path string) bool {
+	if base == path || base == string(filepath.Separator) {
+		return true
+	}
+
+	return strings.HasPrefix(path, base+string(filepath.Separator))
+}
@@ -0,0 +1,97 @@
+package home
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newRoot returns a temporary root with a populated /etc/skel.
+func newRoot(t *testing.T) string {
+	root, err := ioutil.TempDir("", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	skel := filepath.Join(root, "etc", "skel")
+	if err := os.MkdirAll(filepath.Join(skel, ".config"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(skel, ".bashrc"), []byte("# bashrc\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("/etc/passwd", filepath.Join(skel, ".config", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
+
+func TestCreate(t *testing.T) {
+	root := newRoot(t)
+	defer os.RemoveAll(root)
+
+	uid, gid := os.Getuid(), os.Getgid()
+	if err := Create(root, "/home/alice", "/etc/skel", uid, gid, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Path string
+		Mode os.FileMode
+	}{
+		{Path: "home/alice", Mode: os.ModeDir | 0750},
+		{Path: "home/alice/.bashrc", Mode: 0640},
+		{Path: "home/alice/.config", Mode: os.ModeDir | 0700},
+		{Path: "home/alice/.config/link", Mode: os.ModeSymlink | 0777},
+	}
+
+	for testNum, test := range tests {
+		info, err := os.Lstat(filepath.Join(root, test.Path))
+		if err != nil {
+			t.Fatalf("%d) %s", testNum, err)
+		}
+
+		if info.Mode() != test.Mode {
+			t.Errorf("%d) expected %s, got %s", testNum, test.Mode, info.Mode())
+		}
+	}
+
+	link, err := os.Readlink(filepath.Join(root, "home", "alice", ".config", "link"))
+	if err != nil || link != "/etc/passwd" {
+		t.Errorf("expected link to be copied as is, got %q", link)
+	}
+
+	if err := Create(root, "/home/alice", "/etc/skel", uid, gid, 0750); err == nil {
+		t.Error("expected existing home to fail")
+	} else if _, ok := err.(*ErrExists); !ok {
+		t.Errorf("unexpected error %T", err)
+	}
+}
+
+func TestCreateUnsafe(t *testing.T) {
+	root := newRoot(t)
+	defer os.RemoveAll(root)
+
+	outside, err := ioutil.TempDir("", "outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+
+	if err := os.Symlink(outside, filepath.Join(root, "home")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = Create(root, "/home/alice", "/etc/skel", os.Getuid(), os.Getgid(), 0750)
+	if _, ok := err.(*ErrUnsafePath); !ok {
+		t.Fatalf("expected unsafe path error, got %v", err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(outside, "alice")); !os.IsNotExist(err) {
+		t.Error("expected nothing to be created outside of the root")
+	}
+}
@@ -0,0 +1,95 @@
+package home
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Move moves the home directory old to new, both below root. Within a
+// filesystem it is renamed. Across filesystems it is copied keeping
+// ownership, modes, times, ACLs, extended attributes, hard links and
+// special files, and the original is removed once the copy is complete.
+func Move(root, old, new string) error {
+	src, err := Resolve(root, old)
+	if err != nil {
+		return err
+	}
+
+	dst, err := Resolve(root, new)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("home directory %s is not a directory", old)
+	}
+
+	if _, err := os.Lstat(dst); err == nil {
+		return &ErrExists{fmt.Sprintf("home directory %s already exists", new)}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	err = os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+
+	if err := copyHome(src, dst, info); err != nil {
+		// Leave the original in place and clean up the partial copy.
+		os.RemoveAll(dst)
+		return err
+	}
+
+	return os.RemoveAll(src)
+}
+
+// copyHome copies the home directory src to dst, keeping the owner of every
+// file.
+func copyHome(src, dst string, info os.FileInfo) error {
+	uid, gid := ownerOf(info)
+
+	if err := os.Mkdir(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if err := os.Lchown(dst, uid, gid); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(dst, fileMode(info.Mode())); err != nil {
+		return err
+	}
+
+	if err := copyXattrs(src, dst); err != nil {
+		return err
+	}
+
+	if err := copyTree(src, dst, ownerOf, true); err != nil {
+		return err
+	}
+
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// ownerOf returns the uid and gid of a file.
+func ownerOf(info os.FileInfo) (int, int) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(stat.Uid), int(stat.Gid)
+	}
+
+	return -1, -1
+}
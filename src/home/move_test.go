@@ -0,0 +1,149 @@
+package home
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/mikemackintosh/wonka/src/passwd"
+)
+
+func TestMove(t *testing.T) {
+	root := newRoot(t)
+	defer os.RemoveAll(root)
+
+	if err := Create(root, "/home/alice", "/etc/skel", 1000, 1000, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Move(root, "/home/alice", "/srv/alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(root, "home", "alice")); !os.IsNotExist(err) {
+		t.Error("expected the old home to be gone")
+	}
+
+	if _, err := os.Lstat(filepath.Join(root, "srv", "alice", ".bashrc")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCopyHome(t *testing.T) {
+	root := newRoot(t)
+	defer os.RemoveAll(root)
+
+	src := filepath.Join(root, "etc", "skel")
+	if err := os.Lchown(filepath.Join(src, ".bashrc"), 1234, 5678); err != nil {
+		t.Fatal(err)
+	}
+
+	xattrs := syscall.Setxattr(filepath.Join(src, ".bashrc"), "user.wonka", []byte("yes"), 0) == nil
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(root, "copy")
+	if err := copyHome(src, dst, info); err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := os.Lstat(filepath.Join(dst, ".bashrc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uid, gid := ownerOf(copied); uid != 1234 || gid != 5678 {
+		t.Errorf("expected ownership to be kept, got %d:%d", uid, gid)
+	}
+
+	if xattrs {
+		value, err := getxattr(filepath.Join(dst, ".bashrc"), "user.wonka")
+		if err != nil || string(value) != "yes" {
+			t.Errorf("expected xattr to be copied, got %q %v", value, err)
+		}
+	}
+}
+
+func TestCopyHomeSpecial(t *testing.T) {
+	root := newRoot(t)
+	defer os.RemoveAll(root)
+
+	src := filepath.Join(root, "etc", "skel")
+	if err := syscall.Mkfifo(filepath.Join(src, "pipe"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Link(filepath.Join(src, ".bashrc"), filepath.Join(src, "linked")); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(root, "copy")
+	if err := copyHome(src, dst, info); err != nil {
+		t.Fatal(err)
+	}
+
+	pipe, err := os.Lstat(filepath.Join(dst, "pipe"))
+	if err != nil || pipe.Mode()&os.ModeNamedPipe == 0 || pipe.Mode().Perm() != 0600 {
+		t.Errorf("expected the FIFO to be copied, got %v %v", pipe, err)
+	}
+
+	first, err := os.Lstat(filepath.Join(dst, ".bashrc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := os.Lstat(filepath.Join(dst, "linked"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !os.SameFile(first, second) {
+		t.Error("expected the hard links to stay linked")
+	}
+}
+
+func TestCheckRemovable(t *testing.T) {
+	root, err := ioutil.TempDir("", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	users := passwd.Entries{
+		{Username: "alice", HomeDir: "/home/alice"},
+		{Username: "bob", HomeDir: "/home/shared"},
+		{Username: "carol", HomeDir: "/home/shared/"},
+	}
+
+	tests := []struct {
+		Username string
+		Dir      string
+		Refused  bool
+	}{
+		{Username: "alice", Dir: "/home/alice", Refused: false},
+		{Username: "bob", Dir: "/home/shared", Refused: true},
+		{Username: "alice", Dir: "/home", Refused: true},
+		{Username: "alice", Dir: "/var/lib/alice", Refused: true},
+	}
+
+	for testNum, test := range tests {
+		err := CheckRemovable(root, "/home", test.Dir, test.Username, users)
+		if _, refused := err.(*ErrRefused); refused != test.Refused {
+			t.Errorf("%d) expected refused to be %t, got %v", testNum, test.Refused, err)
+		}
+	}
+
+	if mount, err := IsMountPoint("/proc"); err != nil || !mount {
+		t.Errorf("expected /proc to be a mount point, got %t %v", mount, err)
+	}
+}
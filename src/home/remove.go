@@ -0,0 +1,124 @@
+package home
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/mikemackintosh/wonka/src/passwd"
+)
+
+// Remove deletes the home directory dir below root. Symlinks inside it are
+// removed, never followed.
+func Remove(root, dir string) error {
+	target, err := Resolve(root, dir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(target); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(target)
+}
+
+// CheckRemovable returns an error if the home directory of username must not
+// be moved or removed: it is the home of another passwd entry, it is a mount
+// point, or it is not below base. An empty base skips that check.
+func CheckRemovable(root, base, dir, username string, users passwd.Entries) error {
+	clean := filepath.Clean(dir)
+
+	if len(base) > 0 {
+		base = filepath.Clean(base)
+		if clean == base || !within(base, clean) {
+			return &ErrRefused{fmt.Sprintf("%s is outside of the home base %s", dir, base)}
+		}
+	}
+
+	for _, user := range users {
+		if user.Username != username && len(user.HomeDir) > 0 && filepath.Clean(user.HomeDir) == clean {
+			return &ErrRefused{fmt.Sprintf("%s is also the home of %s", dir, user.Username)}
+		}
+	}
+
+	target, err := Resolve(root, dir)
+	if err != nil {
+		return err
+	}
+
+	mount, err := IsMountPoint(target)
+	if err != nil {
+		return err
+	}
+
+	if mount {
+		return &ErrRefused{fmt.Sprintf("%s is a mount point", dir)}
+	}
+
+	return nil
+}
+
+// IsMountPoint returns true if path is on a different device from its
+// parent, or is listed in /proc/self/mountinfo, which catches bind mounts
+// within the same filesystem.
+func IsMountPoint(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	parent, err := os.Lstat(filepath.Dir(path))
+	if err != nil {
+		return false, err
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	parentStat, parentOk := parent.Sys().(*syscall.Stat_t)
+	if ok && parentOk && stat.Dev != parentStat.Dev {
+		return true, nil
+	}
+
+	return inMountInfo(path), nil
+}
+
+// inMountInfo returns true if path is a mount point in /proc/self/mountinfo.
+// Systems without it only get the device check.
+func inMountInfo(path string) bool {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		resolved = path
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The fifth field is the mount point, with spaces escaped as \040.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		if unescapeMount(fields[4]) == resolved {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unescapeMount decodes the octal escapes used in mountinfo.
+func unescapeMount(s string) string {
+	r := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+	return r.Replace(s)
+}
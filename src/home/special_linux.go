@@ -0,0 +1,29 @@
+package home
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// makeSpecial creates a device, FIFO or socket at dst with the type and
+// device number of info. The caller sets the owner and mode.
+func makeSpecial(dst string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("cannot copy special file %s", dst)
+	}
+
+	return syscall.Mknod(dst, stat.Mode, int(stat.Rdev))
+}
+
+// inode returns the device and inode number of a file which has more than
+// one hard link.
+func inode(info os.FileInfo) ([2]uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return [2]uint64{}, false
+	}
+
+	return [2]uint64{uint64(stat.Dev), uint64(stat.Ino)}, true
+}
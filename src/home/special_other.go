@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package home
+
+import (
+	"fmt"
+	"os"
+)
+
+// makeSpecial refuses to copy special files where they cannot be made the
+// same way, so a move never drops them.
+func makeSpecial(dst string, info os.FileInfo) error {
+	return fmt.Errorf("cannot copy special file %s", dst)
+}
+
+// inode reports no hard links where they cannot be detected.
+func inode(info os.FileInfo) ([2]uint64, bool) {
+	return [2]uint64{}, false
+}
@@ -0,0 +1,56 @@
+package home
+
+import (
+	"bytes"
+	"syscall"
+)
+
+// copyXattrs copies every extended attribute of src to dst. POSIX ACLs are
+// stored as system.posix_acl_* attributes, so they are copied too.
+func copyXattrs(src, dst string) error {
+	size, err := syscall.Listxattr(src, nil)
+	if err == syscall.ENOTSUP || size == 0 {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	names := make([]byte, size)
+	size, err = syscall.Listxattr(src, names)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range bytes.Split(names[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+
+		value, err := getxattr(src, string(name))
+		if err != nil {
+			return err
+		}
+
+		if err := syscall.Setxattr(dst, string(name), value, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getxattr returns the value of a single attribute.
+func getxattr(path, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	value := make([]byte, size)
+	size, err = syscall.Getxattr(path, name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value[:size], nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package home
+
+// copyXattrs is a no-op where extended attributes are not supported.
+func copyXattrs(src, dst string) error {
+	return nil
+}
@@ -0,0 +1,97 @@
+package wonka
+
+import (
+	"github.com/mikemackintosh/wonka/src/alloc"
+	"github.com/mikemackintosh/wonka/src/subid"
+)
+
+// uidAllocator returns an allocator over the policy UID range with every
+// UID in passwd and every subordinate UID range marked as used.
+func (i *Instance) uidAllocator(system bool) *alloc.Allocator {
+	a := alloc.UIDs(i.Policy, system, *i.Passwd)
+	reserveSubids(a, i.Subuid)
+
+	return a
+}
+
+// gidAllocator returns an allocator over the policy GID range with every
+// GID in group and every subordinate GID range marked as used.
+func (i *Instance) gidAllocator(system bool) *alloc.Allocator {
+	a := alloc.GIDs(i.Policy, system, *i.Groups)
+	reserveSubids(a, i.Subgid)
+
+	return a
+}
+
+// reserveSubids marks subordinate ranges as used, so an account never gets
+// an ID that is already mapped into someone's user namespace.
+func reserveSubids(a *alloc.Allocator, e *subid.Entries) {
+	if e == nil {
+		return
+	}
+
+	for _, r := range *e {
+		a.ReserveRange(r.Start, r.Count)
+	}
+}
+
+// allocateSubids delegates subordinate UID and GID ranges to a new account,
+// for each file that exists, as useradd does.
+func (i *Instance) allocateSubids(name string) error {
+	if i.Subuid != nil && i.Policy.SubUIDCount > 0 {
+		if _, err := i.Subuid.Allocate(name, i.Policy.SubUIDMin, i.Policy.SubUIDMax, i.Policy.SubUIDCount); err != nil {
+			return err
+		}
+	}
+
+	if i.Subgid != nil && i.Policy.SubGIDCount > 0 {
+		if _, err := i.Subgid.Allocate(name, i.Policy.SubGIDMin, i.Policy.SubGIDMax, i.Policy.SubGIDCount); err != nil {
+			i.releaseSubids(name, -1)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseSubids removes every subordinate range delegated to name, or to
+// uid written as a number. A negative uid only matches by name.
+func (i *Instance) releaseSubids(name string, uid int) {
+	if i.Subuid != nil {
+		i.Subuid.Release(name, uid)
+	}
+
+	if i.Subgid != nil {
+		i.Subgid.Release(name, uid)
+	}
+}
+
+// NextUID returns the next free UID from UID_MIN..UID_MAX, or from
+// SYS_UID_MIN..SYS_UID_MAX counting down for system accounts.
+func (i *Instance) NextUID(system bool) (int, error) {
+	if i.Passwd == nil || i.Groups == nil {
+		return -1, errNotLoaded
+	}
+
+	return i.uidAllocator(system).Next()
+}
+
+// NextGID returns the next free GID from GID_MIN..GID_MAX, or from
+// SYS_GID_MIN..SYS_GID_MAX counting down for system groups.
+func (i *Instance) NextGID(system bool) (int, error) {
+	if i.Passwd == nil || i.Groups == nil {
+		return -1, errNotLoaded
+	}
+
+	return i.gidAllocator(system).Next()
+}
+
+// NextUIDGID returns an ID that is free both as a UID and a GID, so a user
+// and its private group can share the same number.
+func (i *Instance) NextUIDGID(system bool) (int, error) {
+	if i.Passwd == nil || i.Groups == nil {
+		return -1, errNotLoaded
+	}
+
+	return alloc.NextPair(i.uidAllocator(system), i.gidAllocator(system))
+}
@@ -0,0 +1,232 @@
+package wonka
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mikemackintosh/wonka/src/ignition"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/shadow"
+	"github.com/mikemackintosh/wonka/src/sshkeys"
+)
+
+// ApplyIgnition applies the passwd section of an Ignition config the way
+// Ignition does on first boot. Groups are created unless they exist, then
+// users are created with useradd semantics, or updated with usermod
+// semantics for the fields they set. Entries with shouldExist false are
+// removed. Password hashes are set as is and ssh keys are added to
+// authorized_keys. Nothing is written until Save is called.
+func (i *Instance) ApplyIgnition(c *ignition.Config) ([]Change, error) {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return nil, errNotLoaded
+	}
+
+	var changes []Change
+	for _, g := range c.Passwd.Groups {
+		applied, err := i.ignitionGroup(g)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, applied...)
+	}
+
+	for _, u := range c.Passwd.Users {
+		applied, err := i.ignitionUser(u)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, applied...)
+	}
+
+	return changes, nil
+}
+
+// ignitionGroup creates or removes a group of passwd.groups.
+func (i *Instance) ignitionGroup(g ignition.Group) ([]Change, error) {
+	if err := ValidName(g.Name); err != nil {
+		return nil, err
+	}
+
+	exists := i.Groups.GetGroup(g.Name) != nil
+	if !g.Exists() {
+		if !exists {
+			return nil, nil
+		}
+
+		if err := i.DeleteGroup(g.Name); err != nil {
+			return nil, err
+		}
+
+		return []Change{{i.Options.fileGroups, fmt.Sprintf("removed group %s", g.Name)}}, nil
+	}
+
+	if exists {
+		return nil, nil
+	}
+
+	group, err := i.AddGroup(Group{Name: g.Name, GID: g.GID, System: g.System})
+	if err != nil {
+		return nil, err
+	}
+
+	// Like groupadd -p, the hash goes to gshadow when there is one.
+	if g.PasswordHash != nil {
+		if entry := i.gshadowEntry(g.Name); entry != nil {
+			entry.Password = *g.PasswordHash
+		} else {
+			group.Password = *g.PasswordHash
+		}
+	}
+
+	return []Change{{i.Options.fileGroups, fmt.Sprintf("created group %s with gid %d", g.Name, group.GID)}}, nil
+}
+
+// ignitionUser creates, updates or removes a user of passwd.users, then
+// sets its password hash and adds its ssh keys.
+func (i *Instance) ignitionUser(u ignition.User) ([]Change, error) {
+	if err := ValidName(u.Name); err != nil {
+		return nil, err
+	}
+
+	entry := i.Passwd.GetUser(u.Name)
+	if !u.Exists() {
+		if entry == nil {
+			return nil, nil
+		}
+
+		if err := i.DeleteUser(u.Name, DeleteOptions{}); err != nil {
+			return nil, err
+		}
+
+		return []Change{{i.Options.filePasswd, fmt.Sprintf("removed user %s", u.Name)}}, nil
+	}
+
+	for _, name := range append([]string{u.PrimaryGroup}, u.Groups...) {
+		if len(name) > 0 && i.Groups.GetGroup(name) == nil {
+			return nil, &ErrNotFound{fmt.Sprintf("group %s of user %s does not exist", name, u.Name)}
+		}
+	}
+
+	var changes []Change
+	if entry == nil {
+		created, err := i.ignitionCreate(u)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, created...)
+	} else {
+		updated, err := i.ignitionUpdate(u, entry)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, updated...)
+	}
+	entry = i.Passwd.GetUser(u.Name)
+
+	if u.PasswordHash != nil {
+		shd := i.Shadow.GetUserEntry(u.Name)
+		if shd == nil {
+			shd = shadow.NewEntry(u.Name, i.Policy)
+			i.Shadow.NewEntry(shd)
+		}
+
+		if shd.Password != *u.PasswordHash {
+			shd.Password = *u.PasswordHash
+			shd.LastPasswordChange = shadow.Today()
+			changes = append(changes, Change{i.Options.fileShadow, fmt.Sprintf("set the password of %s", u.Name)})
+		}
+	}
+
+	if len(u.SSHAuthorizedKeys) > 0 {
+		if len(entry.HomeDir) == 0 {
+			return nil, fmt.Errorf("user %s has ssh keys but no home directory", u.Name)
+		}
+
+		i.addAuthorizedKeys(*entry, u.SSHAuthorizedKeys)
+		changes = append(changes, Change{filepath.Join(entry.HomeDir, sshkeys.FILE_AUTHORIZED_KEYS), fmt.Sprintf("added %d ssh keys", len(u.SSHAuthorizedKeys))})
+	}
+
+	return changes, nil
+}
+
+// ignitionCreate adds a user like Ignition runs useradd, which always
+// creates the home directory unless noCreateHome is set.
+func (i *Instance) ignitionCreate(u ignition.User) ([]Change, error) {
+	createHome := !u.NoCreateHome
+	user := User{
+		Name:       u.Name,
+		UID:        u.UID,
+		Group:      u.PrimaryGroup,
+		Info:       u.Gecos,
+		HomeDir:    u.HomeDir,
+		Shell:      u.Shell,
+		System:     u.System,
+		CreateHome: &createHome,
+	}
+
+	if u.NoUserGroup {
+		userGroup := false
+		user.UserGroup = &userGroup
+	}
+
+	entry, err := i.AddUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{{i.Options.filePasswd, fmt.Sprintf("created user %s with uid %d", u.Name, entry.UID)}}
+	for _, name := range u.Groups {
+		if i.addMember(name, u.Name) {
+			changes = append(changes, Change{i.Options.fileGroups, fmt.Sprintf("added %s to group %s", u.Name, name)})
+		}
+	}
+
+	return changes, nil
+}
+
+// ignitionUpdate changes the fields an existing user sets, like Ignition
+// runs usermod. A new UID also chowns the files in the home directory.
+func (i *Instance) ignitionUpdate(u ignition.User, entry *passwd.Entry) ([]Change, error) {
+	var changes []Change
+	change := func(field, old, new string) {
+		changes = append(changes, Change{i.Options.filePasswd, fmt.Sprintf("changed %s of %s from %s to %s", field, u.Name, none(old), new)})
+	}
+
+	if u.UID != nil && *u.UID != entry.UID {
+		renumbered, err := i.RenumberUser(u.Name, *u.UID, RenumberOptions{})
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, renumbered...)
+	}
+
+	if len(u.PrimaryGroup) > 0 {
+		if gid := i.Groups.GetGroup(u.PrimaryGroup).GID; gid != entry.GID {
+			change("group", i.groupName(entry.GID), u.PrimaryGroup)
+			entry.GID = gid
+		}
+	}
+
+	if len(u.Gecos) > 0 && u.Gecos != entry.Info {
+		change("info", entry.Info, u.Gecos)
+		entry.Info = u.Gecos
+	}
+
+	if len(u.HomeDir) > 0 && u.HomeDir != entry.HomeDir {
+		change("home", entry.HomeDir, u.HomeDir)
+		entry.HomeDir = u.HomeDir
+	}
+
+	if len(u.Shell) > 0 && u.Shell != entry.Shell {
+		change("shell", entry.Shell, u.Shell)
+		entry.Shell = u.Shell
+	}
+
+	if u.Groups != nil {
+		if field, ok := i.ensureMemberships(u.Name, u.Groups); ok {
+			changes = append(changes, Change{i.Options.fileGroups, fmt.Sprintf("changed groups of %s from %s to %s", u.Name, field.Old, field.New)})
+		}
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,149 @@
+package ignition
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Config is the part of an Ignition config this package reads:
+//
+//	{
+//	  "ignition": {"version": "3.4.0"},
+//	  "passwd": {
+//	    "groups": [{"name": "developers", "gid": 2000}],
+//	    "users": [{"name": "core", "groups": ["developers"], "sshAuthorizedKeys": ["ssh-ed25519 AAAA..."]}]
+//	  }
+//	}
+//
+// Other sections, like storage and systemd, are ignored.
+type Config struct {
+	Ignition Ignition `json:"ignition"`
+	Passwd   Passwd   `json:"passwd"`
+}
+
+// Ignition holds the version of the config.
+type Ignition struct {
+	Version string `json:"version"`
+}
+
+// Passwd is the passwd section.
+type Passwd struct {
+	Groups []Group `json:"groups,omitempty"`
+	Users  []User  `json:"users,omitempty"`
+}
+
+// User is an entry of passwd.users. Unset fields are left alone on
+// existing users.
+type User struct {
+	Name string `json:"name"`
+	// PasswordHash is a crypt(3) hash. An empty hash allows logging in
+	// without a password.
+	PasswordHash      *string  `json:"passwordHash,omitempty"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+	UID               *int     `json:"uid,omitempty"`
+	Gecos             string   `json:"gecos,omitempty"`
+	HomeDir           string   `json:"homeDir,omitempty"`
+	NoCreateHome      bool     `json:"noCreateHome,omitempty"`
+	PrimaryGroup      string   `json:"primaryGroup,omitempty"`
+	// Groups are the supplementary groups. When set, they replace the
+	// groups of an existing user.
+	Groups      []string `json:"groups,omitempty"`
+	NoUserGroup bool     `json:"noUserGroup,omitempty"`
+	// NoLogInit is accepted but has no effect, as new users are never
+	// added to lastlog or faillog.
+	NoLogInit bool   `json:"noLogInit,omitempty"`
+	Shell     string `json:"shell,omitempty"`
+	System    bool   `json:"system,omitempty"`
+	// ShouldExist removes the user when false.
+	ShouldExist *bool `json:"shouldExist,omitempty"`
+}
+
+// Group is an entry of passwd.groups. Existing groups are left alone.
+type Group struct {
+	Name         string  `json:"name"`
+	GID          *int    `json:"gid,omitempty"`
+	PasswordHash *string `json:"passwordHash,omitempty"`
+	System       bool    `json:"system,omitempty"`
+	// ShouldExist removes the group when false.
+	ShouldExist *bool `json:"shouldExist,omitempty"`
+}
+
+// Exists returns false if the user is to be removed.
+func (u *User) Exists() bool {
+	return u.ShouldExist == nil || *u.ShouldExist
+}
+
+// Exists returns false if the group is to be removed.
+func (g *Group) Exists() bool {
+	return g.ShouldExist == nil || *g.ShouldExist
+}
+
+// Unmarshal will unmarshal an Ignition config into a Config. Only spec 3
+// configs are accepted, since spec 2 describes users differently.
+func Unmarshal(data []byte, dest interface{}) error {
+	c, ok := dest.(*Config)
+	if !ok {
+		return errors.New("must unmarshal to pointer of ignition.Config")
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return err
+	}
+
+	return c.Validate()
+}
+
+// Validate checks the version and that every user and group is named once.
+func (c *Config) Validate() error {
+	if len(c.Ignition.Version) == 0 {
+		return errors.New("missing ignition.version")
+	}
+
+	if !strings.HasPrefix(c.Ignition.Version, "3.") {
+		return fmt.Errorf("unsupported ignition version %s, only 3.x is supported", c.Ignition.Version)
+	}
+
+	seen := map[string]bool{}
+	for n, g := range c.Passwd.Groups {
+		if len(g.Name) == 0 {
+			return fmt.Errorf("passwd.groups.%d has no name", n)
+		}
+
+		if seen["g:"+g.Name] {
+			return fmt.Errorf("group %s is listed twice", g.Name)
+		}
+		seen["g:"+g.Name] = true
+	}
+
+	for n, u := range c.Passwd.Users {
+		if len(u.Name) == 0 {
+			return fmt.Errorf("passwd.users.%d has no name", n)
+		}
+
+		if seen["u:"+u.Name] {
+			return fmt.Errorf("user %s is listed twice", u.Name)
+		}
+		seen["u:"+u.Name] = true
+	}
+
+	return nil
+}
+
+// LoadFromFile will read an Ignition config and return the parsed Config
+// or error.
+func LoadFromFile(file string) (*Config, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{}
+	if err := Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,43 @@
+package ignition
+
+import "testing"
+
+func TestUnmarshal(t *testing.T) {
+	var tests = []struct {
+		data  string
+		users int
+		fails bool
+	}{
+		{`{"ignition": {"version": "3.4.0"}, "storage": {"files": []}, "passwd": {"users": [{"name": "core", "passwordHash": "$6$x", "shouldExist": false}]}}`, 1, false},
+		{`{"ignition": {"version": "3.0.0"}}`, 0, false},
+		{`{"ignition": {"version": "2.3.0"}, "passwd": {"users": [{"name": "core"}]}}`, 0, true},
+		{`{"passwd": {"users": [{"name": "core"}]}}`, 0, true},
+		{`{"ignition": {"version": "3.4.0"}, "passwd": {"users": [{"name": "core"}, {"name": "core"}]}}`, 0, true},
+		{`{"ignition": {"version": "3.4.0"}, "passwd": {"groups": [{"gid": 5}]}}`, 0, true},
+		{`{"ignition": `, 0, true},
+	}
+
+	for testNum, test := range tests {
+		c := &Config{}
+		err := Unmarshal([]byte(test.data), c)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%d) expected an error", testNum)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%d) unexpected error %s", testNum, err)
+			continue
+		}
+
+		if len(c.Passwd.Users) != test.users {
+			t.Errorf("%d) expected %d users, got %d", testNum, test.users, len(c.Passwd.Users))
+		}
+	}
+
+	c := &Config{}
+	Unmarshal([]byte(tests[0].data), c)
+	if u := c.Passwd.Users[0]; u.Exists() || *u.PasswordHash != "$6$x" {
+		t.Errorf("unexpected user %#v", u)
+	}
+}
@@ -0,0 +1,233 @@
+package wonka
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mikemackintosh/wonka/src/importer"
+	"github.com/mikemackintosh/wonka/src/passwd"
+)
+
+// ImportUsers creates the users of imported records. Every record is
+// checked against the databases and the other records first, and if any
+// is invalid, nothing is changed and every problem is returned as
+// importer.Errors. Users get their primary group from the record, or the
+// defaults, and are added to the listed groups, which must exist. If
+// creating a user still fails, like when the IDs run out, the users
+// already created are dropped again. Nothing is written until Save is
+// called.
+func (i *Instance) ImportUsers(records importer.Records) ([]Change, error) {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return nil, errNotLoaded
+	}
+
+	if errs := i.CheckImport(records, nil); len(errs) > 0 {
+		return nil, errs
+	}
+
+	// Create the users with a UID first, so none of them is taken by a
+	// user whose UID is allocated.
+	var ordered importer.Records
+	for _, r := range records {
+		if r.UID != nil {
+			ordered = append(ordered, r)
+		}
+	}
+	for _, r := range records {
+		if r.UID == nil {
+			ordered = append(ordered, r)
+		}
+	}
+
+	restore := i.snapshot()
+
+	var changes []Change
+	for _, r := range ordered {
+		entry, err := i.AddUser(User{
+			Name:    r.Name,
+			UID:     r.UID,
+			Group:   r.Group,
+			Info:    r.Info,
+			HomeDir: r.Home,
+			Shell:   r.Shell,
+		})
+		if err != nil {
+			restore()
+			return nil, importer.NewRowError(r.Row, "", err.Error())
+		}
+		changes = append(changes, Change{i.Options.filePasswd, fmt.Sprintf("created user %s with uid %d", r.Name, entry.UID)})
+
+		shd := i.Shadow.GetUserEntry(r.Name)
+		if len(r.Password) > 0 {
+			shd.Password = r.Password
+		}
+
+		if !r.Expires.IsUnset() {
+			shd.AccountExpiration = r.Expires
+		}
+
+		for _, name := range r.Groups {
+			if i.addMember(name, r.Name) {
+				changes = append(changes, Change{i.Options.fileGroups, fmt.Sprintf("added %s to group %s", r.Name, name)})
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// CheckImport returns the problems ImportUsers would refuse the records
+// for, merged by row with errs, the errors from reading them. A field
+// which already failed to read is not checked again.
+func (i *Instance) CheckImport(records importer.Records, errs importer.Errors) importer.Errors {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return append(errs, importer.NewRowError(0, "", errNotLoaded.Error()))
+	}
+
+	failed := map[string]bool{}
+	for _, err := range errs {
+		failed[fmt.Sprintf("%d:%s", err.Row, err.Field)] = true
+	}
+
+	merged := append(importer.Errors{}, errs...)
+	for _, err := range i.checkImport(records) {
+		if !failed[fmt.Sprintf("%d:%s", err.Row, err.Field)] {
+			merged = append(merged, err)
+		}
+	}
+
+	sort.SliceStable(merged, func(a, b int) bool {
+		return merged[a].Row < merged[b].Row
+	})
+
+	return merged
+}
+
+// checkImport returns the problems of every record: invalid or taken
+// names, taken or repeated UIDs, missing groups, existing groups in the
+// way of a user-private group, unknown shells and homes already in use.
+func (i *Instance) checkImport(records importer.Records) importer.Errors {
+	var errs importer.Errors
+	fail := func(r *importer.Record, field, format string, args ...interface{}) {
+		errs = append(errs, importer.NewRowError(r.Row, field, fmt.Sprintf(format, args...)))
+	}
+
+	shells, err := i.loadShells()
+	if err != nil {
+		return importer.Errors{importer.NewRowError(0, "", err.Error())}
+	}
+
+	names := map[string]int{}
+	uids := map[int]int{}
+	homes := map[string]int{}
+	for _, r := range records {
+		named := false
+		if err := ValidName(r.Name); err != nil {
+			fail(r, "name", "%s", err)
+		} else if i.Passwd.GetUser(r.Name) != nil {
+			fail(r, "name", "user %s already exists", r.Name)
+		} else if row, ok := names[r.Name]; ok {
+			fail(r, "name", "user %s is also on row %d", r.Name, row)
+		} else {
+			names[r.Name] = r.Row
+			named = true
+		}
+
+		if i.userGroup(User{Group: r.Group}) && i.Groups.GetGroup(r.Name) != nil {
+			fail(r, "group", "group %s already exists, set the primary group instead", r.Name)
+		}
+
+		if r.UID != nil {
+			if owner := i.Passwd.GetUserByID(*r.UID); owner != nil {
+				fail(r, "uid", "uid %d is used by %s", *r.UID, owner.Username)
+			} else if row, ok := uids[*r.UID]; ok {
+				fail(r, "uid", "uid %d is also on row %d", *r.UID, row)
+			} else {
+				uids[*r.UID] = r.Row
+			}
+		}
+
+		if len(r.Group) > 0 && i.Groups.GetGroup(r.Group) == nil {
+			if gid, err := strconv.Atoi(r.Group); err != nil || i.Groups.GetGroupByID(gid) == nil {
+				fail(r, "group", "group %s does not exist", r.Group)
+			}
+		}
+
+		for _, name := range r.Groups {
+			if i.Groups.GetGroup(name) == nil {
+				fail(r, "groups", "group %s does not exist", name)
+			}
+		}
+
+		if len(r.Shell) > 0 && shells != nil && !shells[r.Shell] {
+			fail(r, "shell", "shell %s is not listed in %s", r.Shell, defaultFileShells)
+		}
+
+		dir := r.Home
+		if len(dir) == 0 && len(i.Defaults.Home) > 0 {
+			dir = filepath.Join(i.Defaults.Home, r.Name)
+		}
+
+		// A default home of a repeated name is already reported.
+		if len(dir) == 0 || (len(r.Home) == 0 && !named) {
+			continue
+		}
+
+		if owner := i.homeOwner(dir); owner != nil {
+			fail(r, "home", "home %s is used by %s", dir, owner.Username)
+		} else if row, ok := homes[dir]; ok {
+			fail(r, "home", "home %s is also on row %d", dir, row)
+		} else if _, err := os.Lstat(i.path(dir)); err == nil && i.createHome(User{}) {
+			fail(r, "home", "home directory %s already exists", dir)
+		} else {
+			homes[dir] = r.Row
+		}
+	}
+
+	return errs
+}
+
+// homeOwner returns the user whose home is dir, or nil.
+func (i *Instance) homeOwner(dir string) *passwd.Entry {
+	for n, entry := range *i.Passwd {
+		if filepath.Clean(entry.HomeDir) == filepath.Clean(dir) {
+			return &(*i.Passwd)[n]
+		}
+	}
+
+	return nil
+}
+
+// loadShells reads the valid login shells from /etc/shells below the
+// root. The nologin and false shells are always valid, and without the
+// file, every shell is. It returns nil when there is no file.
+func (i *Instance) loadShells() (map[string]bool, error) {
+	b, err := ioutil.ReadFile(i.path(defaultFileShells))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	shells := map[string]bool{}
+	for _, shell := range []string{"/usr/sbin/nologin", "/sbin/nologin", "/bin/false", "/usr/bin/false"} {
+		shells[shell] = true
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) > 0 && !strings.HasPrefix(line, "#") {
+			shells[line] = true
+		}
+	}
+
+	return shells, scanner.Err()
+}
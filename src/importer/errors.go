@@ -0,0 +1,43 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RowError is used when a row of an import is invalid. Row counts like a
+// spreadsheet for CSV, where the header is row 1, and from 1 for JSON.
+type RowError struct {
+	Row   int
+	Field string
+	err   string
+}
+
+// NewRowError returns the error of a field of a row. field may be empty for
+// errors about the whole row.
+func NewRowError(row int, field, err string) *RowError {
+	return &RowError{row, field, err}
+}
+
+// Error takes an error and returns a string. Satisfies the interface.
+func (e *RowError) Error() string {
+	if len(e.Field) == 0 {
+		return fmt.Sprintf("row %d: %s", e.Row, e.err)
+	}
+
+	return fmt.Sprintf("row %d: %s: %s", e.Row, e.Field, e.err)
+}
+
+// Errors holds every invalid row of an import, so they can all be fixed at
+// once.
+type Errors []*RowError
+
+// Error takes an error and returns a string. Satisfies the interface.
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for n, err := range e {
+		lines[n] = err.Error()
+	}
+
+	return strings.Join(lines, "\n")
+}
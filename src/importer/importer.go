@@ -0,0 +1,332 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/shadow"
+)
+
+// Keys of a mapping file, one per field a record can set.
+const (
+	FieldName     = "NAME"
+	FieldUID      = "UID"
+	FieldGroup    = "GROUP"
+	FieldGroups   = "GROUPS"
+	FieldInfo     = "INFO"
+	FieldHome     = "HOME"
+	FieldShell    = "SHELL"
+	FieldPassword = "PASSWORD"
+	FieldExpires  = "EXPIRES"
+)
+
+// Fields lists every field, in the order records are checked.
+var Fields = []string{FieldName, FieldUID, FieldGroup, FieldGroups, FieldInfo, FieldHome, FieldShell, FieldPassword, FieldExpires}
+
+// defaultDateFormat is the layout of expiration dates unless the mapping
+// sets DATE_FORMAT.
+const defaultDateFormat = "2006-01-02"
+
+// Mapping maps the columns of a CSV file, or the keys of JSON objects, to
+// the fields of a record. It is read from a file of KEY=VALUE lines:
+//
+//	NAME=Login
+//	INFO=Full Name
+//	GROUPS=Teams
+//	EXPIRES=End Date
+//	DATE_FORMAT=01/02/2006
+//
+// Columns which are not mapped are ignored.
+type Mapping struct {
+	// Columns maps each field to its column name.
+	Columns map[string]string
+	// DateFormat is the Go time layout of EXPIRES.
+	DateFormat string
+
+	Errors []error
+}
+
+// Record is a user read from a row. It is only checked on its own, so the
+// name, IDs and groups still have to be checked against the databases.
+type Record struct {
+	Row      int
+	Name     string
+	UID      *int
+	Group    string
+	Groups   []string
+	Info     string
+	Home     string
+	Shell    string
+	Password string
+	Expires  shadow.Date
+}
+
+// Records are the users read from an import file.
+type Records []*Record
+
+// DefaultMapping returns the mapping used without a mapping file, where
+// columns are named after the fields in lower case, like "name" and
+// "groups".
+func DefaultMapping() *Mapping {
+	m := &Mapping{Columns: map[string]string{}, DateFormat: defaultDateFormat}
+	for _, field := range Fields {
+		m.Columns[field] = strings.ToLower(field)
+	}
+
+	return m
+}
+
+// Unmarshal will unmarshal a mapping file. Keys missing from the file keep
+// the value already in dest.
+func Unmarshal(data []byte, dest interface{}) error {
+	switch dest.(type) {
+	case *Mapping:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of importer.Mapping")
+	}
+
+	m := dest.(*Mapping)
+	for _, line := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") || len(line) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			m.Errors = append(m.Errors, fmt.Errorf("invalid line %q", line))
+			continue
+		}
+
+		if err := m.Set(strings.TrimSpace(parts[0]), strings.Trim(strings.TrimSpace(parts[1]), `"`)); err != nil {
+			m.Errors = append(m.Errors, err)
+		}
+	}
+
+	return nil
+}
+
+// Set will set the column of a field, or the date format, by its file
+// key. An empty column unmaps the field.
+func (m *Mapping) Set(key, value string) error {
+	if key == "DATE_FORMAT" {
+		m.DateFormat = value
+		return nil
+	}
+
+	for _, field := range Fields {
+		if field != key {
+			continue
+		}
+
+		if len(value) == 0 {
+			delete(m.Columns, key)
+		} else {
+			m.Columns[key] = value
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown key %q", key)
+}
+
+// LoadFromFile will read a mapping file on top of the default mapping.
+func LoadFromFile(file string) (*Mapping, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m := DefaultMapping()
+	if err := Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// ReadCSV reads the records of a CSV file with a header line. Every row is
+// read, and the rows which are invalid are returned as Errors along with
+// the valid records.
+func (m *Mapping) ReadCSV(data []byte) (Records, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("missing the header line")
+	}
+
+	index := map[string]int{}
+	for n, column := range rows[0] {
+		index[strings.TrimSpace(column)] = n
+	}
+
+	if _, ok := index[m.Columns[FieldName]]; !ok {
+		return nil, fmt.Errorf("missing the %q column", m.Columns[FieldName])
+	}
+
+	var records Records
+	var errs Errors
+	for n, row := range rows[1:] {
+		// Skip the blank lines spreadsheets leave at the end.
+		if len(strings.TrimSpace(strings.Join(row, ""))) == 0 {
+			continue
+		}
+
+		record, rowErrs := m.parse(n+2, func(column string) string {
+			if k, ok := index[column]; ok && k < len(row) {
+				return strings.TrimSpace(row[k])
+			}
+
+			return ""
+		})
+		records, errs = append(records, record), append(errs, rowErrs...)
+	}
+
+	if len(errs) > 0 {
+		return records, errs
+	}
+
+	return records, nil
+}
+
+// ReadJSON reads the records of a JSON list of objects. Numbers are read
+// as written, and lists are read as comma separated values. Like ReadCSV,
+// invalid rows are returned as Errors along with the valid records.
+func (m *Mapping) ReadJSON(data []byte) (Records, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var rows []map[string]interface{}
+	if err := d.Decode(&rows); err != nil {
+		return nil, err
+	}
+
+	var records Records
+	var errs Errors
+	for n, row := range rows {
+		record, rowErrs := m.parse(n+1, func(column string) string {
+			return strings.TrimSpace(jsonValue(row[column]))
+		})
+		records, errs = append(records, record), append(errs, rowErrs...)
+	}
+
+	if len(errs) > 0 {
+		return records, errs
+	}
+
+	return records, nil
+}
+
+// parse reads the fields of a row through get, which returns the value of
+// a column.
+func (m *Mapping) parse(row int, get func(column string) string) (*Record, Errors) {
+	value := func(field string) string {
+		if column, ok := m.Columns[field]; ok {
+			return get(column)
+		}
+
+		return ""
+	}
+
+	var errs Errors
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, NewRowError(row, strings.ToLower(field), fmt.Sprintf(format, args...)))
+	}
+
+	r := &Record{
+		Row:   row,
+		Name:  value(FieldName),
+		Group: value(FieldGroup),
+		Info:  value(FieldInfo),
+		Home:  value(FieldHome),
+		Shell: value(FieldShell),
+	}
+
+	if len(r.Name) == 0 {
+		fail(FieldName, "is empty")
+	}
+
+	if v := value(FieldUID); len(v) > 0 {
+		uid, err := strconv.Atoi(v)
+		if err != nil || uid < 0 {
+			fail(FieldUID, "invalid uid %q", v)
+		} else {
+			r.UID = &uid
+		}
+	}
+
+	r.Groups = split(value(FieldGroups))
+
+	if strings.ContainsAny(r.Info, ":\n") {
+		fail(FieldInfo, "must not contain a colon or a newline")
+	}
+
+	for _, f := range []struct{ field, path string }{{FieldHome, r.Home}, {FieldShell, r.Shell}} {
+		if len(f.path) > 0 && !strings.HasPrefix(f.path, "/") {
+			fail(f.field, "%q is not an absolute path", f.path)
+		}
+	}
+
+	if r.Password = value(FieldPassword); len(r.Password) > 0 && !isHash(r.Password) {
+		fail(FieldPassword, "must be a crypt(3) hash, not a clear text password")
+	}
+
+	if v := value(FieldExpires); len(v) > 0 {
+		t, err := time.Parse(m.DateFormat, v)
+		if err != nil {
+			fail(FieldExpires, "invalid date %q, expected the format %s", v, m.DateFormat)
+		} else {
+			r.Expires = shadow.NewDate(t)
+		}
+	}
+
+	return r, errs
+}
+
+// isHash returns true if p is a crypt(3) hash, or a locked or disabled
+// password.
+func isHash(p string) bool {
+	p = strings.TrimPrefix(p, "!")
+	return len(p) == 0 || p == "*" || (strings.HasPrefix(p, "$") && strings.Count(p, "$") >= 3 && !strings.ContainsAny(p, ": \t"))
+}
+
+// split splits a list of groups on commas, semicolons and spaces.
+func split(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t'
+	})
+}
+
+// jsonValue returns a JSON value as a column value.
+func jsonValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		items := make([]string, len(v))
+		for n, item := range v {
+			items[n] = jsonValue(item)
+		}
+		return strings.Join(items, ",")
+	}
+
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,96 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMapping(t *testing.T) {
+	m := DefaultMapping()
+	if err := Unmarshal([]byte("# HR export\nNAME=Login\nINFO=\"Full Name\"\nHOME=\nDATE_FORMAT=01/02/2006\nBOGUS=x\nbroken\n"), m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Columns[FieldName] != "Login" || m.Columns[FieldInfo] != "Full Name" || m.DateFormat != "01/02/2006" {
+		t.Errorf("unexpected mapping %#v", m)
+	}
+
+	if _, ok := m.Columns[FieldHome]; ok {
+		t.Error("expected an empty column to unmap the field")
+	}
+
+	if len(m.Errors) != 2 {
+		t.Errorf("expected 2 errors, got %v", m.Errors)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	m := DefaultMapping()
+	m.Set(FieldName, "Login")
+	m.Set(FieldInfo, "Full Name")
+
+	data := `Login,Full Name,uid,groups,shell,password,expires,Manager
+alice,"Smith, Alice",1500,developers;wheel,/bin/bash,$6$salt$hash,2030-01-31,carol
+bob,Bob,abc,,bash,secret,31/01/2030,carol
+,Nobody,,,,,,
+carol,Carol: CTO,,,,,,
+
+`
+
+	records, err := m.ReadCSV([]byte(data))
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("expected row errors, got %v", err)
+	}
+
+	expected := []string{
+		`row 3: uid: invalid uid "abc"`,
+		`row 3: shell: "bash" is not an absolute path`,
+		`row 3: password: must be a crypt(3) hash, not a clear text password`,
+		`row 3: expires: invalid date "31/01/2030", expected the format 2006-01-02`,
+		`row 4: name: is empty`,
+		`row 5: info: must not contain a colon or a newline`,
+	}
+
+	if got := strings.Split(errs.Error(), "\n"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), errs)
+	}
+
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+
+	alice := records[0]
+	if alice.Row != 2 || alice.Name != "alice" || alice.Info != "Smith, Alice" || *alice.UID != 1500 || alice.Password != "$6$salt$hash" || alice.Expires.Time().Format("2006-01-02") != "2030-01-31" {
+		t.Errorf("unexpected record %#v", alice)
+	}
+
+	if !reflect.DeepEqual(alice.Groups, []string{"developers", "wheel"}) {
+		t.Errorf("unexpected groups %q", alice.Groups)
+	}
+
+	if _, err := m.ReadCSV([]byte("user,uid\nalice,1\n")); err == nil {
+		t.Error("expected a missing name column to fail")
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	m := DefaultMapping()
+	records, err := m.ReadJSON([]byte(`[
+  {"name": "alice", "uid": 1500, "groups": ["developers", "wheel"], "extra": true},
+  {"name": "bob", "uid": -1}
+]`))
+
+	if err == nil || err.Error() != `row 2: uid: invalid uid "-1"` {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if len(records) != 2 || *records[0].UID != 1500 || !reflect.DeepEqual(records[0].Groups, []string{"developers", "wheel"}) {
+		t.Errorf("unexpected records %#v", records)
+	}
+
+	if _, err := m.ReadJSON([]byte(`{"name": "alice"}`)); err == nil {
+		t.Error("expected an object instead of a list to fail")
+	}
+}
@@ -0,0 +1,177 @@
+package lastlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const FILE_LASTLOG = "/var/log/lastlog"
+
+// RecordSize is the size of a lastlog record on Linux.
+const RecordSize = 292
+
+// record is the on-disk layout of struct lastlog.
+type record struct {
+	Time int32
+	Line [32]byte
+	Host [256]byte
+}
+
+// Entry is the last login of a UID. lastlog is a sparse file with one
+// record per UID, at offset UID * RecordSize.
+type Entry struct {
+	UID  int
+	Time time.Time
+	Line string
+	Host string
+}
+
+type Entries []*Entry
+
+// Unmarshal will unmarshal a lastlog file. UIDs that never logged in are
+// left out.
+func Unmarshal(data []byte, dest interface{}) error {
+	switch dest.(type) {
+	case *Entries:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of lastlog.Entries")
+	}
+
+	e := dest.(*Entries)
+	for n := 0; n+RecordSize <= len(data); n += RecordSize {
+		entry, err := decode(data[n:n+RecordSize], n/RecordSize)
+		if err != nil {
+			return err
+		}
+
+		if entry != nil {
+			*e = append(*e, entry)
+		}
+	}
+
+	return nil
+}
+
+// Marshal is a helper for lastlog.Marshal().
+func (e Entries) Marshal() ([]byte, error) {
+	return Marshal(e)
+}
+
+// Marshal will encode entries in the lastlog format, each at the offset of
+// its UID. The gaps are zero rather than holes.
+func Marshal(in interface{}) ([]byte, error) {
+	var entries Entries
+	switch v := in.(type) {
+	case Entries:
+		entries = v
+	case *Entries:
+		entries = *v
+	default:
+		return nil, errors.New("must marshal lastlog.Entries")
+	}
+
+	var out []byte
+	for _, entry := range entries {
+		r := record{Time: int32(entry.Time.Unix())}
+		copy(r.Line[:], entry.Line)
+		copy(r.Host[:], entry.Host)
+
+		var buf bytes.Buffer
+		if err := binary.Write(&buf, binary.LittleEndian, &r); err != nil {
+			return nil, err
+		}
+
+		offset := entry.UID * RecordSize
+		if len(out) < offset+RecordSize {
+			out = append(out, make([]byte, offset+RecordSize-len(out))...)
+		}
+		copy(out[offset:], buf.Bytes())
+	}
+
+	return out, nil
+}
+
+// LoadFromFile will read every login recorded in a lastlog file. Since the
+// file is indexed by UID it can be huge and mostly holes, so Read is
+// cheaper for a few UIDs.
+func LoadFromFile(file string) (*Entries, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entries
+	if err := Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// Read returns the last login of uid from a lastlog file, or nil if it
+// never logged in. A negative uid has no record and returns nil.
+func Read(file string, uid int) (*Entry, error) {
+	if uid < 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := make([]byte, RecordSize)
+	if _, err := f.ReadAt(b, int64(uid)*RecordSize); err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return decode(b, uid)
+}
+
+// Get returns the entry of uid, or nil.
+func (e *Entries) Get(uid int) *Entry {
+	for _, entry := range *e {
+		if entry.UID == uid {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+// decode returns the entry in one record, or nil if the time is unset.
+func decode(b []byte, uid int) (*Entry, error) {
+	var r record
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &r); err != nil {
+		return nil, err
+	}
+
+	if r.Time == 0 {
+		return nil, nil
+	}
+
+	return &Entry{
+		UID:  uid,
+		Time: time.Unix(int64(r.Time), 0),
+		Line: cstring(r.Line[:]),
+		Host: cstring(r.Host[:]),
+	}, nil
+}
+
+// cstring returns the string up to the first NUL byte.
+func cstring(b []byte) string {
+	if n := bytes.IndexByte(b, 0); n >= 0 {
+		b = b[:n]
+	}
+
+	return string(b)
+}
@@ -0,0 +1,63 @@
+package lastlog
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var fixture = filepath.Join("..", "..", "testing", "fixtures", "var", "log", "lastlog")
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		Have int
+		Want *Entry
+	}{
+		{Have: 0, Want: &Entry{UID: 0, Time: time.Unix(1600000000, 0), Line: "pts/0", Host: "10.0.0.1"}},
+		{Have: 33, Want: &Entry{UID: 33, Time: time.Unix(1500000000, 0), Line: "tty1"}},
+		// Never logged in.
+		{Have: 1, Want: nil},
+		// Past the end of the file.
+		{Have: 65534, Want: nil},
+		// No record, rather than a negative offset.
+		{Have: -1, Want: nil},
+	}
+
+	for testNum, test := range tests {
+		entry, err := Read(fixture, test.Have)
+		if err != nil {
+			t.Fatalf("%d) %s", testNum, err)
+		}
+
+		if test.Want == nil {
+			if entry != nil {
+				t.Errorf("%d) expected no entry, got %#v", testNum, entry)
+			}
+			continue
+		}
+
+		if entry == nil || entry.UID != test.Want.UID || !entry.Time.Equal(test.Want.Time) || entry.Line != test.Want.Line || entry.Host != test.Want.Host {
+			t.Errorf("%d) expected %#v, got %#v", testNum, test.Want, entry)
+		}
+	}
+}
+
+func TestLoadFromFile(t *testing.T) {
+	e, err := LoadFromFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*e) != 2 || e.Get(33) == nil {
+		t.Fatalf("unexpected entries %#v", *e)
+	}
+
+	b, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) != 34*RecordSize {
+		t.Errorf("expected %d bytes, got %d", 34*RecordSize, len(b))
+	}
+}
@@ -0,0 +1,100 @@
+package wonka
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/lastlog"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/utmp"
+)
+
+// Login is the last login of an account. Time is zero if it never logged
+// in.
+type Login struct {
+	User string    `json:"user"`
+	UID  int       `json:"uid"`
+	Time time.Time `json:"time"`
+	Line string    `json:"line,omitempty"`
+	Host string    `json:"host,omitempty"`
+}
+
+// LastLogins returns the last login of every passwd entry, taking the
+// latest of lastlog and wtmp. Missing files count as no logins.
+func (i *Instance) LastLogins() ([]Login, error) {
+	if i.Passwd == nil {
+		return nil, errNotLoaded
+	}
+
+	wtmp, err := i.wtmp()
+	if err != nil {
+		return nil, err
+	}
+
+	var logins []Login
+	for _, entry := range *i.Passwd {
+		login, err := i.lastLogin(entry, wtmp)
+		if err != nil {
+			return nil, err
+		}
+		logins = append(logins, login)
+	}
+
+	return logins, nil
+}
+
+// LastLogin returns the last login of a user.
+func (i *Instance) LastLogin(name string) (*Login, error) {
+	if i.Passwd == nil {
+		return nil, errNotLoaded
+	}
+
+	entry := i.Passwd.GetUser(name)
+	if entry == nil {
+		return nil, &ErrNotFound{fmt.Sprintf("user %s does not exist", name)}
+	}
+
+	wtmp, err := i.wtmp()
+	if err != nil {
+		return nil, err
+	}
+
+	login, err := i.lastLogin(*entry, wtmp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &login, nil
+}
+
+// lastLogin looks up one entry. lastlog is read by offset rather than
+// loaded, since it is a sparse file as large as the highest UID.
+func (i *Instance) lastLogin(entry passwd.Entry, wtmp *utmp.Entries) (Login, error) {
+	login := Login{User: entry.Username, UID: entry.UID}
+
+	last, err := lastlog.Read(i.path(i.Options.fileLastlog), entry.UID)
+	if err != nil && !os.IsNotExist(err) {
+		return login, err
+	}
+
+	if last != nil {
+		login.Time, login.Line, login.Host = last.Time, last.Line, last.Host
+	}
+
+	if w := wtmp.LastLogin(entry.Username); w != nil && w.Time.After(login.Time) {
+		login.Time, login.Line, login.Host = w.Time, w.Line, w.Host
+	}
+
+	return login, nil
+}
+
+// wtmp reads the login history, which is empty if the file is missing.
+func (i *Instance) wtmp() (*utmp.Entries, error) {
+	entries, err := utmp.LoadFromFile(i.path(i.Options.fileWtmp))
+	if os.IsNotExist(err) {
+		return &utmp.Entries{}, nil
+	}
+
+	return entries, err
+}
@@ -31,6 +31,11 @@ func WriteWithLock(filename string, data []byte) error {
 		}
 	}()
 
+	// Truncate once locked, otherwise shorter data leaves the old tail behind.
+	if err = f.Truncate(0); err != nil {
+		return errors.New(fmt.Sprintf("Failed to truncate %s for writing.", filename))
+	}
+
 	_, err = f.Write(data)
 	if err != nil {
 		return errors.New(fmt.Sprintf("Failed to lock %s for reading.", filename))
@@ -0,0 +1,323 @@
+package logindefs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mikemackintosh/wonka/src/home"
+)
+
+const FILE_LOGIN_DEFS = "/etc/login.defs"
+
+// maxIncludeDepth stops include loops from recursing forever.
+const maxIncludeDepth = 8
+
+// Policy is the typed view of a login.defs file. Numeric values which are
+// not configured are -1.
+type Policy struct {
+	// UID and GID ranges used for regular and system accounts.
+	UIDMin    int
+	UIDMax    int
+	SysUIDMin int
+	SysUIDMax int
+	GIDMin    int
+	GIDMax    int
+	SysGIDMin int
+	SysGIDMax int
+
+	// Subordinate ID ranges handed out on account creation.
+	SubUIDMin   int
+	SubUIDMax   int
+	SubUIDCount int
+	SubGIDMin   int
+	SubGIDMax   int
+	SubGIDCount int
+
+	// Password aging defaults for new shadow entries.
+	PassMaxDays int
+	PassMinDays int
+	PassWarnAge int
+
+	// Password hashing.
+	EncryptMethod     string
+	SHACryptMinRounds int
+	SHACryptMaxRounds int
+
+	// Account creation behaviour.
+	Umask           os.FileMode
+	HomeMode        os.FileMode
+	UserGroupsEnab  bool
+	CreateHome      bool
+	MailDir         string
+	CreateMailSpool bool
+
+	// Values holds every key parsed, including the ones without a typed
+	// field above.
+	Values map[string]string
+	Errors []error
+}
+
+// Default returns a Policy with the values shadow-utils uses when a key is
+// missing from login.defs.
+func Default() *Policy {
+	return &Policy{
+		UIDMin:            1000,
+		UIDMax:            60000,
+		SysUIDMin:         101,
+		SysUIDMax:         999,
+		GIDMin:            1000,
+		GIDMax:            60000,
+		SysGIDMin:         101,
+		SysGIDMax:         999,
+		SubUIDMin:         100000,
+		SubUIDMax:         600100000,
+		SubUIDCount:       65536,
+		SubGIDMin:         100000,
+		SubGIDMax:         600100000,
+		SubGIDCount:       65536,
+		PassMaxDays:       -1,
+		PassMinDays:       -1,
+		PassWarnAge:       -1,
+		EncryptMethod:     "SHA512",
+		SHACryptMinRounds: -1,
+		SHACryptMaxRounds: -1,
+		Umask:             0022,
+		MailDir:           "/var/mail",
+		Values:            map[string]string{},
+	}
+}
+
+// Unmarshal will unmarshal a provided login.defs formatted file. Keys missing
+// from the file keep the value already in dest, so start from Default().
+// Include directives are ignored, use Load to resolve them.
+func Unmarshal(data []byte, dest interface{}) error {
+	switch dest.(type) {
+	case *Policy:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of logindefs.Policy")
+	}
+
+	policy := dest.(*Policy)
+	if policy.Values == nil {
+		policy.Values = map[string]string{}
+	}
+
+	parse(data, policy, nil)
+	policy.apply()
+
+	return nil
+}
+
+// LoadFromDisk will read /etc/login.defs and return the parsed Policy. A
+// missing file returns the defaults.
+func LoadFromDisk() (*Policy, error) {
+	return Load("/")
+}
+
+// Load will read etc/login.defs below root, following include directives,
+// and return the parsed Policy. A missing file returns the defaults, but a
+// missing include is an error.
+func Load(root string) (*Policy, error) {
+	policy := Default()
+
+	err := load(root, FILE_LOGIN_DEFS, policy, 0)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	policy.apply()
+	return policy, nil
+}
+
+// load reads a single file into the policy, recursing on includes.
+func load(root, file string, policy *Policy, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("too many nested includes at %s", file)
+	}
+
+	path, err := resolve(root, file)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var includeErr error
+	parse(b, policy, func(include string) {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(file), include)
+		}
+
+		// Only login.defs itself may be missing. A missing include is an
+		// error, so it is not reported like an absent file.
+		if err := load(root, include, policy, depth+1); err != nil && includeErr == nil {
+			includeErr = fmt.Errorf("%s: include %s: %s", file, include, err)
+		}
+	})
+
+	return includeErr
+}
+
+// resolve returns file below root, refusing a path which leaves root
+// through ".." or a symlink, including one in its last component.
+func resolve(root, file string) (string, error) {
+	path, err := home.Resolve(root, file)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		return path, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	base, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	if rel, err := filepath.Rel(base, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s resolves outside of %s", file, root)
+	}
+
+	return target, nil
+}
+
+// parse reads the key value pairs into policy.Values. Later keys override
+// earlier ones, which is how shadow-utils treats duplicates.
+func parse(data []byte, policy *Policy, include func(string)) {
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		line := strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") || len(line) == 0 {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			policy.Errors = append(policy.Errors, fmt.Errorf("missing value for %s", fields[0]))
+			continue
+		}
+
+		if strings.ToLower(fields[0]) == "include" {
+			if include != nil {
+				include(fields[1])
+			}
+			continue
+		}
+
+		// Values may be quoted.
+		policy.Values[fields[0]] = strings.Trim(fields[1], `"`)
+	}
+}
+
+// apply copies the raw values into the typed fields.
+func (p *Policy) apply() {
+	p.UIDMin = p.number("UID_MIN", p.UIDMin)
+	p.UIDMax = p.number("UID_MAX", p.UIDMax)
+	p.SysUIDMax = p.number("SYS_UID_MAX", p.UIDMin-1)
+	p.SysUIDMin = p.number("SYS_UID_MIN", p.SysUIDMin)
+	p.GIDMin = p.number("GID_MIN", p.GIDMin)
+	p.GIDMax = p.number("GID_MAX", p.GIDMax)
+	p.SysGIDMax = p.number("SYS_GID_MAX", p.GIDMin-1)
+	p.SysGIDMin = p.number("SYS_GID_MIN", p.SysGIDMin)
+
+	p.SubUIDMin = p.number("SUB_UID_MIN", p.SubUIDMin)
+	p.SubUIDMax = p.number("SUB_UID_MAX", p.SubUIDMax)
+	p.SubUIDCount = p.number("SUB_UID_COUNT", p.SubUIDCount)
+	p.SubGIDMin = p.number("SUB_GID_MIN", p.SubGIDMin)
+	p.SubGIDMax = p.number("SUB_GID_MAX", p.SubGIDMax)
+	p.SubGIDCount = p.number("SUB_GID_COUNT", p.SubGIDCount)
+
+	p.PassMaxDays = p.number("PASS_MAX_DAYS", p.PassMaxDays)
+	p.PassMinDays = p.number("PASS_MIN_DAYS", p.PassMinDays)
+	p.PassWarnAge = p.number("PASS_WARN_AGE", p.PassWarnAge)
+
+	// Methods which cannot be hashed here, like YESCRYPT or DES, fall back
+	// to SHA512 rather than failing every password change on save.
+	if v, ok := p.Values["ENCRYPT_METHOD"]; ok {
+		switch method := strings.ToUpper(v); method {
+		case "SHA512", "SHA256", "MD5":
+			p.EncryptMethod = method
+		default:
+			p.EncryptMethod = "SHA512"
+			p.Errors = append(p.Errors, fmt.Errorf("unsupported ENCRYPT_METHOD %s, using SHA512", v))
+		}
+	}
+	p.SHACryptMinRounds = p.number("SHA_CRYPT_MIN_ROUNDS", p.SHACryptMinRounds)
+	p.SHACryptMaxRounds = p.number("SHA_CRYPT_MAX_ROUNDS", p.SHACryptMaxRounds)
+
+	p.Umask = os.FileMode(p.number("UMASK", int(p.Umask))) & os.ModePerm
+	p.HomeMode = os.FileMode(p.number("HOME_MODE", int(p.HomeMode))) & os.ModePerm
+	p.UserGroupsEnab = p.boolean("USERGROUPS_ENAB", p.UserGroupsEnab)
+	p.CreateHome = p.boolean("CREATE_HOME", p.CreateHome)
+	p.CreateMailSpool = p.boolean("CREATE_MAIL_SPOOL", p.CreateMailSpool)
+
+	if v, ok := p.Values["MAIL_DIR"]; ok {
+		p.MailDir = v
+	}
+}
+
+// number returns the numeric value of key, or def if it is not set. Like
+// shadow-utils, a leading 0 is octal and 0x is hex.
+func (p *Policy) number(key string, def int) int {
+	v, ok := p.Values[key]
+	if !ok {
+		return def
+	}
+
+	n, err := strconv.ParseInt(v, 0, 64)
+	if err != nil {
+		p.Errors = append(p.Errors, fmt.Errorf("invalid number for %s: %q", key, v))
+		return def
+	}
+
+	return int(n)
+}
+
+// boolean returns true if key is set to yes, or def if it is not set.
+func (p *Policy) boolean(key string, def bool) bool {
+	v, ok := p.Values[key]
+	if !ok {
+		return def
+	}
+
+	return strings.ToLower(v) == "yes"
+}
+
+// Get returns the raw value of a key and whether it was set.
+func (p *Policy) Get(key string) (string, bool) {
+	v, ok := p.Values[key]
+	return v, ok
+}
+
+// HomeDirMode returns the mode new home directories are created with. This is
+// HOME_MODE if set, otherwise 0777 masked by UMASK.
+func (p *Policy) HomeDirMode() os.FileMode {
+	if p.HomeMode != 0 {
+		return p.HomeMode
+	}
+
+	return 0777 &^ p.Umask
+}
+
+// CryptRounds returns the SHA crypt rounds to use, or -1 for the library
+// default. When both bounds are set the minimum is used.
+func (p *Policy) CryptRounds() int {
+	if p.SHACryptMinRounds > 0 {
+		return p.SHACryptMinRounds
+	}
+
+	return p.SHACryptMaxRounds
+}
@@ -0,0 +1,184 @@
+package logindefs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+	data := []byte(`
+# Comment lines are ignored.
+UID_MIN			 2000
+UID_MAX			60000
+PASS_MAX_DAYS	90
+UMASK		027
+ENCRYPT_METHOD sha256
+USERGROUPS_ENAB yes
+CREATE_HOME     no
+MAIL_DIR        "/var/spool/mail"
+FAKE_KEY	value
+`)
+
+	policy := Default()
+	if err := Unmarshal(data, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.UIDMin != 2000 || policy.UIDMax != 60000 {
+		t.Errorf("unexpected uid range %d-%d", policy.UIDMin, policy.UIDMax)
+	}
+
+	if policy.SysUIDMax != 1999 {
+		t.Errorf("expected SYS_UID_MAX to follow UID_MIN, got %d", policy.SysUIDMax)
+	}
+
+	if policy.PassMaxDays != 90 || policy.PassMinDays != -1 {
+		t.Errorf("unexpected aging %d/%d", policy.PassMinDays, policy.PassMaxDays)
+	}
+
+	if policy.Umask != 0027 || policy.HomeDirMode() != 0750 {
+		t.Errorf("unexpected umask %o and home mode %o", policy.Umask, policy.HomeDirMode())
+	}
+
+	if policy.EncryptMethod != "SHA256" {
+		t.Errorf("unexpected encrypt method %s", policy.EncryptMethod)
+	}
+
+	if !policy.UserGroupsEnab || policy.CreateHome {
+		t.Error("unexpected booleans")
+	}
+
+	if policy.MailDir != "/var/spool/mail" {
+		t.Errorf("unexpected mail dir %s", policy.MailDir)
+	}
+
+	if v, ok := policy.Get("FAKE_KEY"); !ok || v != "value" {
+		t.Errorf("expected raw value, got %q", v)
+	}
+
+	if len(policy.Errors) > 0 {
+		t.Errorf("unexpected errors %v", policy.Errors)
+	}
+}
+
+func TestEncryptMethod(t *testing.T) {
+	tests := []struct {
+		Value  string
+		Want   string
+		Errors int
+	}{
+		{"md5", "MD5", 0},
+		{"SHA512", "SHA512", 0},
+		// Methods which cannot be hashed fall back with a warning.
+		{"YESCRYPT", "SHA512", 1},
+		{"DES", "SHA512", 1},
+	}
+
+	for testNum, test := range tests {
+		policy := Default()
+		if err := Unmarshal([]byte("ENCRYPT_METHOD "+test.Value+"\n"), policy); err != nil {
+			t.Fatal(err)
+		}
+
+		if policy.EncryptMethod != test.Want || len(policy.Errors) != test.Errors {
+			t.Errorf("%d) expected %s with %d errors, got %s with %v", testNum, test.Want, test.Errors, policy.EncryptMethod, policy.Errors)
+		}
+	}
+}
+
+func TestLoadInclude(t *testing.T) {
+	root, err := ioutil.TempDir("", "logindefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, "etc", "login.defs.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"etc/login.defs":              "UID_MIN 1000\ninclude login.defs.d/local.defs\nCREATE_HOME yes\n",
+		"etc/login.defs.d/local.defs": "UID_MIN 5000\nHOME_MODE 0700\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy, err := Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.UIDMin != 5000 || policy.HomeDirMode() != 0700 || !policy.CreateHome {
+		t.Errorf("include not applied: %#v", policy)
+	}
+}
+
+func TestLoadMissingInclude(t *testing.T) {
+	root, err := ioutil.TempDir("", "logindefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "etc", "login.defs"), []byte("UID_MIN 1000\ninclude missing.defs\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(root); err == nil || !strings.Contains(err.Error(), "/etc/missing.defs") {
+		t.Errorf("expected the missing include to be reported, got %v", err)
+	}
+}
+
+func TestLoadIncludeOutside(t *testing.T) {
+	parent, err := ioutil.TempDir("", "logindefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+
+	root := filepath.Join(parent, "root")
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file outside of the root, reached through ".." or a symlink.
+	if err := ioutil.WriteFile(filepath.Join(parent, "outside.defs"), []byte("UID_MIN 5000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(filepath.Join(parent, "outside.defs"), filepath.Join(root, "etc", "link.defs")); err != nil {
+		t.Fatal(err)
+	}
+
+	for testNum, include := range []string{"../../outside.defs", "/../outside.defs", "link.defs"} {
+		if err := ioutil.WriteFile(filepath.Join(root, "etc", "login.defs"), []byte("include "+include+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if policy, err := Load(root); err == nil {
+			t.Errorf("%d) expected %s to be refused, got UID_MIN %d", testNum, include, policy.UIDMin)
+		}
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	policy, err := Load("/nonexistent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.UIDMin != 1000 || policy.SysUIDMax != 999 {
+		t.Errorf("expected defaults, got %#v", policy)
+	}
+}
@@ -0,0 +1,12 @@
+package mail
+
+// ErrExists is used when a mail spool already exists and belongs to
+// another user.
+type ErrExists struct {
+	err string
+}
+
+// Error takes an error and returns a string. Satisfies the interface.
+func (e *ErrExists) Error() string {
+	return e.err
+}
@@ -0,0 +1,157 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/mikemackintosh/wonka/src/home"
+)
+
+// Mode is the mode of a spool owned by the mail group. Without a mail group
+// the spool is only readable by the user.
+const (
+	Mode        os.FileMode = 0660
+	PrivateMode os.FileMode = 0600
+)
+
+// DirMode is the mode of a missing MAIL_DIR created for spools of the mail
+// group, owned by root and that group. PrivateDirMode is used without a
+// mail group, so users can still make their lock files.
+const (
+	DirMode        os.FileMode = 0775 | os.ModeSetgid
+	PrivateDirMode os.FileMode = 0777 | os.ModeSticky
+)
+
+// Path returns the spool of username in dir below root, refusing paths which
+// resolve outside of root.
+func Path(root, dir, username string) (string, error) {
+	return home.Resolve(root, filepath.Join(dir, username))
+}
+
+// Create makes an empty mail spool for username in dir, normally MAIL_DIR,
+// owned by uid and gid with the provided mode, and returns whether it did.
+// An existing spool owned by uid is left alone, while one owned by anyone
+// else, or a symlink, is refused rather than handed to the new user. A
+// missing dir is made with DirMode for Mode spools, owned by root and gid,
+// or with PrivateDirMode otherwise.
+func Create(root, dir, username string, uid, gid int, mode os.FileMode) (bool, error) {
+	spool, err := Path(root, dir, username)
+	if err != nil {
+		return false, err
+	}
+
+	if err := mkdirSpool(filepath.Dir(spool), gid, mode); err != nil {
+		return false, err
+	}
+
+	f, err := os.OpenFile(spool, os.O_WRONLY|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, mode)
+	if os.IsExist(err) {
+		return false, checkOwner(spool, uid)
+	} else if err != nil {
+		return false, err
+	}
+
+	if err := f.Chown(uid, gid); err != nil {
+		f.Close()
+		os.Remove(spool)
+		return false, err
+	}
+
+	// Chmod after chown, and without the umask applied.
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(spool)
+		return false, err
+	}
+
+	return true, f.Close()
+}
+
+// mkdirSpool makes the spool directory if it is missing. Spools shared with
+// the mail group get a directory of that group, private ones a sticky
+// directory owned by root.
+func mkdirSpool(dir string, gid int, mode os.FileMode) error {
+	if _, err := os.Lstat(dir); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+
+	dirMode, dirGID := PrivateDirMode, 0
+	if mode == Mode {
+		dirMode, dirGID = DirMode, gid
+	}
+
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return err
+	}
+
+	if err := os.Lchown(dir, 0, dirGID); err != nil {
+		return err
+	}
+
+	// Chmod after chown, which clears the setgid bit, and without the umask.
+	return os.Chmod(dir, dirMode)
+}
+
+// checkOwner returns an error unless the existing spool is a file owned by
+// uid.
+func checkOwner(spool string, uid int) error {
+	info, err := os.Lstat(spool)
+	if err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return &ErrExists{fmt.Sprintf("mail spool %s exists and is not a regular file", spool)}
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != uid {
+		return &ErrExists{fmt.Sprintf("mail spool %s exists and belongs to uid %d", spool, stat.Uid)}
+	}
+
+	return nil
+}
+
+// Remove deletes the mail spool of username. A missing spool is not an
+// error.
+func Remove(root, dir, username string) error {
+	spool, err := Path(root, dir, username)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(spool); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Rename moves the mail spool of old to new. A missing spool is not an
+// error, but an existing spool for new is never overwritten.
+func Rename(root, dir, old, new string) error {
+	src, err := Path(root, dir, old)
+	if err != nil {
+		return err
+	}
+
+	dst, err := Path(root, dir, new)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(src); os.IsNotExist(err) {
+		return nil
+	}
+
+	if _, err := os.Lstat(dst); err == nil {
+		return &os.PathError{Op: "rename", Path: dst, Err: os.ErrExist}
+	}
+
+	return os.Rename(src, dst)
+}
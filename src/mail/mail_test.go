@@ -0,0 +1,104 @@
+package mail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	root, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if created, err := Create(root, "/var/mail", "alice", 1000, 8, Mode); err != nil || !created {
+		t.Fatalf("expected the spool to be created, got %v", err)
+	}
+
+	if created, err := Create(root, "/var/mail", "alice", 1000, 8, Mode); err != nil || created {
+		t.Errorf("expected the spool of the same user to be kept, got %t %v", created, err)
+	}
+
+	if _, err := Create(root, "/var/mail", "alice", 1001, 8, Mode); err == nil {
+		t.Error("expected the spool of another uid to be refused")
+	}
+
+	info, err := os.Lstat(filepath.Join(root, "var", "mail"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode() != os.ModeDir|DirMode {
+		t.Errorf("expected the spool directory to be %s, got %s", DirMode, info.Mode())
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && (stat.Uid != 0 || stat.Gid != 8) {
+		t.Errorf("expected the spool directory to be owned by 0:8, got %d:%d", stat.Uid, stat.Gid)
+	}
+
+	if _, err := Create(root, "/var/spool/mail", "bob", 1001, 1001, PrivateMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Lstat(filepath.Join(root, "var", "spool", "mail")); err != nil {
+		t.Fatal(err)
+	} else if info.Mode() != os.ModeDir|PrivateDirMode {
+		t.Errorf("expected the private spool directory to be %s, got %s", PrivateDirMode, info.Mode())
+	}
+
+	spool := filepath.Join(root, "var", "mail", "alice")
+	info, err = os.Lstat(spool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode() != Mode {
+		t.Errorf("expected %s, got %s", Mode, info.Mode())
+	}
+
+	if err := Rename(root, "/var/mail", "alice", "alicia"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(root, "var", "mail", "alicia")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Remove(root, "/var/mail", "alicia"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Remove(root, "/var/mail", "alicia"); err != nil {
+		t.Errorf("expected removing a missing spool to succeed, got %s", err)
+	}
+}
+
+func TestCreateSymlink(t *testing.T) {
+	root, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, "var", "mail"), 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	// A planted symlink must not be followed or replaced.
+	target := filepath.Join(root, "target")
+	if err := os.Symlink(target, filepath.Join(root, "var", "mail", "alice")); err != nil {
+		t.Fatal(err)
+	}
+
+	if created, err := Create(root, "/var/mail", "alice", 1000, 8, Mode); err == nil || created {
+		t.Errorf("expected the symlink to be refused, got %t %v", created, err)
+	}
+
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Error("expected the symlink not to be followed")
+	}
+}
@@ -0,0 +1,173 @@
+package managed
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mikemackintosh/wonka/src/libs/locker"
+)
+
+const FILE_MANAGED = "/var/lib/wonka/managed"
+
+// Kinds of managed entries.
+const (
+	KindUser  = "user"
+	KindGroup = "group"
+)
+
+type Entries []*Entry
+
+// Entry is a user or group created by wonka, kept as a "kind:name" line.
+type Entry struct {
+	Kind string
+	Name string
+}
+
+// Unmarshal will unmarshal a provided managed state file.
+func Unmarshal(data []byte, dest interface{}) error {
+	switch dest.(type) {
+	case *Entries:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of managed.Entries")
+	}
+
+	outfile := dest.(*Entries)
+	for _, line := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") || len(line) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || (parts[0] != KindUser && parts[0] != KindGroup) || len(parts[1]) == 0 {
+			return fmt.Errorf("invalid managed entry %q", line)
+		}
+
+		outfile.Add(parts[0], parts[1])
+	}
+
+	return nil
+}
+
+// Marshal is a helper for managed.Marshal().
+func (e Entries) Marshal() ([]byte, error) {
+	return Marshal(e)
+}
+
+// Marshal will marshal the entries, groups first and sorted by name, so
+// the file diffs cleanly.
+func Marshal(in Entries) ([]byte, error) {
+	entries := append(Entries{}, in...)
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].Kind != entries[b].Kind {
+			return entries[a].Kind == KindGroup
+		}
+		return entries[a].Name < entries[b].Name
+	})
+
+	out := "# Users and groups created by wonka.\n"
+	for _, entry := range entries {
+		out += entry.Kind + ":" + entry.Name + "\n"
+	}
+
+	return []byte(out), nil
+}
+
+// Save will write the entries to /var/lib/wonka/managed.
+func (e Entries) Save() error {
+	return e.SaveToFile(FILE_MANAGED)
+}
+
+// SaveToFile will write the entries to the provided file, creating it and
+// its directory if they do not exist.
+func (e Entries) SaveToFile(file string) error {
+	b, err := e.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(file, b, 0644)
+	}
+
+	return locker.WriteWithLock(file, b)
+}
+
+// LoadFromDisk will read /var/lib/wonka/managed.
+func LoadFromDisk() (*Entries, error) {
+	return LoadFromFile(FILE_MANAGED)
+}
+
+// LoadFromFile will read the provided managed state file.
+func LoadFromFile(file string) (*Entries, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entries
+	if err := Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// Add will record a user or group, once.
+func (e *Entries) Add(kind, name string) {
+	if !e.Has(kind, name) {
+		*e = append(*e, &Entry{Kind: kind, Name: name})
+	}
+}
+
+// Remove will forget a user or group.
+func (e *Entries) Remove(kind, name string) {
+	for n, entry := range *e {
+		if entry.Kind == kind && entry.Name == name {
+			*e = append((*e)[:n], (*e)[n+1:]...)
+			return
+		}
+	}
+}
+
+// Rename will update the name of a user or group.
+func (e *Entries) Rename(kind, old, new string) {
+	for _, entry := range *e {
+		if entry.Kind == kind && entry.Name == old {
+			entry.Name = new
+		}
+	}
+}
+
+// Has returns true if a user or group is recorded.
+func (e *Entries) Has(kind, name string) bool {
+	for _, entry := range *e {
+		if entry.Kind == kind && entry.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Names returns the names recorded for a kind, in file order.
+func (e *Entries) Names(kind string) []string {
+	var names []string
+	for _, entry := range *e {
+		if entry.Kind == kind {
+			names = append(names, entry.Name)
+		}
+	}
+
+	return names
+}
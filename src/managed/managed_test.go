@@ -0,0 +1,32 @@
+package managed
+
+import "testing"
+
+func TestMarshal(t *testing.T) {
+	var e Entries
+	if err := Unmarshal([]byte("# comment\nuser:bob\ngroup:developers\nuser:alice\nuser:alice\n"), &e); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e) != 3 || !e.Has(KindUser, "alice") || e.Has(KindGroup, "alice") {
+		t.Fatalf("unexpected entries %#v", e)
+	}
+
+	e.Rename(KindUser, "bob", "carol")
+	e.Remove(KindGroup, "developers")
+	e.Add(KindGroup, "ops")
+
+	b, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "# Users and groups created by wonka.\ngroup:ops\nuser:alice\nuser:carol\n"
+	if string(b) != want {
+		t.Errorf("expected %q, got %q", want, string(b))
+	}
+
+	if err := Unmarshal([]byte("host:alice\n"), &e); err == nil {
+		t.Error("expected an unknown kind to fail")
+	}
+}
@@ -0,0 +1,35 @@
+package wonka
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+// maxNameLength is the longest name utmp and most tools can handle.
+const maxNameLength = 32
+
+// ValidName returns an error if name cannot be used for a user or group. It
+// is more lenient than the shadow-utils default, but rejects everything which
+// would break the account files or be mistaken for an option or an ID.
+func ValidName(name string) error {
+	if len(name) == 0 || len(name) > maxNameLength {
+		return fmt.Errorf("name must be between 1 and %d characters", maxNameLength)
+	}
+
+	if name[0] == '-' || name == "." || name == ".." {
+		return fmt.Errorf("invalid name %q", name)
+	}
+
+	if _, err := strconv.Atoi(name); err == nil {
+		return fmt.Errorf("name %q must not be numeric", name)
+	}
+
+	for _, r := range name {
+		if r == ':' || r == ',' || r == '/' || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf("name %q contains an invalid character", name)
+		}
+	}
+
+	return nil
+}
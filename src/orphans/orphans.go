@@ -0,0 +1,135 @@
+package orphans
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/owner"
+	"github.com/mikemackintosh/wonka/src/passwd"
+)
+
+// DefaultSkip are the pseudo filesystems skipped when walking from "/".
+var DefaultSkip = []string{"/proc", "/sys", "/dev", "/run"}
+
+// Orphan is a file whose owner or group has no account.
+type Orphan struct {
+	Path      string `json:"path"`
+	UID       int    `json:"uid"`
+	GID       int    `json:"gid"`
+	OrphanUID bool   `json:"orphan_uid"`
+	OrphanGID bool   `json:"orphan_gid"`
+}
+
+// Options control the walk.
+type Options struct {
+	// Skip lists paths which are not descended into.
+	Skip []string
+	// OneFileSystem stays on the filesystem of the starting path.
+	OneFileSystem bool
+}
+
+// Find walks path below root, without following symlinks, and returns
+// every file owned by a UID missing from users or a GID missing from grps.
+// Paths, both those returned and those in opts.Skip, are relative to root.
+// Entries which cannot be read are skipped and returned as errors, only a
+// failure to read path itself stops the walk.
+func Find(root, path string, users passwd.Entries, grps groups.Entries, opts Options) ([]Orphan, []error, error) {
+	uids := map[int]bool{}
+	for _, user := range users {
+		uids[user.UID] = true
+	}
+
+	gids := map[int]bool{}
+	for _, group := range grps {
+		gids[group.GID] = true
+	}
+
+	skip := map[string]bool{}
+	for _, s := range opts.Skip {
+		skip[filepath.Join("/", s)] = true
+	}
+
+	start := filepath.Join(root, path)
+
+	var device uint64
+	if info, err := os.Lstat(start); err != nil {
+		return nil, nil, err
+	} else if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		device = uint64(stat.Dev)
+	}
+
+	var orphans []Orphan
+	var unreadable []error
+	err := filepath.Walk(start, func(file string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			// A directory which cannot be listed is reported after it was
+			// visited, so returning nil skips its contents.
+			unreadable = append(unreadable, err)
+			return nil
+		}
+
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.Join("/", rel)
+
+		if skip[rel] || (opts.OneFileSystem && uint64(stat.Dev) != device) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		uid, gid := int(stat.Uid), int(stat.Gid)
+		if !uids[uid] || !gids[gid] {
+			orphans = append(orphans, Orphan{
+				Path:      rel,
+				UID:       uid,
+				GID:       gid,
+				OrphanUID: !uids[uid],
+				OrphanGID: !gids[gid],
+			})
+		}
+
+		return nil
+	})
+
+	return orphans, unreadable, err
+}
+
+// Reassign chowns orphans below root to uid and gid, only changing the part
+// of the ownership which is orphaned and still held by the orphaned ID.
+// Symlinks are changed themselves, and setuid and setgid bits are kept. An
+// ID of -1 leaves that part alone.
+func Reassign(root string, orphans []Orphan, uid, gid int) error {
+	for _, o := range orphans {
+		fixup := owner.Fixup{OldUID: -1, NewUID: -1, OldGID: -1, NewGID: -1}
+		if o.OrphanUID {
+			fixup.OldUID, fixup.NewUID = o.UID, uid
+		}
+
+		if o.OrphanGID {
+			fixup.OldGID, fixup.NewGID = o.GID, gid
+		}
+
+		if fixup.NewUID < 0 && fixup.NewGID < 0 {
+			continue
+		}
+
+		if _, err := fixup.Fix(filepath.Join(root, o.Path)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package orphans
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/passwd"
+)
+
+func TestFind(t *testing.T) {
+	root, err := ioutil.TempDir("", "orphans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	owners := map[string][2]int{
+		"owned":   {0, 0},
+		"nouser":  {4242, 0},
+		"nogroup": {0, 4242},
+	}
+	for name, owner := range owners {
+		path := filepath.Join(root, name)
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Lchown(path, owner[0], owner[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reassigning must keep the setuid bit which chown clears.
+	if err := os.Chmod(filepath.Join(root, "nouser"), 0755|os.ModeSetuid); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Lchown(root, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	users := passwd.Entries{{Username: "root"}}
+	grps := groups.Entries{{Name: "root"}}
+
+	found, unreadable, err := Find(root, "/", users, grps, Options{Skip: []string{"/nogroup"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(unreadable) != 0 {
+		t.Errorf("unexpected unreadable entries %v", unreadable)
+	}
+
+	if len(found) != 1 || found[0].Path != "/nouser" || !found[0].OrphanUID || found[0].OrphanGID {
+		t.Fatalf("unexpected orphans %#v", found)
+	}
+
+	if err := Reassign(root, found, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(root, "nouser"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode()&os.ModeSetuid == 0 {
+		t.Errorf("expected the setuid bit to be kept, got %s", info.Mode())
+	}
+
+	found, _, err = Find(root, "/", users, grps, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 1 || found[0].Path != "/nogroup" {
+		t.Errorf("expected only nogroup to be left, got %#v", found)
+	}
+}
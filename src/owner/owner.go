@@ -0,0 +1,134 @@
+package owner
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Fixup moves the ownership of files from one UID or GID to another. An ID
+// of -1 on either side leaves that part of the ownership alone.
+type Fixup struct {
+	OldUID int
+	NewUID int
+	OldGID int
+	NewGID int
+
+	// Skip lists paths which are neither changed nor descended into.
+	Skip []string
+	// DryRun reports the files which would change without changing them.
+	DryRun bool
+}
+
+// Walk changes the ownership of every file below path, including path
+// itself, and returns the files it changed. Symlinks are changed themselves
+// and never followed.
+func (f *Fixup) Walk(path string) ([]string, error) {
+	var changed []string
+
+	err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if f.skipped(file) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ok, err := f.fix(file, info)
+		if ok {
+			changed = append(changed, file)
+		}
+
+		return err
+	})
+
+	return changed, err
+}
+
+// Fix changes the ownership of a single file, without descending into it,
+// and returns true if the file was, or with DryRun would be, changed.
+func (f *Fixup) Fix(file string) (bool, error) {
+	info, err := os.Lstat(file)
+	if err != nil {
+		return false, err
+	}
+
+	return f.fix(file, info)
+}
+
+// fix changes the ownership of file, keeping its setuid and setgid bits.
+func (f *Fixup) fix(file string, info os.FileInfo) (bool, error) {
+	uid, gid, ok := f.owner(info)
+	if !ok || f.DryRun {
+		return ok, nil
+	}
+
+	if err := os.Lchown(file, uid, gid); err != nil {
+		return false, err
+	}
+
+	// Chown clears setuid and setgid bits on files, so put them back.
+	if info.Mode().IsRegular() && info.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 {
+		if err := os.Chmod(file, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// Revert puts back the ownership of files changed by Walk.
+func (f *Fixup) Revert(files []string) error {
+	reverse := &Fixup{OldUID: f.NewUID, NewUID: f.OldUID, OldGID: f.NewGID, NewGID: f.OldGID}
+
+	for _, file := range files {
+		info, err := os.Lstat(file)
+		if err != nil {
+			return err
+		}
+
+		if uid, gid, ok := reverse.owner(info); ok {
+			if err := os.Lchown(file, uid, gid); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// owner returns the new ownership of a file and whether it changes.
+func (f *Fixup) owner(info os.FileInfo) (int, int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1, false
+	}
+
+	uid, gid := -1, -1
+	if f.OldUID >= 0 && f.NewUID >= 0 && int(stat.Uid) == f.OldUID {
+		uid = f.NewUID
+	}
+
+	if f.OldGID >= 0 && f.NewGID >= 0 && int(stat.Gid) == f.OldGID {
+		gid = f.NewGID
+	}
+
+	return uid, gid, uid >= 0 || gid >= 0
+}
+
+// skipped returns true if file is in the skip list.
+func (f *Fixup) skipped(file string) bool {
+	for _, skip := range f.Skip {
+		if filepath.Clean(skip) == file {
+			return true
+		}
+	}
+
+	return false
+}
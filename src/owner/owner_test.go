@@ -0,0 +1,98 @@
+package owner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func uidOf(t *testing.T, path string) int {
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return int(info.Sys().(*syscall.Stat_t).Uid)
+}
+
+func TestWalk(t *testing.T) {
+	root, err := ioutil.TempDir("", "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	outside, err := ioutil.TempFile("", "outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside.Close()
+	defer os.Remove(outside.Name())
+
+	for _, dir := range []string{"keep", "skip"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := []string{"keep/file", "skip/file", "other"}
+	for _, file := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink(outside.Name(), filepath.Join(root, "keep", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{root, "keep", "keep/file", "keep/link", "skip/file"} {
+		if path != root {
+			path = filepath.Join(root, path)
+		}
+
+		if err := os.Lchown(path, 1000, -1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Chown(outside.Name(), 1000, -1)
+
+	f := &Fixup{OldUID: 1000, NewUID: 2000, OldGID: -1, NewGID: -1, Skip: []string{filepath.Join(root, "skip")}, DryRun: true}
+
+	dry, err := f.Walk(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dry) != 4 || uidOf(t, filepath.Join(root, "keep", "file")) != 1000 {
+		t.Fatalf("unexpected dry run %v", dry)
+	}
+
+	f.DryRun = false
+	changed, err := f.Walk(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changed) != 4 {
+		t.Errorf("expected 4 changes, got %v", changed)
+	}
+
+	if uidOf(t, filepath.Join(root, "keep", "link")) != 2000 || uidOf(t, outside.Name()) != 1000 {
+		t.Error("expected the symlink itself to change, not its target")
+	}
+
+	if uidOf(t, filepath.Join(root, "skip", "file")) != 1000 {
+		t.Error("expected skipped paths to be left alone")
+	}
+
+	if err := f.Revert(changed); err != nil {
+		t.Fatal(err)
+	}
+
+	if uidOf(t, filepath.Join(root, "keep", "file")) != 1000 {
+		t.Error("expected revert to restore the owner")
+	}
+}
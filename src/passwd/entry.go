@@ -1,5 +1,7 @@
 package passwd
 
+import "reflect"
+
 type Entry struct {
 	Password string
 	Username string
@@ -11,6 +13,13 @@ type Entry struct {
 	Error    []error
 }
 
+// Defaulter fills the fields of a new entry which were left empty, the way
+// *useradd.Defaults does from /etc/default/useradd.
+type Defaulter interface {
+	Apply(e *Entry)
+}
+
+// NewEntry returns a passwd entry with the given fields.
 func NewEntry(username, password string, uid, gid int, info, homedir, shell string) (Entry, error) {
 	e := Entry{
 		Username: username,
@@ -24,3 +33,26 @@ func NewEntry(username, password string, uid, gid int, info, homedir, shell stri
 
 	return e, nil
 }
+
+// NewEntryWithDefaults is NewEntry, with the empty fields filled from
+// defaults. A nil defaults, including a nil pointer in the interface,
+// fills nothing.
+func NewEntryWithDefaults(username, password string, uid, gid int, info, homedir, shell string, defaults Defaulter) (Entry, error) {
+	e, err := NewEntry(username, password, uid, gid, info, homedir, shell)
+	if err != nil || isNil(defaults) {
+		return e, err
+	}
+
+	defaults.Apply(&e)
+	return e, nil
+}
+
+// isNil returns true for a nil interface or a nil pointer in one.
+func isNil(defaults Defaulter) bool {
+	if defaults == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(defaults)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
@@ -142,13 +142,18 @@ func Marshal(in Entries) ([]byte, error) {
 
 // Save will take in entries.
 func (e Entries) Save() error {
+	return e.SaveToFile(FILE_PASSWD)
+}
+
+// SaveToFile will write the entries to the provided file.
+func (e Entries) SaveToFile(file string) error {
 	b, err := e.Marshal()
 	if err != nil {
 		return err
 	}
 
 	// Will write the entries list with.
-	if err = locker.WriteWithLock(FILE_PASSWD, b); err != nil {
+	if err = locker.WriteWithLock(file, b); err != nil {
 		return err
 	}
 
@@ -157,7 +162,13 @@ func (e Entries) Save() error {
 
 // LoadFromDisk will read an /etc/passwd file and return parsed Entries or error.
 func LoadFromDisk() (*Entries, error) {
-	b, err := ioutil.ReadFile(FILE_PASSWD)
+	return LoadFromFile(FILE_PASSWD)
+}
+
+// LoadFromFile will read the provided /etc/passwd formatted file and return parsed
+// Entries or error.
+func LoadFromFile(file string) (*Entries, error) {
+	b, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
@@ -176,7 +187,9 @@ func (e *Entries) NewEntry(new Entry) {
 	*e = append(*e, new)
 }
 
-// RemoveEntry adds a new entry to Entries.
+// RemoveEntry removes an entry from Entries. The remaining entries are
+// copied to a new slice, so a pointer from GetUser never ends up on
+// another entry.
 func (e *Entries) RemoveEntry(rm Entry) error {
 	if len(rm.Username) == 0 {
 		return errors.New("must provide username to be removed")
@@ -185,9 +198,9 @@ func (e *Entries) RemoveEntry(rm Entry) error {
 	// Look for the username, then remove it.
 	for i, entry := range *e {
 		if entry.Username == rm.Username {
-			s := *e
-			s = append(s[:i], s[i+1:]...)
-			*e = s
+			s := make(Entries, 0, len(*e)-1)
+			s = append(s, (*e)[:i]...)
+			*e = append(s, (*e)[i+1:]...)
 			return nil
 		}
 	}
@@ -196,22 +209,25 @@ func (e *Entries) RemoveEntry(rm Entry) error {
 	return &ErrNotFound{"entry not found"}
 }
 
-// GetUser will get a user by name.
+// GetUser will get a user by name. The entry can be modified in place,
+// until NewEntry or RemoveEntry is called, which may move the entries and
+// leave the pointer on a stale copy.
 func (e *Entries) GetUser(name string) *Entry {
-	for _, user := range *e {
-		if user.Username == name {
-			return &user
+	for i := range *e {
+		if (*e)[i].Username == name {
+			return &(*e)[i]
 		}
 	}
 
 	return nil
 }
 
-// GetUserByID will get a user by id.
+// GetUserByID will get a user by id. The entry can be modified in place,
+// until NewEntry or RemoveEntry is called, like with GetUser.
 func (e *Entries) GetUserByID(id int) *Entry {
-	for _, user := range *e {
-		if user.UID == id {
-			return &user
+	for i := range *e {
+		if (*e)[i].UID == id {
+			return &(*e)[i]
 		}
 	}
 
@@ -82,7 +82,7 @@ func TestMarshal(t *testing.T) {
 					UID:      0,
 				},
 			},
-			Want: []byte("root:x:0:0:::"),
+			Want: []byte("root:x:0:0:::\n"),
 		},
 		{
 			Have: Entries{
@@ -100,7 +100,7 @@ func TestMarshal(t *testing.T) {
 					Shell:    "/usr/sbin/nonexistent",
 				},
 			},
-			Want: []byte("root:x:0:0:::\nnobody:x:0:0:nobody:/nonexistent:/usr/sbin/nonexistent"),
+			Want: []byte("root:x:0:0:::\nnobody:x:0:0:nobody:/nonexistent:/usr/sbin/nonexistent\n"),
 		},
 	}
 
@@ -184,3 +184,24 @@ func TestRemoveEntry(t *testing.T) {
 		}
 	}
 }
+
+func TestRemoveEntryPointer(t *testing.T) {
+	e := &Entries{
+		Entry{Username: "removeme", Password: "x", UID: 1, GID: 1},
+		Entry{Username: "boat", Password: "x", UID: 2, GID: 2},
+	}
+
+	// A pointer taken before the removal must not move onto boat.
+	removed := e.GetUser("removeme")
+	if err := e.RemoveEntry(Entry{Username: "removeme"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if removed.Username != "removeme" {
+		t.Errorf("expected the old pointer to stay on removeme, got %s", removed.Username)
+	}
+
+	if boat := e.GetUser("boat"); boat == nil || boat.UID != 2 || len(*e) != 1 {
+		t.Errorf("unexpected entries %#v", e)
+	}
+}
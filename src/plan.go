@@ -0,0 +1,550 @@
+package wonka
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mikemackintosh/wonka/src/managed"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/shadow"
+	"github.com/mikemackintosh/wonka/src/spec"
+)
+
+// Plan actions.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// hidden replaces password hashes in plans.
+const hidden = "(hidden)"
+
+// FieldChange is a field of a user or group changing value. Old is empty
+// for new entries.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// String returns the change as "field: old -> new".
+func (c FieldChange) String() string {
+	if len(c.Old) == 0 {
+		return fmt.Sprintf("%s: %s", c.Field, c.New)
+	}
+
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.Old, none(c.New))
+}
+
+// Step is one user or group to create, update or delete. Files lists the
+// ownership changes a new UID or GID brings, one "path: change" per file.
+type Step struct {
+	Action string        `json:"action"`
+	Kind   string        `json:"kind"`
+	Name   string        `json:"name"`
+	Fields []FieldChange `json:"fields,omitempty"`
+	Files  []string      `json:"files,omitempty"`
+
+	apply func() error
+}
+
+// String returns the step with one line per field and file.
+func (s Step) String() string {
+	sign := map[string]string{ActionCreate: "+", ActionUpdate: "~", ActionDelete: "-"}[s.Action]
+	lines := []string{fmt.Sprintf("%s %s %s", sign, s.Kind, s.Name)}
+	for _, field := range s.Fields {
+		lines = append(lines, "    "+field.String())
+	}
+
+	for _, file := range s.Files {
+		lines = append(lines, "    "+file)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Plan is the list of steps taking the databases to the state of a spec.
+type Plan struct {
+	Steps []Step `json:"steps"`
+}
+
+// Empty returns true if the databases already match the spec.
+func (p *Plan) Empty() bool {
+	return len(p.Steps) == 0
+}
+
+// String returns the plan in a human readable form, with a summary.
+func (p *Plan) String() string {
+	if p.Empty() {
+		return "No changes.\n"
+	}
+
+	count := map[string]int{}
+	var out []string
+	for _, step := range p.Steps {
+		out = append(out, step.String())
+		count[step.Action]++
+	}
+
+	return fmt.Sprintf("%s\n\nPlan: %d to create, %d to update, %d to delete.\n",
+		strings.Join(out, "\n"), count[ActionCreate], count[ActionUpdate], count[ActionDelete])
+}
+
+// Plan compares a spec with the loaded databases and returns the steps to
+// apply it. Groups are created first, so users can use them, and removed
+// last, once no user uses them.
+func (i *Instance) Plan(s *spec.Spec) (*Plan, error) {
+	return i.PlanWithOptions(s, PlanOptions{})
+}
+
+// PlanWithOptions is Plan, optionally pruning users and groups dropped from
+// the spec.
+func (i *Instance) PlanWithOptions(s *spec.Spec, opts PlanOptions) (*Plan, error) {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return nil, errNotLoaded
+	}
+
+	if err := i.checkSpec(s); err != nil {
+		return nil, err
+	}
+
+	var creates, users, updates, userDeletes, groupDeletes []Step
+
+	for _, g := range s.Groups {
+		existing := i.Groups.GetGroup(g.Name)
+		switch {
+		case !g.Present() && existing != nil:
+			groupDeletes = append(groupDeletes, i.deleteGroupStep(g.Name))
+		case g.Present() && existing == nil:
+			creates = append(creates, i.createGroupStep(g, desiredMembers(s, g.Name, nil)))
+		}
+	}
+
+	for _, u := range s.Users {
+		existing := i.Passwd.GetUser(u.Name)
+		switch {
+		case !u.Present() && existing != nil:
+			userDeletes = append(userDeletes, i.deleteUserStep(u.Name))
+		case u.Present() && existing == nil:
+			users = append(users, i.createUserStep(u))
+		case u.Present():
+			step, err := i.updateUserStep(u, existing)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(step.Fields) > 0 {
+				users = append(users, step)
+			}
+		}
+	}
+
+	for _, group := range *i.Groups {
+		g := s.GetGroup(group.Name)
+		if g != nil && !g.Present() {
+			continue
+		}
+
+		step, err := i.updateGroupStep(s, group.Name, g)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(step.Fields) > 0 {
+			updates = append(updates, step)
+		}
+	}
+
+	if opts.Prune {
+		users, groups := i.pruneSteps(s)
+		userDeletes = append(userDeletes, users...)
+		groupDeletes = append(groupDeletes, groups...)
+	}
+
+	p := &Plan{}
+	for _, steps := range [][]Step{creates, users, updates, userDeletes, groupDeletes} {
+		p.Steps = append(p.Steps, steps...)
+	}
+
+	return p, nil
+}
+
+// Apply runs the steps of a plan against the loaded databases. Nothing is
+// written until Save is called, so on an error the instance should be
+// discarded rather than saved.
+func (i *Instance) Apply(p *Plan) error {
+	for _, step := range p.Steps {
+		if err := step.apply(); err != nil {
+			return fmt.Errorf("%s %s %s: %s", step.Action, step.Kind, step.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkSpec validates names and makes sure every group a user refers to
+// exists or is created by the spec.
+func (i *Instance) checkSpec(s *spec.Spec) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	for _, g := range s.Groups {
+		if err := ValidName(g.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, u := range s.Users {
+		if err := ValidName(u.Name); err != nil {
+			return err
+		}
+
+		if !u.Present() {
+			continue
+		}
+
+		refs := u.Groups
+		if len(u.Group) > 0 {
+			refs = append([]string{u.Group}, refs...)
+		}
+
+		for _, name := range refs {
+			g := s.GetGroup(name)
+			if g != nil && !g.Present() {
+				return fmt.Errorf("user %s uses group %s, which is to be removed", u.Name, name)
+			}
+
+			if g == nil && i.Groups.GetGroup(name) == nil {
+				return &ErrNotFound{fmt.Sprintf("group %s of user %s does not exist", name, u.Name)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// createGroupStep adds a group with its members.
+func (i *Instance) createGroupStep(g spec.Group, members []string) Step {
+	step := Step{Action: ActionCreate, Kind: "group", Name: g.Name}
+	if g.GID != nil {
+		step.Fields = append(step.Fields, FieldChange{Field: "gid", New: strconv.Itoa(*g.GID)})
+	}
+
+	if len(members) > 0 {
+		step.Fields = append(step.Fields, FieldChange{Field: "members", New: strings.Join(members, ",")})
+	}
+
+	step.apply = func() error {
+		if _, err := i.AddGroup(Group{Name: g.Name, GID: g.GID, Members: members, System: g.System}); err != nil {
+			return err
+		}
+
+		i.manage(managed.KindGroup, g.Name)
+		return nil
+	}
+
+	return step
+}
+
+// updateGroupStep changes the GID and member list of an existing group. g
+// is nil for groups the spec only refers to through user memberships.
+func (i *Instance) updateGroupStep(s *spec.Spec, name string, g *spec.Group) (Step, error) {
+	step := Step{Action: ActionUpdate, Kind: "group", Name: name}
+	group := i.Groups.GetGroup(name)
+
+	if g != nil && g.GID != nil && *g.GID != group.GID {
+		if other := i.Groups.GetGroupByID(*g.GID); other != nil {
+			return step, &ErrExists{fmt.Sprintf("gid %d is used by %s", *g.GID, other.Name)}
+		}
+
+		step.Fields = append(step.Fields, FieldChange{Field: "gid", Old: strconv.Itoa(group.GID), New: strconv.Itoa(*g.GID)})
+
+		changes, err := i.RenumberGroup(name, *g.GID, RenumberOptions{DryRun: true})
+		if err != nil {
+			return step, err
+		}
+		step.Files = i.fileChanges(changes)
+	}
+
+	current := append([]string{}, group.Users...)
+	sort.Strings(current)
+
+	members := desiredMembers(s, name, group.Users)
+	if strings.Join(current, ",") != strings.Join(members, ",") {
+		step.Fields = append(step.Fields, FieldChange{Field: "members", Old: none(strings.Join(current, ",")), New: strings.Join(members, ",")})
+	}
+
+	step.apply = func() error {
+		if g != nil && g.GID != nil {
+			if _, err := i.RenumberGroup(name, *g.GID, RenumberOptions{}); err != nil {
+				return err
+			}
+		}
+
+		return i.setMembers(name, members)
+	}
+
+	return step, nil
+}
+
+// deleteGroupStep removes a group. A group already gone, because it was
+// the private group of a removed user, is not an error.
+func (i *Instance) deleteGroupStep(name string) Step {
+	return Step{Action: ActionDelete, Kind: "group", Name: name, apply: func() error {
+		if i.Groups.GetGroup(name) == nil {
+			return nil
+		}
+
+		return i.DeleteGroup(name)
+	}}
+}
+
+// createUserStep adds a user. Its memberships are set by the group steps.
+func (i *Instance) createUserStep(u spec.User) Step {
+	step := Step{Action: ActionCreate, Kind: "user", Name: u.Name}
+	add := func(field, value string) {
+		if len(value) > 0 {
+			step.Fields = append(step.Fields, FieldChange{Field: field, New: value})
+		}
+	}
+
+	if u.UID != nil {
+		add("uid", strconv.Itoa(*u.UID))
+	}
+	add("group", u.Group)
+	add("info", u.Info)
+	add("home", u.Home)
+	add("shell", u.Shell)
+	if len(u.Password) > 0 {
+		add("password", hidden)
+	}
+
+	step.apply = func() error {
+		_, err := i.AddUser(User{
+			Name:       u.Name,
+			UID:        u.UID,
+			Group:      u.Group,
+			Info:       u.Info,
+			HomeDir:    u.Home,
+			Shell:      u.Shell,
+			System:     u.System,
+			CreateHome: u.CreateHome,
+		})
+		if err != nil {
+			return err
+		}
+		i.manage(managed.KindUser, u.Name)
+
+		if len(u.Password) > 0 {
+			i.Shadow.GetUserEntry(u.Name).Password = u.Password
+		}
+
+		return nil
+	}
+
+	return step
+}
+
+// updateUserStep changes the fields of an existing user which the spec
+// sets to something else.
+func (i *Instance) updateUserStep(u spec.User, entry *passwd.Entry) (Step, error) {
+	step := Step{Action: ActionUpdate, Kind: "user", Name: u.Name}
+	change := func(field, old, new string) {
+		if len(new) > 0 && old != new {
+			step.Fields = append(step.Fields, FieldChange{Field: field, Old: none(old), New: new})
+		}
+	}
+
+	if u.UID != nil && *u.UID != entry.UID {
+		if other := i.Passwd.GetUserByID(*u.UID); other != nil {
+			return step, &ErrExists{fmt.Sprintf("uid %d is used by %s", *u.UID, other.Username)}
+		}
+		change("uid", strconv.Itoa(entry.UID), strconv.Itoa(*u.UID))
+
+		changes, err := i.RenumberUser(u.Name, *u.UID, RenumberOptions{DryRun: true})
+		if err != nil {
+			return step, err
+		}
+		step.Files = i.fileChanges(changes)
+	}
+
+	change("group", i.groupName(entry.GID), u.Group)
+	change("info", entry.Info, u.Info)
+	change("home", entry.HomeDir, u.Home)
+	change("shell", entry.Shell, u.Shell)
+
+	var password string
+	if shd := i.Shadow.GetUserEntry(u.Name); shd != nil {
+		password = shd.Password
+	}
+
+	if len(u.Password) > 0 && u.Password != password {
+		step.Fields = append(step.Fields, FieldChange{Field: "password", Old: hidden, New: hidden})
+	}
+
+	fields := step.Fields
+	step.apply = func() error {
+		return i.updateUser(u, fields)
+	}
+
+	return step, nil
+}
+
+// updateUser sets the changed fields of a user from the spec.
+func (i *Instance) updateUser(u spec.User, fields []FieldChange) error {
+	for _, field := range fields {
+		if field.Field == "uid" {
+			if _, err := i.RenumberUser(u.Name, *u.UID, RenumberOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	entry := i.Passwd.GetUser(u.Name)
+	if entry == nil {
+		return &ErrNotFound{fmt.Sprintf("user %s does not exist", u.Name)}
+	}
+
+	for _, field := range fields {
+		switch field.Field {
+		case "group":
+			group := i.Groups.GetGroup(u.Group)
+			if group == nil {
+				return &ErrNotFound{fmt.Sprintf("group %s does not exist", u.Group)}
+			}
+			entry.GID = group.GID
+		case "info":
+			entry.Info = u.Info
+		case "home":
+			entry.HomeDir = u.Home
+		case "shell":
+			entry.Shell = u.Shell
+		case "password":
+			shd := i.Shadow.GetUserEntry(u.Name)
+			if shd == nil {
+				shd = shadow.NewEntry(u.Name, i.Policy)
+				i.Shadow.NewEntry(shd)
+			}
+			shd.Password = u.Password
+			shd.LastPasswordChange = shadow.Today()
+		}
+	}
+
+	return nil
+}
+
+// deleteUserStep removes a user, keeping its home directory.
+func (i *Instance) deleteUserStep(name string) Step {
+	return Step{Action: ActionDelete, Kind: "user", Name: name, apply: func() error {
+		return i.DeleteUser(name, DeleteOptions{})
+	}}
+}
+
+// setMembers replaces the member list of a group, in group and gshadow.
+func (i *Instance) setMembers(name string, members []string) error {
+	group := i.Groups.GetGroup(name)
+	if group == nil {
+		return &ErrNotFound{fmt.Sprintf("group %s does not exist", name)}
+	}
+
+	for _, member := range append([]string{}, group.Users...) {
+		if !contains(members, member) {
+			group.RemoveUser(member)
+		}
+	}
+
+	for _, member := range members {
+		group.AddUser(member)
+	}
+
+	if entry := i.gshadowEntry(name); entry != nil {
+		entry.Members = append([]string{}, group.Users...)
+	}
+
+	return nil
+}
+
+// fileChanges returns the changes a renumber makes to files, leaving out
+// those to the databases, which the step fields already show.
+func (i *Instance) fileChanges(changes []Change) []string {
+	var files []string
+	for _, c := range changes {
+		if c.Target != i.Options.filePasswd && c.Target != i.Options.fileGroups {
+			files = append(files, c.String())
+		}
+	}
+
+	return files
+}
+
+// groupName returns the name of a GID, or the number if it has none.
+func (i *Instance) groupName(gid int) string {
+	if group := i.Groups.GetGroupByID(gid); group != nil {
+		return group.Name
+	}
+
+	return strconv.Itoa(gid)
+}
+
+// desiredMembers returns the sorted member list of a group. A spec group
+// with members replaces the current list, and users listing their groups
+// are added to or removed from it.
+func desiredMembers(s *spec.Spec, name string, current []string) []string {
+	g := s.GetGroup(name)
+	authoritative := g != nil && g.Members != nil
+
+	set := map[string]bool{}
+	if authoritative {
+		for _, member := range g.Members {
+			set[member] = true
+		}
+	} else {
+		for _, member := range current {
+			set[member] = true
+		}
+	}
+
+	for _, u := range s.Users {
+		if !u.Present() || u.Groups == nil {
+			continue
+		}
+
+		if contains(u.Groups, name) {
+			set[u.Name] = true
+		} else if !authoritative || !contains(g.Members, u.Name) {
+			delete(set, u.Name)
+		}
+	}
+
+	var members []string
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+
+	return members
+}
+
+// contains returns true if list holds s.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// none returns "(none)" for empty values.
+func none(s string) string {
+	if len(s) == 0 {
+		return "(none)"
+	}
+
+	return s
+}
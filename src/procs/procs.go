@@ -0,0 +1,145 @@
+package procs
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const DIR_PROC = "/proc"
+
+// Process is a running process.
+type Process struct {
+	PID  int    `json:"pid"`
+	Name string `json:"name"`
+}
+
+// Find returns the processes below the proc directory dir whose real,
+// effective, saved or filesystem UID is uid. Processes which exit while
+// being read are skipped.
+func Find(dir string, uid int) ([]Process, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []Process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		status, err := readStatus(dir, pid)
+		if err != nil {
+			continue
+		}
+
+		if status["State"] == "Z" || status["State"] == "X" {
+			continue
+		}
+
+		for _, id := range strings.Fields(status["Uid"]) {
+			if id == strconv.Itoa(uid) {
+				found = append(found, Process{PID: pid, Name: status["Name"]})
+				break
+			}
+		}
+	}
+
+	sort.Slice(found, func(a, b int) bool { return found[a].PID < found[b].PID })
+	return found, nil
+}
+
+// Terminate sends SIGTERM to every process, waits up to grace for them to
+// exit, then sends SIGKILL to the ones left. dir is the proc directory used
+// to see which are still running.
+func Terminate(dir string, procs []Process, grace time.Duration) error {
+	for _, p := range procs {
+		if err := signal(p.PID, syscall.SIGTERM); err != nil {
+			return err
+		}
+	}
+
+	deadline := time.Now().Add(grace)
+	for {
+		var left []Process
+		for _, p := range procs {
+			if alive(dir, p.PID) {
+				left = append(left, p)
+			}
+		}
+		procs = left
+
+		if len(procs) == 0 || !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for _, p := range procs {
+		if err := signal(p.PID, syscall.SIGKILL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// signal sends sig to pid, ignoring processes that already exited.
+func signal(pid int, sig syscall.Signal) error {
+	if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+		return err
+	}
+
+	return nil
+}
+
+// alive returns true if pid is running. Zombies have exited and only wait
+// for their parent.
+func alive(dir string, pid int) bool {
+	status, err := readStatus(dir, pid)
+	if err != nil {
+		return false
+	}
+
+	return status["State"] != "Z" && status["State"] != "X"
+}
+
+// readStatus returns the fields of /proc/<pid>/status. Only the first word
+// of State is kept.
+func readStatus(dir string, pid int) (map[string]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return nil, err
+	}
+
+	status := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		status[parts[0]] = strings.TrimSpace(parts[1])
+	}
+
+	if state := strings.Fields(status["State"]); len(state) > 0 {
+		status["State"] = state[0]
+	}
+
+	return status, nil
+}
+
+// Exists returns true if the proc directory is mounted.
+func Exists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "self"))
+	return err == nil
+}
@@ -0,0 +1,63 @@
+package procs
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFind(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	statuses := map[string]string{
+		"100": "Name:\tbash\nState:\tS (sleeping)\nUid:\t1000\t1000\t1000\t1000\n",
+		"200": "Name:\tsudo\nState:\tS (sleeping)\nUid:\t1000\t0\t0\t0\n",
+		"300": "Name:\tsshd\nState:\tS (sleeping)\nUid:\t0\t0\t0\t0\n",
+		"400": "Name:\tdefunct\nState:\tZ (zombie)\nUid:\t1000\t1000\t1000\t1000\n",
+	}
+	for pid, status := range statuses {
+		if err := os.Mkdir(filepath.Join(dir, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(dir, pid, "status"), []byte(status), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := Find(dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 2 || found[0] != (Process{100, "bash"}) || found[1] != (Process{200, "sudo"}) {
+		t.Errorf("unexpected processes %#v", found)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	if !Exists(DIR_PROC) {
+		t.Skip("proc is not mounted")
+	}
+
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer cmd.Wait()
+
+	if err := Terminate(DIR_PROC, []Process{{PID: cmd.Process.Pid}}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if alive(DIR_PROC, cmd.Process.Pid) {
+		t.Error("expected process to be terminated")
+	}
+}
@@ -0,0 +1,71 @@
+package wonka
+
+import (
+	"github.com/mikemackintosh/wonka/src/managed"
+	"github.com/mikemackintosh/wonka/src/spec"
+)
+
+// PlanOptions control what a plan may do besides applying the spec.
+type PlanOptions struct {
+	// Prune removes users and groups created from an earlier spec which
+	// are no longer listed. System accounts and groups are never pruned.
+	Prune bool
+}
+
+// manage records that a user or group was created from a spec.
+func (i *Instance) manage(kind, name string) {
+	if i.Managed == nil {
+		i.Managed = &managed.Entries{}
+	}
+
+	i.Managed.Add(kind, name)
+}
+
+// unmanage forgets a removed user or group.
+func (i *Instance) unmanage(kind, name string) {
+	if i.Managed != nil {
+		i.Managed.Remove(kind, name)
+	}
+}
+
+// pruneSteps returns the steps removing managed users and groups which are
+// not in the spec. A group still used as the primary group of a remaining
+// user is kept, and a user-private group removed along with its user is
+// not removed twice.
+func (i *Instance) pruneSteps(s *spec.Spec) ([]Step, []Step) {
+	if i.Managed == nil {
+		return nil, nil
+	}
+
+	var users, groups []Step
+	pruned := map[int]bool{}
+	for _, name := range i.Managed.Names(managed.KindUser) {
+		entry := i.Passwd.GetUser(name)
+		if entry == nil || s.GetUser(name) != nil || entry.UID < i.Policy.UIDMin {
+			continue
+		}
+
+		users = append(users, i.deleteUserStep(name))
+		pruned[entry.UID] = true
+	}
+
+	for _, name := range i.Managed.Names(managed.KindGroup) {
+		group := i.Groups.GetGroup(name)
+		if group == nil || s.GetGroup(name) != nil || group.GID < i.Policy.GIDMin {
+			continue
+		}
+
+		used := false
+		for _, user := range *i.Passwd {
+			if user.GID == group.GID && !pruned[user.UID] {
+				used = true
+			}
+		}
+
+		if !used {
+			groups = append(groups, i.deleteGroupStep(name))
+		}
+	}
+
+	return users, groups
+}
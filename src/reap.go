@@ -0,0 +1,118 @@
+package wonka
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/reap"
+	"github.com/mikemackintosh/wonka/src/shadow"
+)
+
+// Stale is an account matched by a reap policy.
+type Stale struct {
+	User      string    `json:"user"`
+	UID       int       `json:"uid"`
+	LastLogin time.Time `json:"last_login"`
+	Reasons   []string  `json:"reasons"`
+	Action    string    `json:"action"`
+	// Error is why Reap could not lock or delete the account.
+	Error string `json:"error,omitempty"`
+}
+
+// Stale returns the accounts a reap policy matches on the day of now.
+// Accounts already locked are left out when the action is to lock them.
+func (i *Instance) Stale(p *reap.Policy, now time.Time) ([]Stale, error) {
+	if i.Passwd == nil || i.Shadow == nil {
+		return nil, errNotLoaded
+	}
+
+	min, max := p.UIDMin, p.UIDMax
+	if min < 0 {
+		min = i.Policy.UIDMin
+	}
+
+	if max < 0 {
+		max = i.Policy.UIDMax
+	}
+
+	logins, err := i.LastLogins()
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []Stale
+	for _, login := range logins {
+		if login.UID < min || login.UID > max || p.Excluded(login.User) {
+			continue
+		}
+
+		shd := i.Shadow.GetUserEntry(login.User)
+		if p.Action == reap.ActionLock && shd != nil && locked(shd) {
+			continue
+		}
+
+		reasons := p.Reasons(now, shd, login.Time)
+		if len(reasons) == 0 {
+			continue
+		}
+
+		stale = append(stale, Stale{
+			User:      login.User,
+			UID:       login.UID,
+			LastLogin: login.Time,
+			Reasons:   reasons,
+			Action:    p.Action,
+		})
+	}
+
+	return stale, nil
+}
+
+// Reap locks or deletes the accounts a reap policy matches, and returns
+// them. An account which cannot be handled, like a logged in user, keeps
+// the reason in its Error and the others are still reaped. Nothing is
+// written until Save is called.
+func (i *Instance) Reap(p *reap.Policy, now time.Time) ([]Stale, error) {
+	stale, err := i.Stale(p, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for n, s := range stale {
+		switch p.Action {
+		case reap.ActionLock:
+			err = i.LockUser(s.User)
+		case reap.ActionDelete:
+			err = i.DeleteUser(s.User, DeleteOptions{RemoveHome: p.RemoveHome})
+		}
+
+		if err != nil {
+			stale[n].Error = err.Error()
+		}
+	}
+
+	return stale, nil
+}
+
+// LockUser locks the password of an account and expires it, like
+// usermod -L -e 1, so key based logins are refused as well. Nothing is
+// written until Save is called.
+func (i *Instance) LockUser(name string) error {
+	if i.Shadow == nil {
+		return errNotLoaded
+	}
+
+	shd := i.Shadow.GetUserEntry(name)
+	if shd == nil {
+		return &ErrNotFound{fmt.Sprintf("user %s has no shadow entry", name)}
+	}
+
+	shd.Lock()
+	shd.AccountExpiration = shadow.DateFromDays(1)
+	return nil
+}
+
+// locked returns true if LockUser has been applied to an entry.
+func locked(shd *shadow.Entry) bool {
+	return shd.IsLocked() && shd.AccountExpiration.Days() == 1
+}
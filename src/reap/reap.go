@@ -0,0 +1,238 @@
+package reap
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/shadow"
+)
+
+const FILE_REAP = "/etc/wonka/reap.conf"
+
+// Actions taken on stale accounts.
+const (
+	ActionReport = "report"
+	ActionLock   = "lock"
+	ActionDelete = "delete"
+)
+
+// Policy decides which accounts are stale and what happens to them. It is
+// read from a file of KEY=VALUE lines:
+//
+//	INACTIVE_DAYS=90
+//	EXPIRED=yes
+//	PASSWORD_INACTIVE=yes
+//	NEVER_LOGGED_IN=yes
+//	UID_MIN=1000
+//	UID_MAX=60000
+//	EXCLUDE=root,deploy
+//	ACTION=lock
+//	REMOVE_HOME=no
+type Policy struct {
+	// InactiveDays is how long an account may go without logging in, -1
+	// to ignore logins.
+	InactiveDays int
+	// Expired reaps accounts whose shadow expiration date has passed.
+	Expired bool
+	// PasswordInactive reaps accounts whose password expired longer ago
+	// than the shadow inactivity period.
+	PasswordInactive bool
+	// NeverLoggedIn counts accounts that never logged in as inactive since
+	// their last password change.
+	NeverLoggedIn bool
+	// UIDMin and UIDMax limit the accounts looked at. -1 uses the
+	// login.defs range for regular users.
+	UIDMin int
+	UIDMax int
+	// Exclude lists accounts which are never reaped.
+	Exclude []string
+	// Action is one of report, lock or delete.
+	Action string
+	// RemoveHome removes the home directory and mail spool on delete.
+	RemoveHome bool
+
+	Errors []error
+}
+
+// Default returns a policy reporting accounts unused for 90 days or
+// expired.
+func Default() *Policy {
+	return &Policy{
+		InactiveDays:     90,
+		Expired:          true,
+		PasswordInactive: true,
+		NeverLoggedIn:    true,
+		UIDMin:           -1,
+		UIDMax:           -1,
+		Action:           ActionReport,
+	}
+}
+
+// Unmarshal will unmarshal a policy file. Keys missing from the file keep
+// the value already in dest.
+func Unmarshal(data []byte, dest interface{}) error {
+	switch dest.(type) {
+	case *Policy:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of reap.Policy")
+	}
+
+	p := dest.(*Policy)
+	for _, line := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") || len(line) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			p.Errors = append(p.Errors, fmt.Errorf("invalid line %q", line))
+			continue
+		}
+
+		if err := p.Set(strings.TrimSpace(parts[0]), strings.Trim(strings.TrimSpace(parts[1]), `"`)); err != nil {
+			p.Errors = append(p.Errors, err)
+		}
+	}
+
+	return nil
+}
+
+// Set will set a policy value by its file key.
+func (p *Policy) Set(key, value string) error {
+	switch key {
+	case "INACTIVE_DAYS", "UID_MIN", "UID_MAX":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", key, value)
+		}
+
+		switch key {
+		case "INACTIVE_DAYS":
+			p.InactiveDays = n
+		case "UID_MIN":
+			p.UIDMin = n
+		case "UID_MAX":
+			p.UIDMax = n
+		}
+	case "EXPIRED":
+		p.Expired = yes(value)
+	case "PASSWORD_INACTIVE":
+		p.PasswordInactive = yes(value)
+	case "NEVER_LOGGED_IN":
+		p.NeverLoggedIn = yes(value)
+	case "EXCLUDE":
+		p.Exclude = nil
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				p.Exclude = append(p.Exclude, name)
+			}
+		}
+	case "ACTION":
+		switch value {
+		case ActionReport, ActionLock, ActionDelete:
+			p.Action = value
+		default:
+			return fmt.Errorf("invalid ACTION %q", value)
+		}
+	case "REMOVE_HOME":
+		p.RemoveHome = yes(value)
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+
+	return nil
+}
+
+// LoadFromFile will read a policy file on top of the defaults.
+func LoadFromFile(file string) (*Policy, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	p := Default()
+	if err := Unmarshal(b, p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Excluded returns true if name is never reaped.
+func (p *Policy) Excluded(name string) bool {
+	for _, excluded := range p.Exclude {
+		if excluded == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reasons returns why an account is stale on the day of now, or nothing if
+// it is not. lastLogin is zero if the account never logged in, and shd may
+// be nil when the account has no shadow entry.
+func (p *Policy) Reasons(now time.Time, shd *shadow.Entry, lastLogin time.Time) []string {
+	var reasons []string
+	today := shadow.NewDate(now)
+
+	if shd != nil && p.Expired && shd.AccountExpiration.Days() > 0 && !today.Before(shd.AccountExpiration) {
+		reasons = append(reasons, fmt.Sprintf("account expired on %s", date(shd.AccountExpiration.Time())))
+	}
+
+	if shd != nil && p.PasswordInactive {
+		if disabled, ok := passwordDisabled(shd); ok && !today.Before(disabled) {
+			reasons = append(reasons, fmt.Sprintf("password inactive since %s", date(disabled.Time())))
+		}
+	}
+
+	if p.InactiveDays < 0 {
+		return reasons
+	}
+
+	since := lastLogin
+	if since.IsZero() && p.NeverLoggedIn && shd != nil && !shd.LastPasswordChange.IsUnset() && !shd.LastPasswordChange.MustChange() {
+		since = shd.LastPasswordChange.Time()
+	}
+
+	if since.IsZero() {
+		return reasons
+	}
+
+	if days := int(now.Sub(since).Hours() / 24); days >= p.InactiveDays {
+		if lastLogin.IsZero() {
+			reasons = append(reasons, fmt.Sprintf("never logged in, password set %d days ago", days))
+		} else {
+			reasons = append(reasons, fmt.Sprintf("no login for %d days", days))
+		}
+	}
+
+	return reasons
+}
+
+// passwordDisabled returns the day an account is disabled because its
+// password expired longer than the inactivity period ago.
+func passwordDisabled(shd *shadow.Entry) (shadow.Date, bool) {
+	if shd.LastPasswordChange.IsUnset() || shd.LastPasswordChange.MustChange() || shd.MaximumPasswordAge == nil || shd.InactivityPeriod == nil {
+		return shadow.DateUnset, false
+	}
+
+	days := (*shd.MaximumPasswordAge + *shd.InactivityPeriod) / (24 * time.Hour)
+	return shd.LastPasswordChange.AddDays(int(days)), true
+}
+
+// yes returns true for "yes", like login.defs booleans.
+func yes(value string) bool {
+	return strings.ToLower(value) == "yes"
+}
+
+// date formats a day like the shadow tools do.
+func date(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
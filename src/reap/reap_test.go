@@ -0,0 +1,63 @@
+package reap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/shadow"
+)
+
+func TestUnmarshal(t *testing.T) {
+	p := Default()
+	data := "# reap policy\nINACTIVE_DAYS=30\nEXCLUDE=root, deploy\nACTION=lock\nEXPIRED=no\nBOGUS=1\n"
+	if err := Unmarshal([]byte(data), p); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.InactiveDays != 30 || p.Action != ActionLock || p.Expired || !p.Excluded("deploy") || p.Excluded("alice") {
+		t.Errorf("unexpected policy %#v", p)
+	}
+
+	if len(p.Errors) != 1 {
+		t.Errorf("expected one error, got %v", p.Errors)
+	}
+}
+
+func TestReasons(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	today := shadow.NewDate(now)
+	days := func(n int) *time.Duration {
+		d := time.Duration(n) * 24 * time.Hour
+		return &d
+	}
+
+	tests := []struct {
+		Shadow    *shadow.Entry
+		LastLogin time.Time
+		Want      int
+	}{
+		// Logged in recently.
+		{Shadow: &shadow.Entry{LastPasswordChange: today.AddDays(-200)}, LastLogin: now.AddDate(0, 0, -10), Want: 0},
+		// No login for 100 days.
+		{Shadow: &shadow.Entry{LastPasswordChange: today.AddDays(-200)}, LastLogin: now.AddDate(0, 0, -100), Want: 1},
+		// Never logged in, password set long ago.
+		{Shadow: &shadow.Entry{LastPasswordChange: today.AddDays(-100)}, Want: 1},
+		// Never logged in, but new.
+		{Shadow: &shadow.Entry{LastPasswordChange: today.AddDays(-5)}, Want: 0},
+		// Expired today.
+		{Shadow: &shadow.Entry{LastPasswordChange: today, AccountExpiration: today}, Want: 1},
+		// Expires tomorrow.
+		{Shadow: &shadow.Entry{LastPasswordChange: today, AccountExpiration: today.AddDays(1)}, Want: 0},
+		// Password expired 60 days ago with a 30 day inactivity period.
+		{Shadow: &shadow.Entry{LastPasswordChange: today.AddDays(-150), MaximumPasswordAge: days(90), InactivityPeriod: days(30)}, LastLogin: now, Want: 1},
+		// No shadow entry and no logins.
+		{Shadow: nil, Want: 0},
+	}
+
+	p := Default()
+	for testNum, test := range tests {
+		if reasons := p.Reasons(now, test.Shadow, test.LastLogin); len(reasons) != test.Want {
+			t.Errorf("%d) expected %d reasons, got %v", testNum, test.Want, reasons)
+		}
+	}
+}
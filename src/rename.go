@@ -0,0 +1,205 @@
+package wonka
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/cron"
+	"github.com/mikemackintosh/wonka/src/home"
+	"github.com/mikemackintosh/wonka/src/mail"
+	"github.com/mikemackintosh/wonka/src/managed"
+)
+
+// RenameOptions control the optional parts of Rename.
+type RenameOptions struct {
+	// MoveHome moves the home directory to HomeDir. When HomeDir is empty,
+	// a home named after the user is renamed alongside it.
+	MoveHome bool
+	HomeDir  string
+	// Force renames the user even while it is logged in or has running
+	// processes. Kill terminates them instead, see DeleteOptions.
+	Force bool
+	Kill  bool
+	Grace time.Duration
+}
+
+// Rename renames a user in passwd, shadow, the group and gshadow member
+// lists, the subordinate ID files, its mail spool and crontab, and
+// optionally its home directory. Everything is checked before anything is
+// changed, and the changes are applied together by Save, which rolls them
+// all back if one fails. Every change is returned.
+func (i *Instance) Rename(old, new string, opts RenameOptions) ([]Change, error) {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return nil, errNotLoaded
+	}
+
+	if err := ValidName(new); err != nil {
+		return nil, err
+	}
+
+	entry := i.Passwd.GetUser(old)
+	if entry == nil {
+		return nil, &ErrNotFound{fmt.Sprintf("user %s does not exist", old)}
+	}
+
+	if i.Passwd.GetUser(new) != nil {
+		return nil, &ErrExists{fmt.Sprintf("user %s already exists", new)}
+	}
+
+	if err := i.checkBusy(old, entry.UID, opts.Force, opts.Kill, opts.Grace); err != nil {
+		return nil, err
+	}
+
+	dir, err := i.renamedHome(entry.HomeDir, old, new, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	spool, err := i.spoolExists(old)
+	if err != nil {
+		return nil, err
+	}
+
+	crontabs := cron.Find(i.Options.Root, old)
+	if err := i.checkRenameTargets(new, spool, crontabs); err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	record := func(target, format string, args ...interface{}) {
+		changes = append(changes, Change{target, fmt.Sprintf(format, args...)})
+	}
+
+	entry.Username = new
+	record(i.Options.filePasswd, "renamed user %s to %s", old, new)
+
+	if shd := i.Shadow.GetUserEntry(old); shd != nil {
+		shd.Username = new
+		record(i.Options.fileShadow, "renamed user %s to %s", old, new)
+	}
+
+	for _, group := range *i.Groups {
+		if group.RenameUser(old, new) {
+			record(i.Options.fileGroups, "renamed member %s to %s in group %s", old, new, group.Name)
+		}
+	}
+
+	if i.Gshadow != nil {
+		for _, group := range *i.Gshadow {
+			if group.RenameUser(old, new) {
+				record(i.Options.fileGshadow, "renamed member %s to %s in group %s", old, new, group.Name)
+			}
+		}
+	}
+
+	if i.Subuid != nil && i.Subuid.Rename(old, new) > 0 {
+		record(i.Options.fileSubuid, "renamed ranges of %s to %s", old, new)
+	}
+
+	if i.Subgid != nil && i.Subgid.Rename(old, new) > 0 {
+		record(i.Options.fileSubgid, "renamed ranges of %s to %s", old, new)
+	}
+
+	if i.Managed != nil && i.Managed.Has(managed.KindUser, old) {
+		i.Managed.Rename(managed.KindUser, old, new)
+		record(i.Options.fileManaged, "renamed managed user %s to %s", old, new)
+	}
+
+	if spool {
+		i.after(func() error {
+			return mail.Rename(i.Options.Root, i.Policy.MailDir, old, new)
+		}, func() error {
+			return mail.Rename(i.Options.Root, i.Policy.MailDir, new, old)
+		})
+		record(filepath.Join(i.Policy.MailDir, old), "renamed mail spool to %s", filepath.Join(i.Policy.MailDir, new))
+	}
+
+	for _, crontab := range crontabs {
+		crontab := crontab
+		i.after(func() error {
+			return cron.Rename(i.Options.Root, crontab, old, new)
+		}, func() error {
+			return cron.Rename(i.Options.Root, crontab, new, old)
+		})
+		record(filepath.Join(crontab, old), "renamed crontab to %s", filepath.Join(crontab, new))
+	}
+
+	if len(dir) > 0 {
+		previous := entry.HomeDir
+		if err := i.MoveHome(new, dir, true); err != nil {
+			return nil, err
+		}
+		record(previous, "moved home directory to %s", dir)
+	}
+
+	return changes, nil
+}
+
+// renamedHome returns where the home directory moves to, or an empty string
+// if it stays put. The move is checked up front so a refusal changes
+// nothing.
+func (i *Instance) renamedHome(current, old, new string, opts RenameOptions) (string, error) {
+	if !opts.MoveHome || len(current) == 0 {
+		return "", nil
+	}
+
+	dir := opts.HomeDir
+	if len(dir) == 0 {
+		if filepath.Base(current) != old {
+			return "", nil
+		}
+		dir = filepath.Join(filepath.Dir(current), new)
+	}
+
+	if dir == current {
+		return "", nil
+	}
+
+	if err := home.CheckRemovable(i.Options.Root, i.Defaults.Home, current, old, *i.Passwd); err != nil {
+		return "", err
+	}
+
+	target, err := home.Resolve(i.Options.Root, dir)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Lstat(target); err == nil {
+		return "", &ErrExists{fmt.Sprintf("home directory %s already exists", dir)}
+	}
+
+	return dir, nil
+}
+
+// spoolExists returns true if name has a mail spool.
+func (i *Instance) spoolExists(name string) (bool, error) {
+	if len(i.Policy.MailDir) == 0 {
+		return false, nil
+	}
+
+	path, err := mail.Path(i.Options.Root, i.Policy.MailDir, name)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Lstat(path)
+	return err == nil, nil
+}
+
+// checkRenameTargets makes sure no spool or crontab for the new name is in
+// the way.
+func (i *Instance) checkRenameTargets(new string, spool bool, crontabs []string) error {
+	if exists, err := i.spoolExists(new); err != nil {
+		return err
+	} else if spool && exists {
+		return &ErrExists{fmt.Sprintf("mail spool for %s already exists", new)}
+	}
+
+	if len(crontabs) > 0 && len(cron.Find(i.Options.Root, new)) > 0 {
+		return &ErrExists{fmt.Sprintf("crontab for %s already exists", new)}
+	}
+
+	return nil
+}
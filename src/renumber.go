@@ -0,0 +1,221 @@
+package wonka
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mikemackintosh/wonka/src/home"
+	"github.com/mikemackintosh/wonka/src/owner"
+)
+
+// RenumberOptions control the ownership fix-up done after an ID changes.
+type RenumberOptions struct {
+	// Paths are extra trees below the root to fix, besides the home
+	// directory and mail spool.
+	Paths []string
+	// Skip lists paths below the root which are left alone.
+	Skip []string
+	// DryRun reports the changes without making them.
+	DryRun bool
+}
+
+// RenumberUser changes the UID of a user, then, when Save runs, chowns the
+// files owned by the old UID in its home, its mail spool and the extra
+// paths. Every database change and every file to be chowned is returned.
+func (i *Instance) RenumberUser(name string, uid int, opts RenumberOptions) ([]Change, error) {
+	if i.Passwd == nil {
+		return nil, errNotLoaded
+	}
+
+	entry := i.Passwd.GetUser(name)
+	if entry == nil {
+		return nil, &ErrNotFound{fmt.Sprintf("user %s does not exist", name)}
+	}
+
+	if entry.UID == uid {
+		return nil, nil
+	}
+
+	if other := i.Passwd.GetUserByID(uid); other != nil {
+		return nil, &ErrExists{fmt.Sprintf("uid %d is used by %s", uid, other.Username)}
+	}
+
+	paths := append([]string{}, opts.Paths...)
+	if len(entry.HomeDir) > 0 {
+		paths = append(paths, entry.HomeDir)
+	}
+
+	if len(i.Policy.MailDir) > 0 {
+		paths = append(paths, filepath.Join(i.Policy.MailDir, name))
+	}
+
+	changes := []Change{{i.Options.filePasswd, fmt.Sprintf("changed uid of %s from %d to %d", name, entry.UID, uid)}}
+	fixup := &owner.Fixup{OldUID: entry.UID, NewUID: uid, OldGID: -1, NewGID: -1}
+
+	files, err := i.fixOwnership(fixup, paths, opts)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, files...)
+
+	if !opts.DryRun {
+		entry.UID = uid
+	}
+
+	return changes, nil
+}
+
+// RenumberGroup changes the GID of a group and of every user using it as
+// their primary group, then, when Save runs, chowns the files with the old
+// GID in the extra paths and the homes and mail spools of those users.
+// Every database change and every file to be chowned is returned.
+func (i *Instance) RenumberGroup(name string, gid int, opts RenumberOptions) ([]Change, error) {
+	if i.Passwd == nil || i.Groups == nil {
+		return nil, errNotLoaded
+	}
+
+	group := i.Groups.GetGroup(name)
+	if group == nil {
+		return nil, &ErrNotFound{fmt.Sprintf("group %s does not exist", name)}
+	}
+
+	if group.GID == gid {
+		return nil, nil
+	}
+
+	if other := i.Groups.GetGroupByID(gid); other != nil {
+		return nil, &ErrExists{fmt.Sprintf("gid %d is used by %s", gid, other.Name)}
+	}
+
+	changes := []Change{{i.Options.fileGroups, fmt.Sprintf("changed gid of %s from %d to %d", name, group.GID, gid)}}
+	paths := append([]string{}, opts.Paths...)
+
+	var users []int
+	for n, user := range *i.Passwd {
+		if user.GID != group.GID {
+			continue
+		}
+
+		users = append(users, n)
+		changes = append(changes, Change{i.Options.filePasswd, fmt.Sprintf("changed primary gid of %s from %d to %d", user.Username, group.GID, gid)})
+
+		if len(user.HomeDir) > 0 {
+			paths = append(paths, user.HomeDir)
+		}
+
+		if len(i.Policy.MailDir) > 0 {
+			paths = append(paths, filepath.Join(i.Policy.MailDir, user.Username))
+		}
+	}
+
+	fixup := &owner.Fixup{OldUID: -1, NewUID: -1, OldGID: group.GID, NewGID: gid}
+	files, err := i.fixOwnership(fixup, paths, opts)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, files...)
+
+	if !opts.DryRun {
+		for _, n := range users {
+			(*i.Passwd)[n].GID = gid
+		}
+		group.GID = gid
+	}
+
+	return changes, nil
+}
+
+// fixOwnership lists the files the fix-up would change, and unless this is
+// a dry run, queues the real fix-up for Save, with a revert if a later
+// change fails.
+func (i *Instance) fixOwnership(fixup *owner.Fixup, paths []string, opts RenumberOptions) ([]Change, error) {
+	roots, err := i.resolvePaths(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	skip, err := i.resolvePaths(opts.Skip)
+	if err != nil {
+		return nil, err
+	}
+	fixup.Skip = skip
+
+	// Walk once without changing anything to report what will change.
+	dry := *fixup
+	dry.DryRun = true
+
+	var changes []Change
+	for _, root := range roots {
+		files, err := dry.Walk(root)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			rel, _ := filepath.Rel(i.Options.Root, file)
+			changes = append(changes, Change{filepath.Join("/", rel), describe(fixup)})
+		}
+	}
+
+	if opts.DryRun {
+		return changes, nil
+	}
+
+	var changed []string
+	i.after(func() error {
+		for _, root := range roots {
+			files, err := fixup.Walk(root)
+			changed = append(changed, files...)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func() error {
+		return fixup.Revert(changed)
+	})
+
+	return changes, nil
+}
+
+// resolvePaths resolves paths below the root, dropping duplicates and paths
+// inside another path in the list.
+func (i *Instance) resolvePaths(paths []string) ([]string, error) {
+	var resolved []string
+	for _, path := range paths {
+		p, err := home.Resolve(i.Options.Root, path)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, p)
+	}
+
+	sort.Strings(resolved)
+
+	var out []string
+	for _, p := range resolved {
+		if len(out) > 0 && (p == out[len(out)-1] || below(out[len(out)-1], p)) {
+			continue
+		}
+		out = append(out, p)
+	}
+
+	return out, nil
+}
+
+// describe returns what a fix-up does to a file.
+func describe(f *owner.Fixup) string {
+	if f.OldUID >= 0 {
+		return fmt.Sprintf("chown uid %d to %d", f.OldUID, f.NewUID)
+	}
+
+	return fmt.Sprintf("chgrp gid %d to %d", f.OldGID, f.NewGID)
+}
+
+// below returns true if path is inside base.
+func below(base, path string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(base, string(filepath.Separator))+string(filepath.Separator))
+}
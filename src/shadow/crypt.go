@@ -0,0 +1,37 @@
+package shadow
+
+import (
+	"fmt"
+	"strings"
+
+	r "github.com/mikemackintosh/wonka/src/libs/rand"
+	"github.com/tredoe/osutil/user/crypt"
+	"github.com/tredoe/osutil/user/crypt/md5_crypt"
+	"github.com/tredoe/osutil/user/crypt/sha256_crypt"
+	"github.com/tredoe/osutil/user/crypt/sha512_crypt"
+)
+
+// hashPassword hashes password with the login.defs ENCRYPT_METHOD. An empty
+// method uses SHA512, and rounds below 1 use the library default.
+func hashPassword(method string, rounds int, password string) (string, error) {
+	var cryptor crypt.Crypter
+	var salt string
+
+	switch strings.ToUpper(method) {
+	case "", "SHA512":
+		cryptor, salt = sha512_crypt.New(), "$6$"
+	case "SHA256":
+		cryptor, salt = sha256_crypt.New(), "$5$"
+	case "MD5":
+		cryptor, salt = md5_crypt.New(), "$1$"
+		rounds = 0
+	default:
+		return "", fmt.Errorf("unsupported encrypt method %s", method)
+	}
+
+	if rounds > 0 {
+		salt += fmt.Sprintf("rounds=%d$", rounds)
+	}
+
+	return cryptor.Generate([]byte(password), []byte(salt+r.String(8)))
+}
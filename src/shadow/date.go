@@ -0,0 +1,106 @@
+package shadow
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+// Date is a day-precision date as stored in the shadow file, counted in days
+// since Jan 1, 1970 UTC. The zero value is unset, which is written as an
+// empty field.
+type Date struct {
+	days int64
+	set  bool
+}
+
+var (
+	// DateUnset represents an empty date field.
+	DateUnset = Date{}
+
+	// DateMustChange is the special lastchange value of 0, which forces the
+	// user to change their password on next login.
+	DateMustChange = Date{days: 0, set: true}
+)
+
+// NewDate returns the Date containing the provided time, in UTC.
+func NewDate(t time.Time) Date {
+	secs := t.Unix()
+	days := secs / secondsPerDay
+	if secs%secondsPerDay < 0 {
+		days--
+	}
+
+	return Date{days: days, set: true}
+}
+
+// DateFromDays returns a Date from a count of days since the epoch.
+func DateFromDays(days int64) Date {
+	return Date{days: days, set: true}
+}
+
+// Today returns the current Date.
+func Today() Date {
+	return NewDate(time.Now())
+}
+
+// ParseDate will parse a shadow date field. An empty field returns DateUnset.
+func ParseDate(field string) (Date, error) {
+	if len(field) == 0 {
+		return DateUnset, nil
+	}
+
+	days, err := strconv.ParseInt(field, 10, 64)
+	if err != nil {
+		return DateUnset, fmt.Errorf("invalid date %q", field)
+	}
+
+	return DateFromDays(days), nil
+}
+
+// IsUnset returns true if the field is empty.
+func (d Date) IsUnset() bool {
+	return !d.set
+}
+
+// MustChange returns true if the date is the special value 0. In the
+// lastchange field, this forces a password change on next login.
+func (d Date) MustChange() bool {
+	return d.set && d.days == 0
+}
+
+// Days returns the number of days since the epoch. Unset dates return 0, so
+// check IsUnset first.
+func (d Date) Days() int64 {
+	return d.days
+}
+
+// Time returns midnight UTC of the date. Unset dates return the zero time.
+func (d Date) Time() time.Time {
+	if !d.set {
+		return time.Time{}
+	}
+
+	return time.Unix(d.days*secondsPerDay, 0).UTC()
+}
+
+// AddDays returns the date n days later.
+func (d Date) AddDays(n int) Date {
+	return Date{days: d.days + int64(n), set: d.set}
+}
+
+// Before returns true if d is set and falls before other.
+func (d Date) Before(other Date) bool {
+	return d.set && other.set && d.days < other.days
+}
+
+// String returns the date formatted as a shadow field.
+func (d Date) String() string {
+	if !d.set {
+		return ""
+	}
+
+	return strconv.FormatInt(d.days, 10)
+}
@@ -9,8 +9,7 @@ import (
 	"time"
 
 	"github.com/mikemackintosh/wonka/src/libs/locker"
-	r "github.com/mikemackintosh/wonka/src/libs/rand"
-	"github.com/tredoe/osutil/user/crypt/sha512_crypt"
+	"github.com/mikemackintosh/wonka/src/logindefs"
 )
 
 const FILE_SHADOW = "/etc/shadow"
@@ -21,14 +20,53 @@ type Entry struct {
 	Username           string
 	Password           string
 	PasswordUpdated    bool
-	LastPasswordChange time.Time
+	LastPasswordChange Date
 	MinimumPasswordAge *time.Duration
 	MaximumPasswordAge *time.Duration
 	WarningPeriod      *time.Duration
 	InactivityPeriod   *time.Duration
-	ExpirationPeriod   *time.Duration
+	AccountExpiration  Date
 	Unused             interface{}
 	Errors             []error
+
+	// EncryptMethod and Rounds are used to hash updated passwords. They
+	// default to SHA512 with the library rounds.
+	EncryptMethod string
+	Rounds        int
+}
+
+// NewEntry returns an Entry for username with the password aging and
+// hashing defaults from the provided login.defs policy. The account is
+// locked until a password is set.
+func NewEntry(username string, policy *logindefs.Policy) *Entry {
+	if policy == nil {
+		policy = logindefs.Default()
+	}
+
+	e := &Entry{
+		Username:           username,
+		Password:           "!",
+		LastPasswordChange: Today(),
+		EncryptMethod:      policy.EncryptMethod,
+		Rounds:             policy.CryptRounds(),
+	}
+
+	if policy.PassMinDays >= 0 {
+		d := time.Duration(policy.PassMinDays) * 24 * time.Hour
+		e.MinimumPasswordAge = &d
+	}
+
+	if policy.PassMaxDays >= 0 {
+		d := time.Duration(policy.PassMaxDays) * 24 * time.Hour
+		e.MaximumPasswordAge = &d
+	}
+
+	if policy.PassWarnAge >= 0 {
+		d := time.Duration(policy.PassWarnAge) * 24 * time.Hour
+		e.WarningPeriod = &d
+	}
+
+	return e
 }
 
 // Unmarshal will unmarshal a provided passwd formatted file.
@@ -51,13 +89,17 @@ func Unmarshal(data []byte, dest interface{}) error {
 		}
 
 		var errs []error
-		var lastChange time.Time
 		var day = time.Duration(24) * time.Hour
 
 		// Split the lines on the delim, ":".
 		parts := strings.Split(line, ":")
 		if len(parts) < 8 {
 			errs = append(errs, errors.New("shadow entry has less than 8 segments"))
+
+			// Pad the missing fields so they parse as unset.
+			for len(parts) < 8 {
+				parts = append(parts, "")
+			}
 		}
 
 		// Populate the new entry.
@@ -72,16 +114,13 @@ func Unmarshal(data []byte, dest interface{}) error {
 		// Check if password is provided or not.
 		entry.Password = parts[1]
 
-		// Check if lastPasswordChange is a valid int or not.
-		if len(parts[2]) > 0 {
-			lastChangeDays, err := strconv.Atoi(parts[2])
-			if err != nil {
-				errs = append(errs, errors.New("invalid lastPasswordChange"))
-			}
-			fd := (time.Duration(lastChangeDays) * time.Hour * 24)
-			lastChange = time.Unix(0, 0).Add(fd)
-			entry.LastPasswordChange = lastChange
+		// Check if lastPasswordChange is a valid date or not. An empty field
+		// is unset, while 0 forces a change on next login.
+		lastChange, err := ParseDate(parts[2])
+		if err != nil {
+			errs = append(errs, errors.New("invalid lastPasswordChange"))
 		}
+		entry.LastPasswordChange = lastChange
 
 		// Check if the minAge is a valid int.
 		if len(parts[3]) > 0 {
@@ -123,13 +162,16 @@ func Unmarshal(data []byte, dest interface{}) error {
 			entry.InactivityPeriod = &inactivity
 		}
 
-		if len(parts[7]) > 0 {
-			expirationField, err := strconv.Atoi(parts[7])
-			if err != nil {
-				errs = append(errs, errors.New("invalid expiration"))
-			}
-			expiration := time.Duration(expirationField) * day
-			entry.ExpirationPeriod = &expiration
+		// The expiration is an absolute date, not a period.
+		expiration, err := ParseDate(parts[7])
+		if err != nil {
+			errs = append(errs, errors.New("invalid expiration"))
+		}
+		entry.AccountExpiration = expiration
+
+		// Keep the reserved field so it can be written back untouched.
+		if len(parts) > 8 && len(parts[8]) > 0 {
+			entry.Unused = parts[8]
 		}
 
 		if len(errs) > 0 {
@@ -164,20 +206,18 @@ func Marshal(in Entries) ([]byte, error) {
 		}
 		line = append(line, entry.Username)
 
+		// UpdatePassword hashes the password already, this only covers
+		// entries whose password was set without it.
 		var password = entry.Password
 		if entry.PasswordUpdated {
-			cryptor := sha512_crypt.New()
-
-			password, err = cryptor.Generate([]byte(entry.Password), []byte("$6$"+r.String(8)))
+			password, err = hashPassword(entry.EncryptMethod, entry.Rounds, entry.Password)
 			if err != nil {
 				return nil, fmt.Errorf("error generating password, %s", err)
 			}
-
-			entry.LastPasswordChange = time.Now()
 		}
 		line = append(line, password)
 
-		line = append(line, fmt.Sprintf("%d", int(entry.LastPasswordChange.Sub(time.Unix(0, 0)).Hours()/24)))
+		line = append(line, entry.LastPasswordChange.String())
 
 		if entry.MinimumPasswordAge != nil {
 			line = append(line, fmt.Sprintf("%d", int(entry.MinimumPasswordAge.Hours()/24)))
@@ -203,15 +243,15 @@ func Marshal(in Entries) ([]byte, error) {
 			line = append(line, "")
 		}
 
-		if entry.ExpirationPeriod != nil {
-			line = append(line, fmt.Sprintf("%d", int(entry.ExpirationPeriod.Hours()/24)))
+		line = append(line, entry.AccountExpiration.String())
+
+		// Unused segment
+		if unused, ok := entry.Unused.(string); ok {
+			line = append(line, unused)
 		} else {
 			line = append(line, "")
 		}
 
-		// Unused segment
-		line = append(line, "")
-
 		out = append(out, strings.Join(line, ":"))
 	}
 
@@ -221,13 +261,18 @@ func Marshal(in Entries) ([]byte, error) {
 
 // Save will take in entries.
 func (e Entries) Save() error {
+	return e.SaveToFile(FILE_SHADOW)
+}
+
+// SaveToFile will write the entries to the provided file.
+func (e Entries) SaveToFile(file string) error {
 	b, err := e.Marshal()
 	if err != nil {
 		return err
 	}
 
 	// Will write the entries list with.
-	if err = locker.WriteWithLock(FILE_SHADOW, b); err != nil {
+	if err = locker.WriteWithLock(file, b); err != nil {
 		return err
 	}
 
@@ -236,7 +281,13 @@ func (e Entries) Save() error {
 
 // LoadFromDisk will read an /etc/passwd file and return parsed Entries or error.
 func LoadFromDisk() (*Entries, error) {
-	b, err := ioutil.ReadFile(FILE_SHADOW)
+	return LoadFromFile(FILE_SHADOW)
+}
+
+// LoadFromFile will read the provided /etc/shadow formatted file and return parsed
+// Entries or error.
+func LoadFromFile(file string) (*Entries, error) {
+	b, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
@@ -275,10 +326,34 @@ func (e *Entries) RemoveEntry(rm *Entry) error {
 	return &ErrNotFound{"entry not found"}
 }
 
-// UpdatePassword will update the password.
+// UpdatePassword will hash and update the password with the entry's
+// EncryptMethod and Rounds. If hashing fails the password is kept in clear
+// with PasswordUpdated set, so Marshal retries and reports the error.
 func (e *Entry) UpdatePassword(password string) {
-	e.PasswordUpdated = true
-	e.Password = password
+	e.LastPasswordChange = Today()
+
+	hash, err := hashPassword(e.EncryptMethod, e.Rounds, password)
+	if err != nil {
+		e.Password = password
+		e.PasswordUpdated = true
+		return
+	}
+
+	e.Password = hash
+	e.PasswordUpdated = false
+}
+
+// Lock will disable password logins by prefixing the hash with "!", like
+// usermod -L. Locking twice has no further effect.
+func (e *Entry) Lock() {
+	if !e.IsLocked() {
+		e.Password = "!" + e.Password
+	}
+}
+
+// IsLocked returns true if the password starts with "!".
+func (e *Entry) IsLocked() bool {
+	return strings.HasPrefix(e.Password, "!")
 }
 
 //GetUserEntry will search the entries list for a user.
@@ -0,0 +1,186 @@
+package shadow
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/logindefs"
+)
+
+func TestUnmarshalDates(t *testing.T) {
+	tests := []struct {
+		Have       []byte
+		LastChange Date
+		Expiration Date
+	}{
+		{
+			Have:       []byte("root:*:18198:0:99999:7:::"),
+			LastChange: DateFromDays(18198),
+			Expiration: DateUnset,
+		},
+		{
+			Have:       []byte("alice:!:0:0:99999:7::19000:"),
+			LastChange: DateMustChange,
+			Expiration: DateFromDays(19000),
+		},
+		{
+			Have:       []byte("bob:!:::::::"),
+			LastChange: DateUnset,
+			Expiration: DateUnset,
+		},
+	}
+
+	for testNum, test := range tests {
+		var entries Entries
+		if err := Unmarshal(test.Have, &entries); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 1 {
+			t.Fatalf("%d) expected 1 entry, got %d", testNum, len(entries))
+		}
+
+		if entries[0].LastPasswordChange != test.LastChange {
+			t.Errorf("%d) expected lastchange %#v, got %#v", testNum, test.LastChange, entries[0].LastPasswordChange)
+		}
+
+		if entries[0].AccountExpiration != test.Expiration {
+			t.Errorf("%d) expected expiration %#v, got %#v", testNum, test.Expiration, entries[0].AccountExpiration)
+		}
+	}
+
+	if !DateMustChange.MustChange() || DateUnset.MustChange() {
+		t.Error("expected only DateMustChange to require a change")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := [][]byte{
+		[]byte("root:*:18198:0:99999:7:::\n"),
+		[]byte("alice:$6$salt$hash:0:0:99999:7::19000:\n"),
+		[]byte("bob:!::::::1:\n"),
+		[]byte("carol:!!:18000:1:90:14:30:0:reserved\n"),
+	}
+
+	for testNum, test := range tests {
+		var entries Entries
+		if err := Unmarshal(test, &entries); err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := entries.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(output, test) {
+			t.Errorf("%d) expected %q, got %q", testNum, test, output)
+		}
+	}
+}
+
+func TestNewDate(t *testing.T) {
+	// The same instant must land on the same day regardless of location.
+	loc := time.FixedZone("UTC-10", -10*60*60)
+	instant := time.Date(2020, time.January, 1, 23, 0, 0, 0, time.UTC)
+
+	if NewDate(instant) != NewDate(instant.In(loc)) {
+		t.Fatal("expected dates to match across time zones")
+	}
+
+	if NewDate(instant).Days() != 18262 {
+		t.Errorf("expected 18262, got %d", NewDate(instant).Days())
+	}
+
+	if !NewDate(instant).Time().Equal(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time %s", NewDate(instant).Time())
+	}
+}
+
+func TestNewEntryPolicy(t *testing.T) {
+	policy := logindefs.Default()
+	policy.PassMaxDays = 90
+	policy.EncryptMethod = "SHA256"
+
+	entry := NewEntry("alice", policy)
+	if entry.MaximumPasswordAge == nil || *entry.MaximumPasswordAge != 90*24*time.Hour {
+		t.Errorf("expected max age of 90 days, got %v", entry.MaximumPasswordAge)
+	}
+
+	if entry.MinimumPasswordAge != nil {
+		t.Errorf("expected no min age, got %v", entry.MinimumPasswordAge)
+	}
+
+	entry.UpdatePassword("secret")
+	output, err := Entries{entry}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(output), "alice:$5$") {
+		t.Errorf("expected a SHA256 hash, got %s", output)
+	}
+}
+
+func TestUpdatePasswordUnsupportedMethod(t *testing.T) {
+	policy := logindefs.Default()
+	if err := logindefs.Unmarshal([]byte("ENCRYPT_METHOD YESCRYPT\n"), policy); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := NewEntry("alice", policy)
+	entry.UpdatePassword("secret")
+	output, err := Entries{entry}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(output), "alice:$6$") {
+		t.Errorf("expected a SHA512 hash, got %s", output)
+	}
+}
+
+func TestUnmarshalShortLine(t *testing.T) {
+	var entries Entries
+	if err := Unmarshal([]byte("alice:!:18000\nbob\n"), &entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	for _, entry := range entries {
+		if len(entry.Errors) == 0 {
+			t.Errorf("expected errors for %s", entry.Username)
+		}
+	}
+
+	if entries[0].LastPasswordChange != DateFromDays(18000) || entries[0].AccountExpiration != DateUnset {
+		t.Errorf("unexpected dates %#v", entries[0])
+	}
+}
+
+func TestMarshalKeepsEntry(t *testing.T) {
+	entry := &Entry{Username: "alice", Password: "secret", PasswordUpdated: true}
+	output, err := Entries{entry}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(output), "alice:$6$") {
+		t.Errorf("expected a SHA512 hash, got %s", output)
+	}
+
+	if entry.Password != "secret" || !entry.PasswordUpdated || entry.LastPasswordChange != DateUnset {
+		t.Errorf("expected Marshal to leave the entry alone, got %#v", entry)
+	}
+
+	entry = NewEntry("bob", nil)
+	entry.UpdatePassword("secret")
+	if entry.PasswordUpdated || !strings.HasPrefix(entry.Password, "$6$") {
+		t.Errorf("expected UpdatePassword to hash, got %#v", entry)
+	}
+}
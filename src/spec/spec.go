@@ -0,0 +1,173 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// States of a user or group.
+const (
+	StatePresent = "present"
+	StateAbsent  = "absent"
+)
+
+// Spec is the desired state of users, groups and memberships, kept as a
+// JSON file:
+//
+//	{
+//	  "groups": [{"name": "developers", "gid": 2000}],
+//	  "users": [{"name": "alice", "groups": ["developers"], "shell": "/bin/bash"}]
+//	}
+type Spec struct {
+	Groups []Group `json:"groups,omitempty"`
+	Users  []User  `json:"users,omitempty"`
+}
+
+// User is the desired state of an account. Empty fields are left alone on
+// existing accounts, and filled from the defaults for new ones.
+type User struct {
+	Name  string `json:"name"`
+	State string `json:"state,omitempty"`
+	UID   *int   `json:"uid,omitempty"`
+	// Group is the primary group name.
+	Group string `json:"group,omitempty"`
+	// Groups are the supplementary groups. When set, the user is removed
+	// from groups which are not listed.
+	Groups []string `json:"groups,omitempty"`
+	Info   string   `json:"info,omitempty"`
+	Home   string   `json:"home,omitempty"`
+	Shell  string   `json:"shell,omitempty"`
+	// Password is a crypt(3) hash, never a clear text password.
+	Password   string `json:"password,omitempty"`
+	System     bool   `json:"system,omitempty"`
+	CreateHome *bool  `json:"create_home,omitempty"`
+}
+
+// Group is the desired state of a group.
+type Group struct {
+	Name  string `json:"name"`
+	State string `json:"state,omitempty"`
+	GID   *int   `json:"gid,omitempty"`
+	// Members, when set, is the complete member list, along with the users
+	// listing the group in their groups. When nil, members are left alone.
+	Members []string `json:"members,omitempty"`
+	System  bool     `json:"system,omitempty"`
+}
+
+// Present returns true unless the user is to be removed.
+func (u *User) Present() bool {
+	return u.State != StateAbsent
+}
+
+// Present returns true unless the group is to be removed.
+func (g *Group) Present() bool {
+	return g.State != StateAbsent
+}
+
+// Unmarshal will unmarshal a JSON spec, rejecting unknown fields so typos
+// do not go unnoticed.
+func Unmarshal(data []byte, dest interface{}) error {
+	switch dest.(type) {
+	case *Spec:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of spec.Spec")
+	}
+
+	s := dest.(*Spec)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(s); err != nil {
+		return err
+	}
+
+	return s.Validate()
+}
+
+// Marshal will encode a spec as indented JSON.
+func Marshal(s *Spec) ([]byte, error) {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
+
+// LoadFromFile will read a JSON spec.
+func LoadFromFile(file string) (*Spec, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Spec
+	if err := Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	return &s, nil
+}
+
+// Validate checks for missing or duplicate names and unknown states.
+func (s *Spec) Validate() error {
+	seen := map[string]bool{}
+	for _, g := range s.Groups {
+		if err := check("group", g.Name, g.State, seen); err != nil {
+			return err
+		}
+	}
+
+	seen = map[string]bool{}
+	for _, u := range s.Users {
+		if err := check("user", u.Name, u.State, seen); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetUser returns the user called name, or nil.
+func (s *Spec) GetUser(name string) *User {
+	for n := range s.Users {
+		if s.Users[n].Name == name {
+			return &s.Users[n]
+		}
+	}
+
+	return nil
+}
+
+// GetGroup returns the group called name, or nil.
+func (s *Spec) GetGroup(name string) *Group {
+	for n := range s.Groups {
+		if s.Groups[n].Name == name {
+			return &s.Groups[n]
+		}
+	}
+
+	return nil
+}
+
+// check validates one name and state.
+func check(kind, name, state string, seen map[string]bool) error {
+	if len(name) == 0 {
+		return fmt.Errorf("%s without a name", kind)
+	}
+
+	if seen[name] {
+		return fmt.Errorf("%s %s is listed twice", kind, name)
+	}
+	seen[name] = true
+
+	switch state {
+	case "", StatePresent, StateAbsent:
+		return nil
+	}
+
+	return fmt.Errorf("%s %s has unknown state %q", kind, name, state)
+}
@@ -0,0 +1,35 @@
+package spec
+
+import "testing"
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		Have string
+		Want bool
+	}{
+		{Have: `{"users": [{"name": "alice", "groups": ["staff"]}], "groups": [{"name": "staff", "members": []}]}`, Want: true},
+		{Have: `{"users": [{"name": "alice", "state": "absent"}]}`, Want: true},
+		// Typos in field names are caught.
+		{Have: `{"users": [{"name": "alice", "shel": "/bin/sh"}]}`, Want: false},
+		{Have: `{"users": [{"name": "alice"}, {"name": "alice"}]}`, Want: false},
+		{Have: `{"groups": [{"name": "staff", "state": "gone"}]}`, Want: false},
+		{Have: `{"groups": [{"gid": 10}]}`, Want: false},
+	}
+
+	for testNum, test := range tests {
+		var s Spec
+		err := Unmarshal([]byte(test.Have), &s)
+		if (err == nil) != test.Want {
+			t.Errorf("%d) expected valid %t, got %v", testNum, test.Want, err)
+		}
+	}
+
+	var s Spec
+	if err := Unmarshal([]byte(tests[0].Have), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := s.GetGroup("staff"); g == nil || g.Members == nil || !g.Present() {
+		t.Errorf("expected an empty member list to be kept, got %#v", g)
+	}
+}
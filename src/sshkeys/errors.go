@@ -0,0 +1,11 @@
+package sshkeys
+
+// ErrRefused is used when the .ssh directory is not safe to write to.
+type ErrRefused struct {
+	err string
+}
+
+// Error takes an error and returns a string. Satisfies the interface.
+func (e *ErrRefused) Error() string {
+	return e.err
+}
@@ -0,0 +1,184 @@
+package sshkeys
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/mikemackintosh/wonka/src/home"
+)
+
+// FILE_AUTHORIZED_KEYS is the authorized keys file, relative to a home
+// directory.
+const FILE_AUTHORIZED_KEYS = ".ssh/authorized_keys"
+
+// Modes sshd accepts for the .ssh directory and the keys file.
+const (
+	DirMode  os.FileMode = 0700
+	FileMode os.FileMode = 0600
+)
+
+// Path returns the authorized keys file of the home directory dir below
+// root, refusing paths which resolve outside of root.
+func Path(root, dir string) (string, error) {
+	return home.Resolve(root, filepath.Join(dir, FILE_AUTHORIZED_KEYS))
+}
+
+// Unmarshal returns the keys of an authorized keys file, skipping blank
+// lines and comments.
+func Unmarshal(data []byte) []string {
+	var keys []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+
+	return keys
+}
+
+// Marshal returns keys as an authorized keys file, one per line.
+func Marshal(keys []string) []byte {
+	var b bytes.Buffer
+	for _, key := range keys {
+		b.WriteString(strings.TrimSpace(key))
+		b.WriteByte('\n')
+	}
+
+	return b.Bytes()
+}
+
+// Merge appends the keys missing from existing, keeping the order of both.
+func Merge(existing, keys []string) []string {
+	merged := append([]string{}, existing...)
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if len(key) > 0 && !contains(merged, key) {
+			merged = append(merged, key)
+		}
+	}
+
+	return merged
+}
+
+// Read returns the content of the authorized keys file of dir, and whether
+// it exists.
+func Read(root, dir string) ([]byte, bool, error) {
+	file, err := Path(root, dir)
+	if err != nil {
+		return nil, false, err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+
+	return data, err == nil, err
+}
+
+// Add appends the missing keys to the authorized keys file of dir, making
+// the .ssh directory when needed. Both are owned by uid and gid, with the
+// modes sshd requires.
+func Add(root, dir string, keys []string, uid, gid int) error {
+	data, _, err := Read(root, dir)
+	if err != nil {
+		return err
+	}
+
+	return Write(root, dir, Marshal(Merge(Unmarshal(data), keys)), uid, gid)
+}
+
+// Write replaces the authorized keys file of dir with data, making the .ssh
+// directory when needed. Nothing is written through a symlink.
+func Write(root, dir string, data []byte, uid, gid int) error {
+	file, err := Path(root, dir)
+	if err != nil {
+		return err
+	}
+
+	if err := checkDir(filepath.Dir(file), uid, gid); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_NOFOLLOW, FileMode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Chown(uid, gid); err != nil {
+		f.Close()
+		return err
+	}
+
+	// Chmod after chown, and without the umask applied.
+	if err := f.Chmod(FileMode); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// checkDir makes the .ssh directory when it is missing. An existing one
+// must be a real directory owned by uid, so a symlink planted by the user
+// cannot send the keys file, and the chown of it, somewhere else.
+func checkDir(ssh string, uid, gid int) error {
+	info, err := os.Lstat(ssh)
+	if os.IsNotExist(err) {
+		if err := os.Mkdir(ssh, DirMode); err != nil {
+			return err
+		}
+
+		return os.Lchown(ssh, uid, gid)
+	} else if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return &ErrRefused{fmt.Sprintf("%s is not a directory", ssh)}
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != uid {
+		return &ErrRefused{fmt.Sprintf("%s belongs to uid %d, not %d", ssh, stat.Uid, uid)}
+	}
+
+	return nil
+}
+
+// Remove deletes the authorized keys file of dir. A missing file is not an
+// error.
+func Remove(root, dir string) error {
+	file, err := Path(root, dir)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// contains returns true if list has s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
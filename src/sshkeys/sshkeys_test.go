@@ -0,0 +1,107 @@
+package sshkeys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	var tests = []struct {
+		existing, keys, expected []string
+	}{
+		{nil, []string{"ssh-ed25519 AAAA a"}, []string{"ssh-ed25519 AAAA a"}},
+		{[]string{"ssh-ed25519 AAAA a"}, []string{" ssh-ed25519 AAAA a ", "ssh-rsa BBBB b"}, []string{"ssh-ed25519 AAAA a", "ssh-rsa BBBB b"}},
+		{[]string{"ssh-rsa BBBB b"}, []string{""}, []string{"ssh-rsa BBBB b"}},
+	}
+
+	for _, test := range tests {
+		if got := Merge(test.existing, test.keys); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("expected %q, got %q", test.expected, got)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	root, err := ioutil.TempDir("", "sshkeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, "home", "alice"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < 2; n++ {
+		if err := Add(root, "/home/alice", []string{"ssh-ed25519 AAAA a"}, 1000, 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(root, "home", "alice", ".ssh"))
+	if err != nil || info.Mode().Perm() != DirMode {
+		t.Errorf("expected a private .ssh directory, got %v", err)
+	}
+
+	data, exists, err := Read(root, "/home/alice")
+	if err != nil || !exists {
+		t.Fatal(err)
+	}
+
+	if string(data) != "ssh-ed25519 AAAA a\n" {
+		t.Errorf("expected the key once, got %q", data)
+	}
+
+	if err := Remove(root, "/home/alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exists, _ := Read(root, "/home/alice"); exists {
+		t.Error("expected the file to be removed")
+	}
+}
+
+func TestWriteRefused(t *testing.T) {
+	root, err := ioutil.TempDir("", "sshkeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	home := filepath.Join(root, "home", "alice")
+	target := filepath.Join(root, "etc")
+	for _, dir := range []string{home, target} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A .ssh symlink must not be written through.
+	if err := os.Symlink(target, filepath.Join(home, ".ssh")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Write(root, "/home/alice", []byte("ssh-ed25519 AAAA a\n"), 1000, 1000); err == nil {
+		t.Error("expected a symlinked .ssh to be refused")
+	}
+
+	if _, err := os.Lstat(filepath.Join(target, "authorized_keys")); !os.IsNotExist(err) {
+		t.Error("expected nothing to be written through the symlink")
+	}
+
+	// Neither may a .ssh directory of another user.
+	if err := os.Remove(filepath.Join(home, ".ssh")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(filepath.Join(home, ".ssh"), DirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Write(root, "/home/alice", []byte("ssh-ed25519 AAAA a\n"), 1000, 1000); err == nil {
+		t.Error("expected a .ssh of another uid to be refused")
+	}
+}
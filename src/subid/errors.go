@@ -0,0 +1,15 @@
+package subid
+
+import "fmt"
+
+// ErrExhausted is used when no free block of IDs is left.
+type ErrExhausted struct {
+	Min   int
+	Max   int
+	Count int
+}
+
+// Error takes an error and returns a string. Satisfies the interface.
+func (e *ErrExhausted) Error() string {
+	return fmt.Sprintf("no free block of %d ids between %d and %d", e.Count, e.Min, e.Max)
+}
@@ -0,0 +1,266 @@
+package subid
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mikemackintosh/wonka/src/libs/locker"
+)
+
+const (
+	FILE_SUBUID = "/etc/subuid"
+	FILE_SUBGID = "/etc/subgid"
+)
+
+type Entries []*Range
+
+// Range is a block of subordinate IDs delegated to a user, by name or UID.
+// Line holds the original text of comments and lines which failed to
+// parse, which are written back unchanged.
+type Range struct {
+	Name   string
+	Start  int
+	Count  int
+	Errors []error
+	Line   string
+}
+
+// End returns the last ID in the range.
+func (r *Range) End() int {
+	return r.Start + r.Count - 1
+}
+
+// Overlaps returns true if any ID from start..start+count-1 is in the range.
+func (r *Range) Overlaps(start, count int) bool {
+	return start <= r.End() && r.Start <= start+count-1
+}
+
+// Unmarshal will unmarshal a provided subuid or subgid formatted file.
+func Unmarshal(data []byte, dest interface{}) error {
+	switch dest.(type) {
+	case *Entries:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of subid.Entries")
+	}
+
+	outfile := dest.(*Entries)
+	file := strings.TrimSpace(string(data))
+	lines := strings.Split(file, "\n")
+
+	for _, raw := range lines {
+		line := strings.TrimSpace(raw)
+		if len(line) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			*outfile = append(*outfile, &Range{Line: raw})
+			continue
+		}
+
+		var errs []error
+
+		// Split the lines on the delim, ":".
+		parts := strings.Split(line, ":")
+		if len(parts) != 3 {
+			errs = append(errs, errors.New("subid entry does not have 3 segments"))
+			parts = append(parts, "", "")
+		}
+
+		// Check if name is provided or not.
+		if len(parts[0]) < 1 {
+			errs = append(errs, errors.New("invalid name parsed"))
+		}
+
+		start, err := strconv.Atoi(parts[1])
+		if err != nil {
+			errs = append(errs, errors.New("invalid start"))
+		}
+
+		count, err := strconv.Atoi(parts[2])
+		if err != nil {
+			errs = append(errs, errors.New("invalid count"))
+		}
+
+		r := &Range{
+			Name:   parts[0],
+			Start:  start,
+			Count:  count,
+			Errors: errs,
+		}
+
+		if len(errs) > 0 {
+			r.Line = raw
+		}
+
+		*outfile = append(*outfile, r)
+	}
+
+	return nil
+}
+
+// Marshal is a helper for subid.Marshal().
+func (e Entries) Marshal() ([]byte, error) {
+	return Marshal(e)
+}
+
+// Marshal will parse the provided entries into a byte array for writing.
+// Comments and lines which failed to parse are kept as they were read, so
+// only the other ranges are validated.
+func Marshal(in Entries) ([]byte, error) {
+	var out []string
+
+	for _, r := range in {
+		if len(r.Line) > 0 {
+			out = append(out, r.Line)
+			continue
+		}
+
+		if len(r.Name) == 0 || r.Start < 0 || r.Count < 1 {
+			return nil, errors.New("attempting to save invalid range")
+		}
+
+		out = append(out, fmt.Sprintf("%s:%d:%d", r.Name, r.Start, r.Count))
+	}
+
+	if len(out) == 0 {
+		return []byte{}, nil
+	}
+
+	// Join the slices by new lines.
+	return []byte(strings.Join(out, "\n") + "\n"), nil
+}
+
+// SaveToFile will write the entries to the provided file, creating it if it
+// does not exist.
+func (e Entries) SaveToFile(file string) error {
+	b, err := e.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return ioutil.WriteFile(file, b, 0644)
+	}
+
+	return locker.WriteWithLock(file, b)
+}
+
+// LoadFromFile will read a subuid or subgid file and return parsed Entries
+// or error.
+func LoadFromFile(file string) (*Entries, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entries
+	err = Unmarshal(b, &e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// GetRanges returns every range delegated to name.
+func (e *Entries) GetRanges(name string) []*Range {
+	var ranges []*Range
+	for _, r := range *e {
+		if r.Name == name {
+			ranges = append(ranges, r)
+		}
+	}
+
+	return ranges
+}
+
+// IsFree returns true if no range overlaps start..start+count-1.
+func (e *Entries) IsFree(start, count int) bool {
+	for _, r := range *e {
+		if r.Overlaps(start, count) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Allocate delegates the first free block of count IDs between min and max
+// to name, the way useradd picks subordinate IDs.
+func (e *Entries) Allocate(name string, min, max, count int) (*Range, error) {
+	if count < 1 {
+		return nil, errors.New("must allocate at least one id")
+	}
+
+	// Walk the existing ranges in order, looking for a gap big enough.
+	sorted := make(Entries, len(*e))
+	copy(sorted, *e)
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].Start < sorted[b].Start
+	})
+
+	start := min
+	for _, r := range sorted {
+		if r.End() < start {
+			continue
+		}
+
+		if r.Start-start >= count {
+			break
+		}
+
+		start = r.End() + 1
+	}
+
+	if start+count-1 > max {
+		return nil, &ErrExhausted{min, max, count}
+	}
+
+	r := &Range{Name: name, Start: start, Count: count}
+	*e = append(*e, r)
+
+	return r, nil
+}
+
+// Release removes every range delegated to name, or to uid written as a
+// number, and returns the number removed. A negative uid only matches by
+// name.
+func (e *Entries) Release(name string, uid int) int {
+	id := ""
+	if uid >= 0 {
+		id = strconv.Itoa(uid)
+	}
+
+	var kept Entries
+	for _, r := range *e {
+		if len(r.Name) == 0 || (r.Name != name && r.Name != id) {
+			kept = append(kept, r)
+		}
+	}
+
+	removed := len(*e) - len(kept)
+	*e = kept
+
+	return removed
+}
+
+// Rename moves every range delegated to old over to new and returns the
+// number renamed. Lines which failed to parse are left alone.
+func (e *Entries) Rename(old, new string) int {
+	renamed := 0
+	for _, r := range *e {
+		if r.Name == old && len(r.Line) == 0 {
+			r.Name = new
+			renamed++
+		}
+	}
+
+	return renamed
+}
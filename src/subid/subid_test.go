@@ -0,0 +1,111 @@
+package subid
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := []byte("alice:100000:65536\n1001:165536:65536\n")
+
+	var e Entries
+	if err := Unmarshal(data, &e); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e) != 2 || e[1].Name != "1001" || e[1].End() != 231071 {
+		t.Fatalf("unexpected entries %#v", e)
+	}
+
+	output, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(output, data) {
+		t.Errorf("expected %q, got %q", data, output)
+	}
+}
+
+func TestRoundTripInvalid(t *testing.T) {
+	data := []byte("# delegated by hand\nalice:100000:65536\nbroken:abc:10\n1001:165536:65536\n")
+
+	var e Entries
+	if err := Unmarshal(data, &e); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e) != 4 || len(e[2].Errors) == 0 {
+		t.Fatalf("unexpected entries %#v", e)
+	}
+
+	if _, err := e.Allocate("bob", 100000, 600100000, 65536); err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Rename("broken", "fixed") != 0 {
+		t.Error("expected the invalid line to be left alone")
+	}
+
+	output, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := string(data) + "bob:231072:65536\n"
+	if string(output) != want {
+		t.Errorf("expected %q, got %q", want, output)
+	}
+
+	// Ranges are released by name or by UID.
+	if e.Release("carol", 1001) != 1 || e.Release("alice", 1000) != 1 || len(e) != 3 {
+		t.Errorf("unexpected entries after release %#v", e)
+	}
+
+	if _, err := (Entries{{Name: "dave", Start: 10}}).Marshal(); err == nil {
+		t.Error("expected a new invalid range to be refused")
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	e := Entries{
+		{Name: "alice", Start: 100000, Count: 65536},
+		{Name: "carol", Start: 300000, Count: 65536},
+	}
+
+	tests := []struct {
+		Name  string
+		Count int
+		Want  int
+	}{
+		// First gap after alice.
+		{Name: "bob", Count: 65536, Want: 165536},
+		// Too big for the remaining gap before carol.
+		{Name: "dave", Count: 100000, Want: 365536},
+		// Small enough for the space left before carol.
+		{Name: "erin", Count: 1000, Want: 231072},
+	}
+
+	for testNum, test := range tests {
+		r, err := e.Allocate(test.Name, 100000, 600100000, test.Count)
+		if err != nil {
+			t.Fatalf("%d) %s", testNum, err)
+		}
+
+		if r.Start != test.Want {
+			t.Errorf("%d) expected %d, got %d", testNum, test.Want, r.Start)
+		}
+	}
+
+	if _, err := e.Allocate("frank", 100000, 165535, 1); err == nil {
+		t.Error("expected the range to be exhausted")
+	}
+
+	if e.Rename("bob", "robert") != 1 || len(e.GetRanges("robert")) != 1 {
+		t.Error("expected bob to be renamed")
+	}
+
+	if e.Release("alice", -1) != 1 || len(e.GetRanges("alice")) != 0 {
+		t.Error("expected alice to be released")
+	}
+}
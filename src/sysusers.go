@@ -0,0 +1,369 @@
+package wonka
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/mikemackintosh/wonka/src/alloc"
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/gshadow"
+	"github.com/mikemackintosh/wonka/src/home"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/shadow"
+	"github.com/mikemackintosh/wonka/src/subid"
+	"github.com/mikemackintosh/wonka/src/sysusers"
+)
+
+const (
+	// sysusersShell is the shell of sysusers accounts other than root.
+	sysusersShell = "/usr/sbin/nologin"
+	// lockedPassword is the password systemd-sysusers gives its accounts,
+	// locked and impossible to match.
+	lockedPassword = "!*"
+)
+
+// sysusersID is the parsed ID field of a u or g line.
+type sysusersID struct {
+	uid, gid int
+	// group is the primary group name given as "uid:group".
+	group string
+}
+
+// ApplySysusers creates the users, groups and memberships of sysusers.d
+// entries the way systemd-sysusers does: existing entries are never
+// changed, groups are created before users, and free IDs are picked from
+// the top of the r ranges, or of the login.defs system range, preferring
+// the same number for a user and its group. Nothing is written until Save
+// is called.
+func (i *Instance) ApplySysusers(entries sysusers.Entries) ([]Change, error) {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return nil, errNotLoaded
+	}
+
+	var users, grps, members []*sysusers.Entry
+	var uidRanges, gidRanges [][2]int
+	seen := map[string]bool{}
+	for _, e := range entries {
+		switch e.Type {
+		case sysusers.TypeRange:
+			min, max, _ := e.Range()
+			uidRanges = append(uidRanges, [2]int{min, max})
+		case sysusers.TypeMember:
+			members = append(members, e)
+		default:
+			if err := ValidName(e.Name); err != nil {
+				return nil, fmt.Errorf("%s:%d: %s", e.File, e.Line, err)
+			}
+
+			// The first line for a name wins, like systemd-sysusers.
+			if key := e.Type + ":" + e.Name; !seen[key] {
+				seen[key] = true
+				if e.Type == sysusers.TypeUser {
+					users = append(users, e)
+				} else {
+					grps = append(grps, e)
+				}
+			}
+		}
+	}
+
+	// Members of users and groups nobody declared create them.
+	for _, m := range members {
+		if !seen["u:"+m.Name] && i.Passwd.GetUser(m.Name) == nil {
+			seen["u:"+m.Name] = true
+			users = append(users, &sysusers.Entry{Type: sysusers.TypeUser, Name: m.Name, File: m.File, Line: m.Line})
+		}
+
+		if !seen["g:"+m.ID] && !seen["u:"+m.ID] && i.Groups.GetGroup(m.ID) == nil {
+			seen["g:"+m.ID] = true
+			grps = append(grps, &sysusers.Entry{Type: sysusers.TypeGroup, Name: m.ID, File: m.File, Line: m.Line})
+		}
+	}
+
+	if len(uidRanges) == 0 {
+		uidRanges = [][2]int{{i.Policy.SysUIDMin, i.Policy.SysUIDMax}}
+		gidRanges = [][2]int{{i.Policy.SysGIDMin, i.Policy.SysGIDMax}}
+	} else {
+		gidRanges = uidRanges
+	}
+
+	ids := map[string]sysusersID{}
+	for _, e := range append(append([]*sysusers.Entry{}, grps...), users...) {
+		id, err := i.sysusersID(e)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", e.File, e.Line, err)
+		}
+		ids[e.Type+":"+e.Name] = id
+	}
+
+	var changes []Change
+
+	// A user line creates a group of the same name, unless it names its
+	// primary group, or gives a GID which a group already has.
+	for _, e := range users {
+		id := ids["u:"+e.Name]
+		if len(id.group) == 0 && !seen["g:"+e.Name] && !sysusersGIDTaken(i.Groups, ids, grps, id.gid) {
+			grps = append(grps, e)
+		}
+	}
+
+	for _, e := range grps {
+		if i.Groups.GetGroup(e.Name) != nil {
+			continue
+		}
+
+		id := ids[e.Type+":"+e.Name]
+		gid := id.gid
+		if e.Type == sysusers.TypeUser && gid < 0 {
+			gid = id.uid
+		}
+
+		if gid < 0 || i.Groups.GetGroupByID(gid) != nil {
+			var err error
+			if gid, err = allocate(gidRanges, i.Subgid, func(n int) bool { return i.sysusersGIDFree(n, e.Name) }); err != nil {
+				return nil, err
+			}
+		}
+
+		i.Groups.NewGroup(&groups.Group{Name: e.Name, Password: "x", GID: gid})
+		if i.Gshadow != nil && i.Gshadow.GetEntry(e.Name) == nil {
+			i.Gshadow.NewEntry(&gshadow.Entry{Name: e.Name, Password: lockedPassword})
+		}
+		changes = append(changes, Change{i.Options.fileGroups, fmt.Sprintf("created group %s with gid %d", e.Name, gid)})
+	}
+
+	for _, e := range users {
+		if i.Passwd.GetUser(e.Name) != nil {
+			continue
+		}
+
+		id := ids["u:"+e.Name]
+		group := e.Name
+		if len(id.group) > 0 {
+			group = id.group
+		}
+
+		// A numeric GID names the primary group by its number.
+		primary := i.Groups.GetGroup(group)
+		if len(id.group) == 0 && id.gid >= 0 {
+			if owner := i.Groups.GetGroupByID(id.gid); owner != nil {
+				primary = owner
+			}
+		}
+
+		if primary == nil {
+			return nil, fmt.Errorf("%s:%d: group %s does not exist", e.File, e.Line, group)
+		}
+
+		uid := id.uid
+		if uid < 0 || i.Passwd.GetUserByID(uid) != nil {
+			uid = primary.GID
+			if !i.sysusersUIDFree(uid, e.Name) {
+				var err error
+				if uid, err = allocate(uidRanges, i.Subuid, func(n int) bool { return i.sysusersUIDFree(n, e.Name) }); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		entry := passwd.Entry{
+			Username: e.Name,
+			Password: "x",
+			UID:      uid,
+			GID:      primary.GID,
+			Info:     e.GECOS,
+			HomeDir:  e.Home,
+			Shell:    e.Shell,
+		}
+
+		if len(entry.HomeDir) == 0 {
+			entry.HomeDir = "/"
+			if uid == 0 {
+				entry.HomeDir = "/root"
+			}
+		}
+
+		if len(entry.Shell) == 0 {
+			entry.Shell = sysusersShell
+			if uid == 0 {
+				entry.Shell = "/bin/sh"
+			}
+		}
+
+		shd := &shadow.Entry{Username: e.Name, Password: lockedPassword, LastPasswordChange: shadow.Today()}
+		if e.Locked {
+			shd.AccountExpiration = shadow.DateFromDays(1)
+		}
+
+		i.Passwd.NewEntry(entry)
+		if i.Shadow.GetUserEntry(e.Name) == nil {
+			i.Shadow.NewEntry(shd)
+		}
+		changes = append(changes, Change{i.Options.filePasswd, fmt.Sprintf("created user %s with uid %d and gid %d", e.Name, uid, primary.GID)})
+	}
+
+	for _, m := range members {
+		group := i.Groups.GetGroup(m.ID)
+		if group == nil || group.HasUser(m.Name) {
+			continue
+		}
+
+		group.AddUser(m.Name)
+		if entry := i.gshadowEntry(m.ID); entry != nil {
+			entry.Members = append(entry.Members, m.Name)
+		}
+		changes = append(changes, Change{i.Options.fileGroups, fmt.Sprintf("added %s to group %s", m.Name, m.ID)})
+	}
+
+	return changes, nil
+}
+
+// sysusersID parses the ID field of a u or g line. Unset IDs are -1.
+func (i *Instance) sysusersID(e *sysusers.Entry) (sysusersID, error) {
+	id := sysusersID{uid: -1, gid: -1}
+	if len(e.ID) == 0 {
+		return id, nil
+	}
+
+	// A path takes the IDs from the owner of the file.
+	if strings.HasPrefix(e.ID, "/") {
+		path, err := home.Resolve(i.Options.Root, e.ID)
+		if err != nil {
+			return id, err
+		}
+
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return id, nil
+		} else if err != nil {
+			return id, err
+		}
+
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			id.uid, id.gid = int(stat.Uid), int(stat.Gid)
+		}
+
+		return id, nil
+	}
+
+	first, second := e.ID, ""
+	if n := strings.Index(e.ID, ":"); n >= 0 {
+		if e.Type != sysusers.TypeUser {
+			return id, fmt.Errorf("invalid group ID %q", e.ID)
+		}
+		first, second = e.ID[:n], e.ID[n+1:]
+	}
+
+	n, err := parseSysusersID(first)
+	if err != nil {
+		return id, err
+	}
+
+	if e.Type == sysusers.TypeGroup {
+		id.gid = n
+		return id, nil
+	}
+	id.uid = n
+
+	if len(second) == 0 {
+		return id, nil
+	}
+
+	if gid, err := strconv.Atoi(second); err == nil {
+		if gid, err = parseSysusersID(second); err != nil {
+			return id, err
+		}
+		id.gid = gid
+	} else {
+		id.group = second
+	}
+
+	return id, nil
+}
+
+// parseSysusersID parses a numeric ID, rejecting the ones which mean -1.
+func parseSysusersID(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n == 65535 || n >= 4294967295 {
+		return -1, fmt.Errorf("invalid ID %q", s)
+	}
+
+	return n, nil
+}
+
+// sysusersGIDTaken returns true if gid is set and an existing group, or a
+// group declared in grps, already has it.
+func sysusersGIDTaken(existing *groups.Entries, ids map[string]sysusersID, grps []*sysusers.Entry, gid int) bool {
+	if gid < 0 {
+		return false
+	}
+
+	if existing.GetGroupByID(gid) != nil {
+		return true
+	}
+
+	for _, e := range grps {
+		if e.Type == sysusers.TypeGroup && ids["g:"+e.Name].gid == gid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sysusersUIDFree returns true if no user has the UID, no subordinate
+// range holds it, and no group other than name has it as GID, so a user
+// and its group can share it.
+func (i *Instance) sysusersUIDFree(id int, name string) bool {
+	if i.Passwd.GetUserByID(id) != nil || (i.Subuid != nil && !i.Subuid.IsFree(id, 1)) {
+		return false
+	}
+
+	group := i.Groups.GetGroupByID(id)
+	return group == nil || group.Name == name
+}
+
+// sysusersGIDFree returns true if no group has the GID, no subordinate
+// range holds it, and no user other than name has it as UID.
+func (i *Instance) sysusersGIDFree(id int, name string) bool {
+	if i.Groups.GetGroupByID(id) != nil || (i.Subgid != nil && !i.Subgid.IsFree(id, 1)) {
+		return false
+	}
+
+	user := i.Passwd.GetUserByID(id)
+	return user == nil || user.Username == name
+}
+
+// allocate returns the highest ID of the ranges for which free is true,
+// counting down with an alloc.Allocator per range which reserves the
+// subordinate ranges of subids, like NextUID and NextGID.
+func allocate(ranges [][2]int, subids *subid.Entries, free func(int) bool) (int, error) {
+	sorted := append([][2]int{}, ranges...)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a][1] > sorted[b][1] })
+
+	for _, r := range sorted {
+		a := alloc.New(r[0], r[1], true)
+		reserveSubids(a, subids)
+
+		if id, err := a.NextFunc(free); err == nil {
+			return id, nil
+		}
+	}
+
+	err := &alloc.ErrExhausted{Min: -1, Max: -1}
+	for _, r := range sorted {
+		if err.Min < 0 || r[0] < err.Min {
+			err.Min = r[0]
+		}
+
+		if r[1] > err.Max {
+			err.Max = r[1]
+		}
+	}
+
+	return -1, err
+}
@@ -0,0 +1,254 @@
+package sysusers
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dirs are the sysusers.d directories, most important first. A file in an
+// earlier directory overrides one with the same name in a later one.
+var Dirs = []string{"/etc/sysusers.d", "/run/sysusers.d", "/usr/local/lib/sysusers.d", "/usr/lib/sysusers.d"}
+
+// Line types.
+const (
+	TypeUser   = "u"
+	TypeGroup  = "g"
+	TypeMember = "m"
+	TypeRange  = "r"
+)
+
+type Entries []*Entry
+
+// Entry is one sysusers.d line:
+//
+//	u  name  ID  GECOS  home  shell
+//
+// Empty fields and "-" are unset.
+type Entry struct {
+	Type string
+	// Locked is set by "u!", which also expires the account.
+	Locked bool
+	Name   string
+	// ID is "-", a number, "uid:gid", "uid:group", a path whose owner is
+	// used, or for m lines the group name, and for r lines a range.
+	ID    string
+	GECOS string
+	Home  string
+	Shell string
+
+	// File and Line locate the entry for error messages.
+	File string
+	Line int
+}
+
+// Unmarshal will unmarshal a sysusers.d file.
+func Unmarshal(data []byte, dest interface{}) error {
+	return unmarshal(data, dest, "")
+}
+
+// unmarshal parses data, recording file in every entry.
+func unmarshal(data []byte, dest interface{}, file string) error {
+	switch dest.(type) {
+	case *Entries:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of sysusers.Entries")
+	}
+
+	outfile := dest.(*Entries)
+	for n, line := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") || len(line) == 0 {
+			continue
+		}
+
+		fields, err := split(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", file, n+1, err)
+		}
+
+		entry, err := parse(fields)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", file, n+1, err)
+		}
+
+		entry.File, entry.Line = file, n+1
+		*outfile = append(*outfile, entry)
+	}
+
+	return nil
+}
+
+// parse builds an entry from the fields of a line.
+func parse(fields []string) (*Entry, error) {
+	if len(fields) < 2 {
+		return nil, errors.New("missing name")
+	}
+
+	if len(fields) > 6 {
+		return nil, errors.New("too many fields")
+	}
+
+	for len(fields) < 6 {
+		fields = append(fields, "")
+	}
+
+	for n := 2; n < len(fields); n++ {
+		if fields[n] == "-" {
+			fields[n] = ""
+		}
+	}
+
+	e := &Entry{Type: fields[0], Name: fields[1], ID: fields[2], GECOS: fields[3], Home: fields[4], Shell: fields[5]}
+	if e.Type == "u!" {
+		e.Type, e.Locked = TypeUser, true
+	}
+
+	switch e.Type {
+	case TypeUser:
+	case TypeGroup, TypeMember, TypeRange:
+		if len(e.GECOS) > 0 || len(e.Home) > 0 || len(e.Shell) > 0 {
+			return nil, fmt.Errorf("GECOS, home and shell are only valid for users")
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", fields[0])
+	}
+
+	switch e.Type {
+	case TypeMember:
+		if len(e.ID) == 0 {
+			return nil, errors.New("m lines need a group")
+		}
+	case TypeRange:
+		if e.Name != "-" {
+			return nil, errors.New("r lines must use - as the name")
+		}
+
+		if _, _, err := e.Range(); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// split breaks a line into whitespace separated fields, honouring double
+// and single quotes and backslash escapes.
+func split(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	var quote rune
+	inField, escaped := false, false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped, inField = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			field.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inField = r, true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+
+	if inField {
+		fields = append(fields, field.String())
+	}
+
+	return fields, nil
+}
+
+// Range returns the bounds of an r line, "500-900" or a single "500".
+func (e *Entry) Range() (int, int, error) {
+	parts := strings.SplitN(e.ID, "-", 2)
+	min, err := strconv.Atoi(parts[0])
+	if err != nil || min < 0 {
+		return -1, -1, fmt.Errorf("invalid range %q", e.ID)
+	}
+
+	max := min
+	if len(parts) == 2 {
+		if max, err = strconv.Atoi(parts[1]); err != nil || max < min {
+			return -1, -1, fmt.Errorf("invalid range %q", e.ID)
+		}
+	}
+
+	return min, max, nil
+}
+
+// LoadFromFile will read a sysusers.d file.
+func LoadFromFile(file string) (*Entries, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entries
+	if err := unmarshal(b, &e, file); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// Load will read every *.conf file of the sysusers.d directories below
+// root, in order of their names. A file in /etc overrides one of the same
+// name in /run or /usr/lib, and a symlink to /dev/null masks it.
+func Load(root string) (*Entries, error) {
+	files := map[string]string{}
+	for n := len(Dirs) - 1; n >= 0; n-- {
+		matches, err := filepath.Glob(filepath.Join(root, Dirs[n], "*.conf"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			files[filepath.Base(match)] = match
+		}
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var all Entries
+	for _, name := range names {
+		if link, err := os.Readlink(files[name]); err == nil && link == os.DevNull {
+			continue
+		}
+
+		e, err := LoadFromFile(files[name])
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, *e...)
+	}
+
+	return &all, nil
+}
@@ -0,0 +1,48 @@
+package sysusers
+
+import "testing"
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		Have string
+		Want Entry
+	}{
+		{Have: `u systemd-network - "systemd Network Management"`, Want: Entry{Type: TypeUser, Name: "systemd-network", GECOS: "systemd Network Management"}},
+		{Have: `u! locked 190:input - /var/lib/locked /bin/false`, Want: Entry{Type: TypeUser, Locked: true, Name: "locked", ID: "190:input", Home: "/var/lib/locked", Shell: "/bin/false"}},
+		{Have: "g\tinput\t-", Want: Entry{Type: TypeGroup, Name: "input"}},
+		{Have: `m svc adm`, Want: Entry{Type: TypeMember, Name: "svc", ID: "adm"}},
+		{Have: `r - 500-900`, Want: Entry{Type: TypeRange, Name: "-", ID: "500-900"}},
+		{Have: `u quoted - 'it\'s "here"'`, Want: Entry{Type: TypeUser, Name: "quoted", GECOS: `it's "here"`}},
+	}
+
+	for testNum, test := range tests {
+		var e Entries
+		if err := Unmarshal([]byte(test.Have), &e); err != nil {
+			t.Fatalf("%d) %s", testNum, err)
+		}
+
+		test.Want.Line = 1
+		if len(e) != 1 || *e[0] != test.Want {
+			t.Errorf("%d) expected %#v, got %#v", testNum, test.Want, e)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []string{
+		`x name`,
+		`u`,
+		`g name - "gecos"`,
+		`m user`,
+		`r name 1-2`,
+		`r - 9-1`,
+		`u name - "unterminated`,
+	}
+
+	for testNum, test := range tests {
+		var e Entries
+		if err := Unmarshal([]byte(test), &e); err == nil {
+			t.Errorf("%d) expected %q to fail", testNum, test)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package wonka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/gshadow"
+	"github.com/mikemackintosh/wonka/src/libs/locker"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/shadow"
+	"github.com/mikemackintosh/wonka/src/subid"
+)
+
+// marshaler is implemented by every loaded account database.
+type marshaler interface {
+	Marshal() ([]byte, error)
+}
+
+// database is a loaded account database and the file it is saved to.
+type database struct {
+	file    string
+	entries marshaler
+}
+
+// backup is the content of a file before Save wrote it.
+type backup struct {
+	file    string
+	data    []byte
+	existed bool
+}
+
+// action is a queued filesystem change and how to undo it. Changes which
+// cannot be undone, like removals, have no undo.
+type action struct {
+	do   func() error
+	undo func() error
+}
+
+// databases returns every loaded database, in the order they are written.
+func (i *Instance) databases() []database {
+	dbs := []database{
+		{i.path(i.Options.filePasswd), *i.Passwd},
+		{i.path(i.Options.fileShadow), *i.Shadow},
+		{i.path(i.Options.fileGroups), *i.Groups},
+	}
+
+	if i.Gshadow != nil {
+		dbs = append(dbs, database{i.path(i.Options.fileGshadow), *i.Gshadow})
+	}
+
+	if i.Subuid != nil {
+		dbs = append(dbs, database{i.path(i.Options.fileSubuid), *i.Subuid})
+	}
+
+	if i.Subgid != nil {
+		dbs = append(dbs, database{i.path(i.Options.fileSubgid), *i.Subgid})
+	}
+
+	if i.Managed != nil {
+		dbs = append(dbs, database{i.path(i.Options.fileManaged), *i.Managed})
+	}
+
+	return dbs
+}
+
+// Save will run the changes queued with before, then write every loaded
+// database below the instance root and run the queued filesystem changes,
+// as a single transaction. Every database is marshalled before anything is
+// written, and if a write or a filesystem change fails, the completed
+// changes are undone and the databases are restored to their previous
+// contents. Changes queued with before cannot be undone.
+func (i *Instance) Save() error {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return errNotLoaded
+	}
+
+	dbs := i.databases()
+	data := make([][]byte, len(dbs))
+	for n, db := range dbs {
+		b, err := db.entries.Marshal()
+		if err != nil {
+			return err
+		}
+		data[n] = b
+	}
+
+	if err := i.runPrepare(); err != nil {
+		return err
+	}
+
+	var written []backup
+	for n, db := range dbs {
+		old, err := ioutil.ReadFile(db.file)
+		if err != nil && !os.IsNotExist(err) {
+			restore(written)
+			return err
+		}
+
+		if err := writeFile(db.file, data[n]); err != nil {
+			restore(written)
+			return err
+		}
+
+		written = append(written, backup{db.file, old, err == nil})
+	}
+
+	if err := i.runPending(); err != nil {
+		restore(written)
+		return err
+	}
+
+	return nil
+}
+
+// writeFile writes an account database, creating it and its directory if
+// they do not exist.
+func writeFile(file string, data []byte) error {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(file, data, 0644)
+	}
+
+	return locker.WriteWithLock(file, data)
+}
+
+// restore puts back the previous content of written files, removing the
+// ones which did not exist. It is best effort, as it only runs once
+// something has already failed.
+func restore(written []backup) {
+	for n := len(written) - 1; n >= 0; n-- {
+		if written[n].existed {
+			locker.WriteWithLock(written[n].file, written[n].data)
+		} else {
+			os.Remove(written[n].file)
+		}
+	}
+}
+
+// after queues a filesystem change to run once Save has written the
+// databases, so a failed save never leaves files for accounts that do not
+// exist. undo may be nil.
+func (i *Instance) after(do, undo func() error) {
+	i.pending = append(i.pending, action{do, undo})
+}
+
+// runPending runs the queued filesystem changes in order. On the first
+// error, the changes which already ran are undone in reverse order.
+func (i *Instance) runPending() error {
+	pending := i.pending
+	i.pending = nil
+
+	for n, a := range pending {
+		if err := a.do(); err != nil {
+			for k := n - 1; k >= 0; k-- {
+				if pending[k].undo != nil {
+					pending[k].undo()
+				}
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// before queues a change which cannot be undone, like killing processes,
+// to run once Save has marshalled the databases but before it writes
+// anything. If it fails, nothing is written.
+func (i *Instance) before(do func() error) {
+	i.prepare = append(i.prepare, do)
+}
+
+// runPrepare runs the changes queued with before, in order, stopping at
+// the first error.
+func (i *Instance) runPrepare() error {
+	prepare := i.prepare
+	i.prepare = nil
+
+	for _, do := range prepare {
+		if err := do(); err != nil {
+			i.pending = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+// snapshot copies the loaded databases and the queued changes, and returns
+// a function which puts them back, so a change made of several steps can
+// be dropped when a later step fails.
+func (i *Instance) snapshot() func() {
+	pwd := append(passwd.Entries(nil), *i.Passwd...)
+
+	var shd shadow.Entries
+	for _, e := range *i.Shadow {
+		copied := *e
+		shd = append(shd, &copied)
+	}
+
+	var grp groups.Entries
+	for _, g := range *i.Groups {
+		copied := *g
+		copied.Users = append([]string(nil), g.Users...)
+		grp = append(grp, &copied)
+	}
+
+	var gshd gshadow.Entries
+	if i.Gshadow != nil {
+		for _, e := range *i.Gshadow {
+			copied := *e
+			copied.Admins = append([]string(nil), e.Admins...)
+			copied.Members = append([]string(nil), e.Members...)
+			gshd = append(gshd, &copied)
+		}
+	}
+
+	subuid, subgid := copySubids(i.Subuid), copySubids(i.Subgid)
+	prepare, pending := len(i.prepare), len(i.pending)
+
+	return func() {
+		*i.Passwd, *i.Shadow, *i.Groups = pwd, shd, grp
+		if i.Gshadow != nil {
+			*i.Gshadow = gshd
+		}
+
+		if i.Subuid != nil {
+			*i.Subuid = subuid
+		}
+
+		if i.Subgid != nil {
+			*i.Subgid = subgid
+		}
+
+		i.prepare, i.pending = i.prepare[:prepare], i.pending[:pending]
+	}
+}
+
+// copySubids returns a copy of the ranges of entries, which may be nil.
+func copySubids(entries *subid.Entries) subid.Entries {
+	if entries == nil {
+		return nil
+	}
+
+	var copied subid.Entries
+	for _, r := range *entries {
+		c := *r
+		copied = append(copied, &c)
+	}
+
+	return copied
+}
@@ -0,0 +1,284 @@
+package useradd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/libs/locker"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/shadow"
+)
+
+const FILE_USERADD = "/etc/default/useradd"
+
+// expireLayout is the date format used by EXPIRE.
+const expireLayout = "2006-01-02"
+
+// keys is the order useradd -D prints the defaults in.
+var keys = []string{"GROUP", "HOME", "INACTIVE", "EXPIRE", "SHELL", "SKEL", "CREATE_MAIL_SPOOL"}
+
+// Defaults holds the account creation defaults from /etc/default/useradd.
+type Defaults struct {
+	// Group is the default primary group, as a name or GID.
+	Group string
+	// Home is the base directory new home directories are created in.
+	Home string
+	// Inactive is the number of days after a password expires before the
+	// account is disabled, -1 to disable the feature.
+	Inactive int
+	// Expire is the date accounts expire on, unset for never.
+	Expire shadow.Date
+	Shell  string
+	Skel   string
+	// CreateMailSpool is nil when the key is not set, so login.defs decides.
+	CreateMailSpool *bool
+
+	Errors []error
+
+	// lines keeps the original file so comments and unknown keys survive
+	// a write.
+	lines []string
+}
+
+// Default returns the values useradd uses when the file does not exist.
+func Default() *Defaults {
+	return &Defaults{
+		Group:    "100",
+		Home:     "/home",
+		Inactive: -1,
+		Shell:    "/bin/sh",
+		Skel:     "/etc/skel",
+	}
+}
+
+// Unmarshal will unmarshal a provided /etc/default/useradd formatted file.
+// Keys missing from the file keep the value already in dest.
+func Unmarshal(data []byte, dest interface{}) error {
+	switch dest.(type) {
+	case *Defaults:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of useradd.Defaults")
+	}
+
+	d := dest.(*Defaults)
+	d.lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+
+	for _, line := range d.lines {
+		line := strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") || len(line) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			d.Errors = append(d.Errors, fmt.Errorf("invalid line %q", line))
+			continue
+		}
+
+		if err := d.Set(parts[0], strings.Trim(parts[1], `"`)); err != nil {
+			d.Errors = append(d.Errors, err)
+		}
+	}
+
+	return nil
+}
+
+// Set will set a default by its file key, as useradd -D does.
+func (d *Defaults) Set(key, value string) error {
+	switch key {
+	case "GROUP":
+		d.Group = value
+	case "HOME":
+		d.Home = value
+	case "INACTIVE":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid INACTIVE %q", value)
+		}
+		d.Inactive = n
+	case "EXPIRE":
+		if len(value) == 0 {
+			d.Expire = shadow.DateUnset
+			break
+		}
+
+		t, err := time.Parse(expireLayout, value)
+		if err != nil {
+			return fmt.Errorf("invalid EXPIRE %q", value)
+		}
+		d.Expire = shadow.NewDate(t)
+	case "SHELL":
+		d.Shell = value
+	case "SKEL":
+		d.Skel = value
+	case "CREATE_MAIL_SPOOL":
+		b := strings.ToLower(value) == "yes"
+		d.CreateMailSpool = &b
+	}
+
+	return nil
+}
+
+// Get returns the file value of a key.
+func (d *Defaults) Get(key string) string {
+	switch key {
+	case "GROUP":
+		return d.Group
+	case "HOME":
+		return d.Home
+	case "INACTIVE":
+		return strconv.Itoa(d.Inactive)
+	case "EXPIRE":
+		if d.Expire.IsUnset() {
+			return ""
+		}
+		return d.Expire.Time().Format(expireLayout)
+	case "SHELL":
+		return d.Shell
+	case "SKEL":
+		return d.Skel
+	case "CREATE_MAIL_SPOOL":
+		if d.CreateMailSpool != nil && *d.CreateMailSpool {
+			return "yes"
+		}
+		return "no"
+	}
+
+	return ""
+}
+
+// String returns the defaults in the format printed by useradd -D.
+func (d *Defaults) String() string {
+	var out []string
+	for _, key := range keys {
+		out = append(out, key+"="+d.Get(key))
+	}
+
+	return strings.Join(out, "\n") + "\n"
+}
+
+// Marshal is a helper for useradd.Marshal().
+func (d *Defaults) Marshal() ([]byte, error) {
+	return Marshal(d)
+}
+
+// Marshal will write the defaults back into the original file contents,
+// keeping comments and unknown keys, and appending keys that were missing.
+func Marshal(d *Defaults) ([]byte, error) {
+	var out []string
+	written := map[string]bool{}
+
+	for _, line := range d.lines {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) == 2 && !strings.HasPrefix(parts[0], "#") && isKey(parts[0]) {
+			if written[parts[0]] {
+				continue
+			}
+
+			line = parts[0] + "=" + d.Get(parts[0])
+			written[parts[0]] = true
+		}
+
+		out = append(out, line)
+	}
+
+	for _, key := range keys {
+		// Leave mail spool creation to login.defs unless it was set.
+		if key == "CREATE_MAIL_SPOOL" && d.CreateMailSpool == nil {
+			continue
+		}
+
+		if !written[key] {
+			out = append(out, key+"="+d.Get(key))
+		}
+	}
+
+	return []byte(strings.Join(out, "\n") + "\n"), nil
+}
+
+// isKey returns true for keys Defaults has a field for.
+func isKey(key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Save will write the defaults to /etc/default/useradd.
+func (d *Defaults) Save() error {
+	return d.SaveToFile(FILE_USERADD)
+}
+
+// SaveToFile will write the defaults to the provided file, creating it if it
+// does not exist.
+func (d *Defaults) SaveToFile(file string) error {
+	b, err := d.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return ioutil.WriteFile(file, b, 0644)
+	}
+
+	return locker.WriteWithLock(file, b)
+}
+
+// LoadFromDisk will read /etc/default/useradd. A missing file returns the
+// defaults.
+func LoadFromDisk() (*Defaults, error) {
+	return Load("/")
+}
+
+// Load will read etc/default/useradd below root. A missing file returns the
+// defaults.
+func Load(root string) (*Defaults, error) {
+	d := Default()
+
+	b, err := ioutil.ReadFile(filepath.Join(root, FILE_USERADD))
+	if os.IsNotExist(err) {
+		return d, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := Unmarshal(b, d); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Apply fills the empty home directory and shell of a passwd entry.
+func (d *Defaults) Apply(e *passwd.Entry) {
+	if len(e.HomeDir) == 0 && len(d.Home) > 0 {
+		e.HomeDir = filepath.Join(d.Home, e.Username)
+	}
+
+	if len(e.Shell) == 0 {
+		e.Shell = d.Shell
+	}
+}
+
+// ApplyShadow sets the inactivity period and expiration of a shadow entry
+// when they are not already set.
+func (d *Defaults) ApplyShadow(e *shadow.Entry) {
+	if e.InactivityPeriod == nil && d.Inactive >= 0 {
+		inactive := time.Duration(d.Inactive) * 24 * time.Hour
+		e.InactivityPeriod = &inactive
+	}
+
+	if e.AccountExpiration.IsUnset() {
+		e.AccountExpiration = d.Expire
+	}
+}
@@ -0,0 +1,80 @@
+package useradd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/shadow"
+)
+
+func TestUnmarshal(t *testing.T) {
+	data := []byte("# useradd defaults file\nGROUP=users\nHOME=/srv/home\nINACTIVE=30\nEXPIRE=2030-01-02\nSHELL=/bin/bash\nCUSTOM=1\n")
+
+	d := Default()
+	if err := Unmarshal(data, d); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Group != "users" || d.Home != "/srv/home" || d.Inactive != 30 || d.Shell != "/bin/bash" {
+		t.Errorf("unexpected defaults %#v", d)
+	}
+
+	if d.Skel != "/etc/skel" {
+		t.Errorf("expected SKEL to keep its default, got %s", d.Skel)
+	}
+
+	want := shadow.NewDate(time.Date(2030, time.January, 2, 0, 0, 0, 0, time.UTC))
+	if d.Expire != want {
+		t.Errorf("expected %v, got %v", want, d.Expire)
+	}
+
+	// Comments and unknown keys must survive, missing keys are appended.
+	d.Shell = "/bin/zsh"
+	output, err := d.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# useradd defaults file\nGROUP=users\nHOME=/srv/home\nINACTIVE=30\nEXPIRE=2030-01-02\nSHELL=/bin/zsh\nCUSTOM=1\nSKEL=/etc/skel\n"
+	if string(output) != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+func TestString(t *testing.T) {
+	expected := "GROUP=100\nHOME=/home\nINACTIVE=-1\nEXPIRE=\nSHELL=/bin/sh\nSKEL=/etc/skel\nCREATE_MAIL_SPOOL=no\n"
+	if Default().String() != expected {
+		t.Errorf("expected %q, got %q", expected, Default().String())
+	}
+}
+
+func TestApply(t *testing.T) {
+	d := Default()
+	d.Inactive = 7
+
+	entry, _ := passwd.NewEntryWithDefaults("alice", "x", 1000, 100, "", "", "", d)
+	if entry.HomeDir != "/home/alice" || entry.Shell != "/bin/sh" {
+		t.Errorf("unexpected entry %#v", entry)
+	}
+
+	// Values already set are kept.
+	entry, _ = passwd.NewEntryWithDefaults("bob", "x", 1001, 100, "", "/srv/bob", "/bin/bash", d)
+	if entry.HomeDir != "/srv/bob" || entry.Shell != "/bin/bash" {
+		t.Errorf("unexpected entry %#v", entry)
+	}
+
+	// A nil pointer applies nothing instead of panicking.
+	var none *Defaults
+	entry, _ = passwd.NewEntryWithDefaults("carol", "x", 1002, 100, "", "", "", none)
+	if len(entry.HomeDir) != 0 || len(entry.Shell) != 0 {
+		t.Errorf("unexpected entry %#v", entry)
+	}
+
+	shd := shadow.NewEntry("alice", nil)
+	d.ApplyShadow(shd)
+
+	if shd.InactivityPeriod == nil || *shd.InactivityPeriod != 7*24*time.Hour {
+		t.Errorf("unexpected inactivity %v", shd.InactivityPeriod)
+	}
+}
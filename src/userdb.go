@@ -0,0 +1,162 @@
+package wonka
+
+import (
+	"fmt"
+
+	"github.com/mikemackintosh/wonka/src/userdb"
+)
+
+// UserdbRecords converts every loaded user and group into systemd JSON
+// records, including the hashed passwords in the privileged sections.
+func (i *Instance) UserdbRecords() (*userdb.Records, error) {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return nil, errNotLoaded
+	}
+
+	r := &userdb.Records{}
+	for _, entry := range *i.Passwd {
+		var memberOf []string
+		for _, group := range *i.Groups {
+			if group.HasUser(entry.Username) {
+				memberOf = append(memberOf, group.Name)
+			}
+		}
+
+		r.Users = append(r.Users, userdb.NewUser(entry, i.Shadow.GetUserEntry(entry.Username), memberOf, i.Policy))
+	}
+
+	for _, group := range *i.Groups {
+		r.Groups = append(r.Groups, userdb.NewGroup(group, i.gshadowEntry(group.Name), i.Policy))
+	}
+
+	return r, nil
+}
+
+// ExportUserdb writes every user and group as drop-ins to /etc/userdb
+// below the instance root.
+func (i *Instance) ExportUserdb() error {
+	r, err := i.UserdbRecords()
+	if err != nil {
+		return err
+	}
+
+	return r.SaveDir(i.path(userdb.DIR_USERDB))
+}
+
+// ImportUserdb creates or updates the users and groups of userdb records.
+// Records without an ID get one from the login.defs ranges, using the
+// system ranges for system dispositions, and users without a GID use the
+// group named after them. Existing users and groups only get the fields
+// the record sets, so their GECOS, home, shell, IDs, password hash, aging,
+// members and administrators are kept when it leaves them out. A group
+// record listing members replaces them, while the memberOf lists of users
+// are merged into the current memberships, never removing any. Nothing is
+// written until Save is called.
+func (i *Instance) ImportUserdb(r *userdb.Records) ([]Change, error) {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return nil, errNotLoaded
+	}
+
+	var changes []Change
+	for _, g := range r.Groups {
+		if err := ValidName(g.GroupName); err != nil {
+			return nil, err
+		}
+
+		group, gshd := g.Group(), g.Gshadow()
+		existing := i.Groups.GetGroup(g.GroupName)
+		if group.GID < 0 && existing != nil {
+			group.GID = existing.GID
+		} else if group.GID < 0 {
+			gid, err := i.NextGID(g.Disposition == userdb.DispositionSystem)
+			if err != nil {
+				return nil, err
+			}
+			group.GID = gid
+		}
+
+		if other := i.Groups.GetGroupByID(group.GID); other != nil && other != existing {
+			return nil, &ErrExists{fmt.Sprintf("gid %d of %s is used by %s", group.GID, g.GroupName, other.Name)}
+		}
+
+		if existing != nil {
+			g.ApplyGroup(existing)
+			changes = append(changes, Change{i.Options.fileGroups, fmt.Sprintf("updated group %s", g.GroupName)})
+		} else {
+			i.Groups.NewGroup(group)
+			changes = append(changes, Change{i.Options.fileGroups, fmt.Sprintf("created group %s with gid %d", g.GroupName, group.GID)})
+		}
+
+		if i.Gshadow != nil {
+			if old := i.gshadowEntry(g.GroupName); old != nil {
+				g.ApplyGshadow(old)
+			} else {
+				// A group which had no gshadow entry keeps its members.
+				gshd.Members = append([]string{}, i.Groups.GetGroup(g.GroupName).Users...)
+				i.Gshadow.NewEntry(gshd)
+			}
+		}
+	}
+
+	for _, u := range r.Users {
+		if err := ValidName(u.UserName); err != nil {
+			return nil, err
+		}
+
+		entry := u.Passwd()
+		existing := i.Passwd.GetUser(u.UserName)
+		if entry.UID < 0 && existing != nil {
+			entry.UID = existing.UID
+		} else if entry.UID < 0 {
+			uid, err := i.NextUID(u.Disposition == userdb.DispositionSystem)
+			if err != nil {
+				return nil, err
+			}
+			entry.UID = uid
+		}
+
+		if other := i.Passwd.GetUserByID(entry.UID); other != nil && other.Username != u.UserName {
+			return nil, &ErrExists{fmt.Sprintf("uid %d of %s is used by %s", entry.UID, u.UserName, other.Username)}
+		}
+
+		if entry.GID < 0 && existing != nil {
+			entry.GID = existing.GID
+		} else if entry.GID < 0 {
+			group := i.Groups.GetGroup(u.UserName)
+			if group == nil {
+				return nil, &ErrNotFound{fmt.Sprintf("user %s has no gid and no group of its name", u.UserName)}
+			}
+			entry.GID = group.GID
+		}
+
+		for _, name := range u.MemberOf {
+			group := i.Groups.GetGroup(name)
+			if group == nil {
+				return nil, &ErrNotFound{fmt.Sprintf("group %s of user %s does not exist", name, u.UserName)}
+			}
+
+			if !group.HasUser(u.UserName) {
+				group.AddUser(u.UserName)
+				if gshd := i.gshadowEntry(name); gshd != nil {
+					gshd.Members = append(gshd.Members, u.UserName)
+				}
+			}
+		}
+
+		if old := i.Shadow.GetUserEntry(u.UserName); old != nil {
+			u.ApplyShadow(old)
+		} else {
+			i.Shadow.NewEntry(u.Shadow())
+		}
+
+		if existing != nil {
+			u.ApplyPasswd(existing)
+			changes = append(changes, Change{i.Options.filePasswd, fmt.Sprintf("updated user %s", u.UserName)})
+		} else {
+			i.Passwd.NewEntry(entry)
+			changes = append(changes, Change{i.Options.filePasswd, fmt.Sprintf("created user %s with uid %d", u.UserName, entry.UID)})
+		}
+	}
+
+	return changes, nil
+}
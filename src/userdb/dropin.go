@@ -0,0 +1,236 @@
+package userdb
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DIR_USERDB holds drop-in records: NAME.user and NAME.group, with UID.user
+// and GID.group symlinks to them, the privileged sections in
+// NAME.user-privileged and NAME.group-privileged, and memberships as empty
+// USER:GROUP.membership files.
+const DIR_USERDB = "/etc/userdb"
+
+// Records are the users and groups of a drop-in directory.
+type Records struct {
+	Users  []*User
+	Groups []*Group
+}
+
+// LoadDir will read the records of a drop-in directory. The privileged
+// sections are merged in when they are readable, and memberships are added
+// to both records. A missing directory holds no records.
+func LoadDir(dir string) (*Records, error) {
+	r := &Records{}
+
+	names, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var memberships [][2]string
+	for _, info := range names {
+		name, ext := splitExt(info.Name())
+
+		// The numeric names are symlinks to the named records.
+		if _, err := strconv.Atoi(name); err == nil && (ext == ".user" || ext == ".group") {
+			continue
+		}
+
+		switch ext {
+		case ".user":
+			u := &User{}
+			if err := loadRecord(filepath.Join(dir, info.Name()), u); err != nil {
+				return nil, err
+			}
+
+			if err := loadPrivileged(filepath.Join(dir, name+".user-privileged"), &u.Privileged); err != nil {
+				return nil, err
+			}
+			r.Users = append(r.Users, u)
+		case ".group":
+			g := &Group{}
+			if err := loadRecord(filepath.Join(dir, info.Name()), g); err != nil {
+				return nil, err
+			}
+
+			if err := loadPrivileged(filepath.Join(dir, name+".group-privileged"), &g.Privileged); err != nil {
+				return nil, err
+			}
+			r.Groups = append(r.Groups, g)
+		case ".membership":
+			if parts := strings.SplitN(name, ":", 2); len(parts) == 2 {
+				memberships = append(memberships, [2]string{parts[0], parts[1]})
+			}
+		}
+	}
+
+	for _, m := range memberships {
+		if u := r.GetUser(m[0]); u != nil && !contains(u.MemberOf, m[1]) {
+			u.MemberOf = append(u.MemberOf, m[1])
+		}
+
+		if g := r.GetGroup(m[1]); g != nil && !contains(g.Members, m[0]) {
+			g.Members = append(g.Members, m[0])
+		}
+	}
+
+	return r, nil
+}
+
+// SaveDir will write the records as drop-ins, creating the directory if
+// needed. Privileged sections go to files only root can read, and every
+// record with an ID gets its numeric symlink. Memberships are kept in the
+// records, so no membership files are written.
+func (r *Records) SaveDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, u := range r.Users {
+		public := *u
+		public.Privileged = nil
+
+		if err := saveRecord(dir, u.UserName, ".user", &public, u.Privileged, u.UID); err != nil {
+			return err
+		}
+	}
+
+	for _, g := range r.Groups {
+		public := *g
+		public.Privileged = nil
+
+		if err := saveRecord(dir, g.GroupName, ".group", &public, g.Privileged, g.GID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetUser returns the user record called name, or nil.
+func (r *Records) GetUser(name string) *User {
+	for _, u := range r.Users {
+		if u.UserName == name {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// GetGroup returns the group record called name, or nil.
+func (r *Records) GetGroup(name string) *Group {
+	for _, g := range r.Groups {
+		if g.GroupName == name {
+			return g
+		}
+	}
+
+	return nil
+}
+
+// Sort orders the records by name, so exports are stable.
+func (r *Records) Sort() {
+	sort.Slice(r.Users, func(a, b int) bool { return r.Users[a].UserName < r.Users[b].UserName })
+	sort.Slice(r.Groups, func(a, b int) bool { return r.Groups[a].GroupName < r.Groups[b].GroupName })
+}
+
+// loadRecord reads one record file.
+func loadRecord(file string, dest interface{}) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	return Unmarshal(b, dest)
+}
+
+// loadPrivileged reads the privileged section kept next to a record. A
+// missing or unreadable file leaves it alone, since only root may read it.
+func loadPrivileged(file string, dest **Privileged) error {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) || os.IsPermission(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var section struct {
+		Privileged *Privileged `json:"privileged"`
+	}
+	if err := json.Unmarshal(b, &section); err != nil {
+		return err
+	}
+
+	if section.Privileged != nil {
+		*dest = section.Privileged
+	}
+
+	return nil
+}
+
+// saveRecord writes a record, its privileged section and its numeric
+// symlink.
+func saveRecord(dir, name, ext string, record interface{}, privileged *Privileged, id *int) error {
+	b, err := Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, name+ext), b, 0644); err != nil {
+		return err
+	}
+
+	if privileged != nil {
+		b, err := json.MarshalIndent(map[string]*Privileged{"privileged": privileged}, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		file := filepath.Join(dir, name+ext+"-privileged")
+		if err := ioutil.WriteFile(file, append(b, '\n'), 0600); err != nil {
+			return err
+		}
+
+		// WriteFile keeps the mode of an existing file.
+		if err := os.Chmod(file, 0600); err != nil {
+			return err
+		}
+	}
+
+	if id == nil {
+		return nil
+	}
+
+	link := filepath.Join(dir, strconv.Itoa(*id)+ext)
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Symlink(name+ext, link)
+}
+
+// splitExt splits a file name at its last dot.
+func splitExt(name string) (string, string) {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext), ext
+}
+
+// contains returns true if list holds s.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,383 @@
+package userdb
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/gshadow"
+	"github.com/mikemackintosh/wonka/src/logindefs"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/shadow"
+)
+
+// Dispositions of users and groups.
+const (
+	DispositionIntrinsic = "intrinsic"
+	DispositionSystem    = "system"
+	DispositionRegular   = "regular"
+)
+
+// usecPerDay converts shadow days to the microseconds used by records.
+const usecPerDay = uint64(24 * time.Hour / time.Microsecond)
+
+// User is a systemd JSON User Record, limited to the fields which have a
+// passwd or shadow counterpart.
+type User struct {
+	UserName      string   `json:"userName"`
+	RealName      string   `json:"realName,omitempty"`
+	UID           *int     `json:"uid,omitempty"`
+	GID           *int     `json:"gid,omitempty"`
+	MemberOf      []string `json:"memberOf,omitempty"`
+	HomeDirectory string   `json:"homeDirectory,omitempty"`
+	Shell         string   `json:"shell,omitempty"`
+	Disposition   string   `json:"disposition,omitempty"`
+	Locked        *bool    `json:"locked,omitempty"`
+
+	NotAfterUSec               *uint64 `json:"notAfterUSec,omitempty"`
+	LastPasswordChangeUSec     *uint64 `json:"lastPasswordChangeUSec,omitempty"`
+	PasswordChangeMinUSec      *uint64 `json:"passwordChangeMinUSec,omitempty"`
+	PasswordChangeMaxUSec      *uint64 `json:"passwordChangeMaxUSec,omitempty"`
+	PasswordChangeWarnUSec     *uint64 `json:"passwordChangeWarnUSec,omitempty"`
+	PasswordChangeInactiveUSec *uint64 `json:"passwordChangeInactiveUSec,omitempty"`
+	PasswordChangeNow          *bool   `json:"passwordChangeNow,omitempty"`
+
+	Privileged *Privileged `json:"privileged,omitempty"`
+}
+
+// Group is a systemd JSON Group Record.
+type Group struct {
+	GroupName      string   `json:"groupName"`
+	GID            *int     `json:"gid,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	Members        []string `json:"members,omitempty"`
+	Administrators []string `json:"administrators,omitempty"`
+	Disposition    string   `json:"disposition,omitempty"`
+
+	Privileged *Privileged `json:"privileged,omitempty"`
+}
+
+// Privileged is the section of a record only root may read.
+type Privileged struct {
+	HashedPassword []string `json:"hashedPassword,omitempty"`
+}
+
+// Unmarshal will unmarshal a JSON user or group record.
+func Unmarshal(data []byte, dest interface{}) error {
+	switch dest.(type) {
+	case *User, *Group:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of userdb.User or userdb.Group")
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return err
+	}
+
+	switch v := dest.(type) {
+	case *User:
+		if len(v.UserName) == 0 {
+			return errors.New("user record without userName")
+		}
+	case *Group:
+		if len(v.GroupName) == 0 {
+			return errors.New("group record without groupName")
+		}
+	}
+
+	return nil
+}
+
+// Marshal will encode a user or group record as indented JSON.
+func Marshal(in interface{}) ([]byte, error) {
+	switch in.(type) {
+	case *User, *Group:
+		break
+	default:
+		return nil, errors.New("must marshal userdb.User or userdb.Group")
+	}
+
+	b, err := json.MarshalIndent(in, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
+
+// NewUser converts passwd and shadow entries into a user record. shd may
+// be nil, and memberOf lists the supplementary groups. The disposition
+// comes from the login.defs ranges, or the defaults when policy is nil.
+func NewUser(entry passwd.Entry, shd *shadow.Entry, memberOf []string, policy *logindefs.Policy) *User {
+	if policy == nil {
+		policy = logindefs.Default()
+	}
+
+	uid, gid := entry.UID, entry.GID
+	u := &User{
+		UserName:      entry.Username,
+		RealName:      strings.SplitN(entry.Info, ",", 2)[0],
+		UID:           &uid,
+		GID:           &gid,
+		MemberOf:      memberOf,
+		HomeDirectory: entry.HomeDir,
+		Shell:         entry.Shell,
+		Disposition:   disposition(uid, policy.SysUIDMax),
+	}
+
+	if shd == nil {
+		return u
+	}
+
+	hash := shd.Password
+	if shd.IsLocked() {
+		locked := true
+		u.Locked = &locked
+		hash = strings.TrimPrefix(hash, "!")
+	}
+
+	if strings.HasPrefix(hash, "$") {
+		u.Privileged = &Privileged{HashedPassword: []string{hash}}
+	}
+
+	if shd.LastPasswordChange.MustChange() {
+		now := true
+		u.PasswordChangeNow = &now
+	} else if !shd.LastPasswordChange.IsUnset() {
+		u.LastPasswordChangeUSec = days(shd.LastPasswordChange)
+	}
+
+	if !shd.AccountExpiration.IsUnset() {
+		u.NotAfterUSec = days(shd.AccountExpiration)
+	}
+
+	u.PasswordChangeMinUSec = usec(shd.MinimumPasswordAge)
+	u.PasswordChangeMaxUSec = usec(shd.MaximumPasswordAge)
+	u.PasswordChangeWarnUSec = usec(shd.WarningPeriod)
+	u.PasswordChangeInactiveUSec = usec(shd.InactivityPeriod)
+
+	return u
+}
+
+// Passwd returns the passwd entry of a user record. Records without a UID
+// or GID get -1, which the caller has to allocate.
+func (u *User) Passwd() passwd.Entry {
+	entry := passwd.Entry{
+		Username: u.UserName,
+		Password: "x",
+		UID:      -1,
+		GID:      -1,
+		Info:     u.RealName,
+		HomeDir:  u.HomeDirectory,
+		Shell:    u.Shell,
+	}
+
+	if u.UID != nil {
+		entry.UID = *u.UID
+	}
+
+	if u.GID != nil {
+		entry.GID = *u.GID
+	}
+
+	return entry
+}
+
+// ApplyPasswd sets the fields of an existing passwd entry which the record
+// sets, leaving the others alone. The real name replaces the first field
+// of the GECOS, keeping the rest.
+func (u *User) ApplyPasswd(e *passwd.Entry) {
+	if u.UID != nil {
+		e.UID = *u.UID
+	}
+
+	if u.GID != nil {
+		e.GID = *u.GID
+	}
+
+	if len(u.RealName) > 0 {
+		fields := strings.SplitN(e.Info, ",", 2)
+		fields[0] = u.RealName
+		e.Info = strings.Join(fields, ",")
+	}
+
+	if len(u.HomeDirectory) > 0 {
+		e.HomeDir = u.HomeDirectory
+	}
+
+	if len(u.Shell) > 0 {
+		e.Shell = u.Shell
+	}
+}
+
+// Shadow returns the shadow entry of a user record. Without a hashed
+// password the account cannot be logged into with one.
+func (u *User) Shadow() *shadow.Entry {
+	e := &shadow.Entry{Username: u.UserName, Password: "!*"}
+	u.ApplyShadow(e)
+
+	return e
+}
+
+// ApplyShadow sets the fields of an existing shadow entry which the record
+// sets, leaving the others alone. Without a privileged section the hash is
+// kept, since records read without root have none, and only locked is
+// applied to it.
+func (u *User) ApplyShadow(e *shadow.Entry) {
+	if u.Privileged != nil && len(u.Privileged.HashedPassword) > 0 {
+		e.Password = u.Privileged.HashedPassword[0]
+	}
+
+	if u.Locked != nil && *u.Locked {
+		e.Lock()
+	}
+
+	if u.PasswordChangeNow != nil && *u.PasswordChangeNow {
+		e.LastPasswordChange = shadow.DateMustChange
+	} else if u.LastPasswordChangeUSec != nil {
+		e.LastPasswordChange = date(*u.LastPasswordChangeUSec)
+	}
+
+	if u.NotAfterUSec != nil {
+		e.AccountExpiration = date(*u.NotAfterUSec)
+	}
+
+	for _, f := range []struct {
+		usec *uint64
+		dest **time.Duration
+	}{
+		{u.PasswordChangeMinUSec, &e.MinimumPasswordAge},
+		{u.PasswordChangeMaxUSec, &e.MaximumPasswordAge},
+		{u.PasswordChangeWarnUSec, &e.WarningPeriod},
+		{u.PasswordChangeInactiveUSec, &e.InactivityPeriod},
+	} {
+		if f.usec != nil {
+			*f.dest = duration(f.usec)
+		}
+	}
+}
+
+// NewGroup converts group and gshadow entries into a group record. gshd
+// may be nil.
+func NewGroup(group *groups.Group, gshd *gshadow.Entry, policy *logindefs.Policy) *Group {
+	if policy == nil {
+		policy = logindefs.Default()
+	}
+
+	gid := group.GID
+	g := &Group{
+		GroupName:   group.Name,
+		GID:         &gid,
+		Members:     group.Users,
+		Disposition: disposition(gid, policy.SysGIDMax),
+	}
+
+	if gshd != nil {
+		g.Administrators = gshd.Admins
+		if strings.HasPrefix(gshd.Password, "$") {
+			g.Privileged = &Privileged{HashedPassword: []string{gshd.Password}}
+		}
+	}
+
+	return g
+}
+
+// Group returns the group entry of a group record. Records without a GID
+// get -1.
+func (g *Group) Group() *groups.Group {
+	group := &groups.Group{Name: g.GroupName, Password: "x", GID: -1, Users: g.Members}
+	if g.GID != nil {
+		group.GID = *g.GID
+	}
+
+	return group
+}
+
+// ApplyGroup sets the GID, members and hash of an existing group which the
+// record sets, leaving the others alone.
+func (g *Group) ApplyGroup(group *groups.Group) {
+	if g.GID != nil {
+		group.GID = *g.GID
+	}
+
+	if len(g.Members) > 0 {
+		group.Users = append([]string{}, g.Members...)
+	}
+
+	if g.Privileged != nil && len(g.Privileged.HashedPassword) > 0 {
+		group.Password = "x"
+	}
+}
+
+// ApplyGshadow sets the hash, administrators and members of an existing
+// gshadow entry which the record sets, leaving the others alone.
+func (g *Group) ApplyGshadow(e *gshadow.Entry) {
+	if g.Privileged != nil && len(g.Privileged.HashedPassword) > 0 {
+		e.Password = g.Privileged.HashedPassword[0]
+	}
+
+	if len(g.Administrators) > 0 {
+		e.Admins = append([]string{}, g.Administrators...)
+	}
+
+	if len(g.Members) > 0 {
+		e.Members = append([]string{}, g.Members...)
+	}
+}
+
+// Gshadow returns the gshadow entry of a group record.
+func (g *Group) Gshadow() *gshadow.Entry {
+	e := &gshadow.Entry{Name: g.GroupName, Password: "!*", Admins: g.Administrators, Members: g.Members}
+	if g.Privileged != nil && len(g.Privileged.HashedPassword) > 0 {
+		e.Password = g.Privileged.HashedPassword[0]
+	}
+
+	return e
+}
+
+// disposition classifies an ID the way systemd does: root and nobody are
+// intrinsic, IDs up to the system maximum are system ones.
+func disposition(id, systemMax int) string {
+	switch {
+	case id == 0 || id == 65534:
+		return DispositionIntrinsic
+	case id <= systemMax:
+		return DispositionSystem
+	}
+
+	return DispositionRegular
+}
+
+// days converts a shadow date to microseconds since the epoch.
+func days(d shadow.Date) *uint64 {
+	v := uint64(d.Days()) * usecPerDay
+	return &v
+}
+
+// date converts microseconds since the epoch to a shadow date.
+func date(v uint64) shadow.Date {
+	return shadow.DateFromDays(int64(v / usecPerDay))
+}
+
+// usec converts a shadow aging period to microseconds.
+func usec(d *time.Duration) *uint64 {
+	if d == nil {
+		return nil
+	}
+
+	v := uint64(*d / time.Microsecond)
+	return &v
+}
+
+// duration converts microseconds to a shadow aging period.
+func duration(v *uint64) *time.Duration {
+	if v == nil {
+		return nil
+	}
+
+	d := time.Duration(*v) * time.Microsecond
+	return &d
+}
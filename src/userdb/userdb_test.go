@@ -0,0 +1,118 @@
+package userdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/shadow"
+)
+
+func TestUserRoundTrip(t *testing.T) {
+	max := 90 * 24 * time.Hour
+	entry := passwd.Entry{Username: "alice", Password: "x", UID: 1000, GID: 1000, Info: "Alice,,,", HomeDir: "/home/alice", Shell: "/bin/bash"}
+	shd := &shadow.Entry{
+		Username:           "alice",
+		Password:           "!$6$salt$hash",
+		LastPasswordChange: shadow.DateFromDays(18000),
+		MaximumPasswordAge: &max,
+		AccountExpiration:  shadow.DateFromDays(19000),
+	}
+
+	u := NewUser(entry, shd, []string{"wheel"}, nil)
+	if u.Disposition != DispositionRegular || u.RealName != "Alice" || u.Locked == nil || !*u.Locked {
+		t.Errorf("unexpected record %#v", u)
+	}
+
+	if u.Privileged == nil || u.Privileged.HashedPassword[0] != "$6$salt$hash" {
+		t.Errorf("expected the hash without the lock, got %#v", u.Privileged)
+	}
+
+	b, err := Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var back User
+	if err := Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+
+	if p := back.Passwd(); p.UID != 1000 || p.GID != 1000 || p.Info != "Alice" || p.HomeDir != "/home/alice" {
+		t.Errorf("unexpected passwd entry %#v", p)
+	}
+
+	s := back.Shadow()
+	if s.Password != shd.Password || s.LastPasswordChange.Days() != 18000 || s.AccountExpiration.Days() != 19000 || *s.MaximumPasswordAge != max || s.MinimumPasswordAge != nil {
+		t.Errorf("unexpected shadow entry %#v", s)
+	}
+
+	if err := Unmarshal([]byte(`{"uid": 1}`), &User{}); err == nil {
+		t.Error("expected a record without a name to fail")
+	}
+}
+
+func TestDropins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "userdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entry := passwd.Entry{Username: "alice", UID: 1000, GID: 1000}
+	r := &Records{
+		Users:  []*User{NewUser(entry, &shadow.Entry{Password: "$6$salt$hash"}, nil, nil)},
+		Groups: []*Group{NewGroup(&groups.Group{Name: "alice", GID: 1000}, nil, nil), NewGroup(&groups.Group{Name: "wheel", GID: 10}, nil, nil)},
+	}
+
+	if err := r.SaveDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if link, err := os.Readlink(filepath.Join(dir, "1000.user")); err != nil || link != "alice.user" {
+		t.Errorf("expected a uid symlink, got %q %v", link, err)
+	}
+
+	if info, err := os.Stat(filepath.Join(dir, "alice.user-privileged")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected a private privileged section, got %v", err)
+	}
+
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "alice.user")); len(b) == 0 || string(b) != string(mustMarshal(t, &User{UserName: "alice", UID: r.Users[0].UID, GID: r.Users[0].GID, Disposition: DispositionRegular})) {
+		t.Errorf("expected the public record without the hash, got %s", b)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "alice:wheel.membership"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded.Users) != 1 || len(loaded.Groups) != 2 {
+		t.Fatalf("unexpected records %#v", loaded)
+	}
+
+	u := loaded.GetUser("alice")
+	if u.Privileged == nil || u.Privileged.HashedPassword[0] != "$6$salt$hash" || len(u.MemberOf) != 1 {
+		t.Errorf("unexpected user %#v", u)
+	}
+
+	if g := loaded.GetGroup("wheel"); len(g.Members) != 1 || g.Members[0] != "alice" {
+		t.Errorf("unexpected group %#v", g)
+	}
+}
+
+func mustMarshal(t *testing.T, in interface{}) []byte {
+	b, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
@@ -0,0 +1,422 @@
+package wonka
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/home"
+	"github.com/mikemackintosh/wonka/src/mail"
+	"github.com/mikemackintosh/wonka/src/managed"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/shadow"
+	"github.com/mikemackintosh/wonka/src/sshkeys"
+)
+
+// User describes an account to create with AddUser. Empty fields are filled
+// from /etc/default/useradd and login.defs.
+type User struct {
+	Name string
+	// UID and GID are picked from the login.defs ranges when nil.
+	UID *int
+	GID *int
+	// Group is the primary group name, used when GID is nil.
+	Group   string
+	Info    string
+	HomeDir string
+	Shell   string
+	// Password is hashed with ENCRYPT_METHOD on save. The account is locked
+	// when it is empty.
+	Password string
+	// System accounts use the system ID ranges and get no password aging.
+	System bool
+	// CreateHome overrides CREATE_HOME from login.defs. System accounts only
+	// get a home directory when it is set.
+	CreateHome *bool
+	// Skel overrides the useradd SKEL directory copied into the home.
+	Skel string
+	// UserGroup overrides USERGROUPS_ENAB from login.defs, like useradd -U
+	// and -N. It is ignored when GID or Group is set.
+	UserGroup *bool
+}
+
+// AddUser creates the passwd and shadow entries for a new account. Nothing
+// is written until Save is called.
+func (i *Instance) AddUser(u User) (*passwd.Entry, error) {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return nil, errNotLoaded
+	}
+
+	if err := ValidName(u.Name); err != nil {
+		return nil, err
+	}
+
+	if i.Passwd.GetUser(u.Name) != nil {
+		return nil, &ErrExists{fmt.Sprintf("user %s already exists", u.Name)}
+	}
+
+	usergroup := i.userGroup(u)
+	if usergroup && i.Groups.GetGroup(u.Name) != nil {
+		return nil, &ErrExists{fmt.Sprintf("group %s already exists, set the primary group instead", u.Name)}
+	}
+
+	var uid, gid int
+	var err error
+	if usergroup {
+		uid, gid, err = i.userPrivateIDs(u)
+	} else {
+		uid, err = i.userUID(u)
+		if err == nil {
+			gid, err = i.userGID(u)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := passwd.NewEntryWithDefaults(u.Name, "x", uid, gid, u.Info, u.HomeDir, u.Shell, i.Defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	shd := shadow.NewEntry(u.Name, i.Policy)
+	if u.System {
+		// Like useradd -r, system accounts have no aging information.
+		shd.MinimumPasswordAge = nil
+		shd.MaximumPasswordAge = nil
+		shd.WarningPeriod = nil
+	} else {
+		i.Defaults.ApplyShadow(shd)
+	}
+
+	if len(u.Password) > 0 {
+		shd.UpdatePassword(u.Password)
+	}
+
+	// System accounts do not get subordinate IDs, like useradd -r.
+	if !u.System {
+		if err := i.allocateSubids(u.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	i.Passwd.NewEntry(entry)
+	i.Shadow.NewEntry(shd)
+
+	if usergroup {
+		i.Groups.NewGroup(&groups.Group{Name: u.Name, Password: "x", GID: gid})
+		i.addGshadow(u.Name)
+	}
+
+	if i.createHome(u) {
+		skel := u.Skel
+		if len(skel) == 0 {
+			skel = i.Defaults.Skel
+		}
+
+		i.after(func() error {
+			return home.Create(i.Options.Root, entry.HomeDir, skel, entry.UID, entry.GID, i.Policy.HomeDirMode())
+		}, func() error {
+			return home.Remove(i.Options.Root, entry.HomeDir)
+		})
+	}
+
+	if i.createMailSpool() {
+		// Only a spool this call made is removed on rollback, never one
+		// which was already there.
+		var created bool
+		i.after(func() error {
+			gid, mode := i.mailGroup(entry.GID)
+			var err error
+			created, err = mail.Create(i.Options.Root, i.Policy.MailDir, entry.Username, entry.UID, gid, mode)
+			return err
+		}, func() error {
+			if !created {
+				return nil
+			}
+
+			return mail.Remove(i.Options.Root, i.Policy.MailDir, entry.Username)
+		})
+	}
+
+	return &entry, nil
+}
+
+// createMailSpool returns true if new accounts get a mail spool. The
+// useradd CREATE_MAIL_SPOOL default wins over login.defs.
+func (i *Instance) createMailSpool() bool {
+	if len(i.Policy.MailDir) == 0 {
+		return false
+	}
+
+	if i.Defaults.CreateMailSpool != nil {
+		return *i.Defaults.CreateMailSpool
+	}
+
+	return i.Policy.CreateMailSpool
+}
+
+// mailGroup returns the group and mode of a new mail spool. Like
+// shadow-utils, the spool belongs to the mail group with mode 0660, or to
+// the user's primary group with mode 0600 when there is no mail group.
+func (i *Instance) mailGroup(gid int) (int, os.FileMode) {
+	if group := i.Groups.GetGroup("mail"); group != nil {
+		return group.GID, mail.Mode
+	}
+
+	return gid, mail.PrivateMode
+}
+
+// createHome returns true if a home directory should be made for u.
+func (i *Instance) createHome(u User) bool {
+	if u.CreateHome != nil {
+		return *u.CreateHome
+	}
+
+	return !u.System && i.Policy.CreateHome
+}
+
+// userGroup returns true if a group named after the user should be created
+// as its primary group.
+func (i *Instance) userGroup(u User) bool {
+	if u.GID != nil || len(u.Group) > 0 {
+		return false
+	}
+
+	if u.UserGroup != nil {
+		return *u.UserGroup
+	}
+
+	return i.Policy.UserGroupsEnab
+}
+
+// userPrivateIDs returns the UID and the GID of the user-private group,
+// keeping them equal whenever that number is free in both files.
+func (i *Instance) userPrivateIDs(u User) (int, int, error) {
+	if u.UID == nil {
+		id, err := i.NextUIDGID(u.System)
+		if err == nil {
+			return id, id, nil
+		}
+	}
+
+	uid, err := i.userUID(u)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	if i.Groups.GetGroupByID(uid) == nil && i.gidAllocator(u.System).IsFree(uid) {
+		return uid, uid, nil
+	}
+
+	gid, err := i.NextGID(u.System)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	return uid, gid, nil
+}
+
+// userUID returns the requested UID if it is free, or allocates one.
+func (i *Instance) userUID(u User) (int, error) {
+	if u.UID == nil {
+		return i.NextUID(u.System)
+	}
+
+	if owner := i.Passwd.GetUserByID(*u.UID); owner != nil {
+		return -1, &ErrExists{fmt.Sprintf("uid %d is used by %s", *u.UID, owner.Username)}
+	}
+
+	return *u.UID, nil
+}
+
+// userGID resolves the primary group from the GID, the group name, or the
+// useradd GROUP default, which may be a name or a number.
+func (i *Instance) userGID(u User) (int, error) {
+	if u.GID != nil {
+		if i.Groups.GetGroupByID(*u.GID) == nil {
+			return -1, &ErrNotFound{fmt.Sprintf("group %d does not exist", *u.GID)}
+		}
+
+		return *u.GID, nil
+	}
+
+	name := u.Group
+	if len(name) == 0 {
+		name = i.Defaults.Group
+	}
+
+	if group := i.Groups.GetGroup(name); group != nil {
+		return group.GID, nil
+	}
+
+	if gid, err := strconv.Atoi(name); err == nil && i.Groups.GetGroupByID(gid) != nil {
+		return gid, nil
+	}
+
+	return -1, &ErrNotFound{fmt.Sprintf("group %s does not exist", name)}
+}
+
+// DeleteOptions control what DeleteUser removes besides the entries.
+type DeleteOptions struct {
+	// RemoveHome removes the home directory and mail spool, like userdel -r.
+	RemoveHome bool
+	// Force deletes the user even while it is logged in or has running
+	// processes, like userdel -f.
+	Force bool
+	// Kill terminates the processes of the user, killing those still
+	// running after Grace, which defaults to five seconds. It is refused
+	// for UID 0 and for a UID another user shares. The processes are
+	// terminated before anything is written, and stay terminated if Save
+	// fails afterwards.
+	Kill  bool
+	Grace time.Duration
+}
+
+// DeleteUser removes the passwd and shadow entries of an account, drops it
+// from every group member list and releases its subordinate IDs. Nothing
+// is written until Save is called.
+func (i *Instance) DeleteUser(name string, opts DeleteOptions) error {
+	if i.Passwd == nil || i.Shadow == nil || i.Groups == nil {
+		return errNotLoaded
+	}
+
+	found := i.Passwd.GetUser(name)
+	if found == nil {
+		return &ErrNotFound{fmt.Sprintf("user %s does not exist", name)}
+	}
+
+	// Copy the entry, since removing it shifts the entries.
+	entry := *found
+	dir := entry.HomeDir
+
+	// Check the home and processes before changing anything, so a refusal
+	// leaves the account untouched.
+	if err := i.checkBusy(name, entry.UID, opts.Force, opts.Kill, opts.Grace); err != nil {
+		return err
+	}
+
+	if opts.RemoveHome && len(dir) > 0 {
+		if err := home.CheckRemovable(i.Options.Root, i.Defaults.Home, dir, name, *i.Passwd); err != nil {
+			return err
+		}
+	}
+
+	if err := i.Passwd.RemoveEntry(entry); err != nil {
+		return err
+	}
+
+	if shd := i.Shadow.GetUserEntry(name); shd != nil {
+		if err := i.Shadow.RemoveEntry(shd); err != nil {
+			return err
+		}
+	}
+
+	for _, group := range *i.Groups {
+		group.RemoveUser(name)
+	}
+
+	if i.Gshadow != nil {
+		for _, entry := range *i.Gshadow {
+			entry.RemoveUser(name)
+		}
+	}
+	i.releaseSubids(name, entry.UID)
+	i.unmanage(managed.KindUser, name)
+
+	if i.Policy.UserGroupsEnab {
+		i.removeUserGroup(name, entry.GID)
+	}
+
+	if opts.RemoveHome && len(dir) > 0 {
+		i.after(func() error {
+			err := home.Remove(i.Options.Root, dir)
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}, nil)
+	}
+
+	if opts.RemoveHome && len(i.Policy.MailDir) > 0 {
+		i.after(func() error {
+			return mail.Remove(i.Options.Root, i.Policy.MailDir, name)
+		}, nil)
+	}
+
+	return nil
+}
+
+// removeUserGroup removes the group named after a deleted user when it is
+// still its private group: the GID matches, it has no members left and it
+// is not the primary group of anyone else.
+func (i *Instance) removeUserGroup(name string, gid int) {
+	group := i.Groups.GetGroup(name)
+	if group == nil || group.GID != gid || len(group.Users) > 0 {
+		return
+	}
+
+	for _, user := range *i.Passwd {
+		if user.GID == group.GID {
+			return
+		}
+	}
+
+	i.Groups.RemoveGroup(group)
+	i.removeGshadow(name)
+	i.unmanage(managed.KindGroup, name)
+}
+
+// MoveHome sets the home directory of an account, and when move is set
+// moves the existing directory there, like usermod -d -m. Nothing is
+// written until Save is called.
+func (i *Instance) MoveHome(name, dir string, move bool) error {
+	if i.Passwd == nil {
+		return errNotLoaded
+	}
+
+	entry := i.Passwd.GetUser(name)
+	if entry == nil {
+		return &ErrNotFound{fmt.Sprintf("user %s does not exist", name)}
+	}
+	old := entry.HomeDir
+
+	if move && len(old) > 0 && old != dir {
+		if err := home.CheckRemovable(i.Options.Root, i.Defaults.Home, old, name, *i.Passwd); err != nil {
+			return err
+		}
+
+		i.after(func() error {
+			return home.Move(i.Options.Root, old, dir)
+		}, func() error {
+			return home.Move(i.Options.Root, dir, old)
+		})
+	}
+
+	entry.HomeDir = dir
+	return nil
+}
+
+// addAuthorizedKeys queues adding keys to the authorized keys file of a
+// user, putting the previous file back if a later change fails.
+func (i *Instance) addAuthorizedKeys(entry passwd.Entry, keys []string) {
+	var old []byte
+	var existed bool
+	i.after(func() error {
+		var err error
+		if old, existed, err = sshkeys.Read(i.Options.Root, entry.HomeDir); err != nil {
+			return err
+		}
+
+		return sshkeys.Add(i.Options.Root, entry.HomeDir, keys, entry.UID, entry.GID)
+	}, func() error {
+		if existed {
+			return sshkeys.Write(i.Options.Root, entry.HomeDir, old, entry.UID, entry.GID)
+		}
+
+		return sshkeys.Remove(i.Options.Root, entry.HomeDir)
+	})
+}
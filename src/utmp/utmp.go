@@ -0,0 +1,220 @@
+package utmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+const (
+	FILE_UTMP = "/var/run/utmp"
+	FILE_WTMP = "/var/log/wtmp"
+)
+
+// Record types, from utmp.h.
+const (
+	EMPTY         = 0
+	RUN_LVL       = 1
+	BOOT_TIME     = 2
+	NEW_TIME      = 3
+	OLD_TIME      = 4
+	INIT_PROCESS  = 5
+	LOGIN_PROCESS = 6
+	USER_PROCESS  = 7
+	DEAD_PROCESS  = 8
+	ACCOUNTING    = 9
+)
+
+// RecordSize is the size of a utmp record on Linux, which is the same on
+// 32 and 64 bit platforms.
+const RecordSize = 384
+
+// record is the on-disk layout of struct utmp.
+type record struct {
+	Type    int16
+	_       int16
+	PID     int32
+	Line    [32]byte
+	ID      [4]byte
+	User    [32]byte
+	Host    [256]byte
+	Exit    [2]int16
+	Session int32
+	Sec     int32
+	Usec    int32
+	Addr    [4]uint32
+	_       [20]byte
+}
+
+// Entry is one utmp or wtmp record.
+type Entry struct {
+	Type    int
+	PID     int
+	Line    string
+	ID      string
+	User    string
+	Host    string
+	Session int
+	Time    time.Time
+	Addr    net.IP
+}
+
+type Entries []*Entry
+
+// Unmarshal will unmarshal the records of a utmp or wtmp file. A trailing
+// partial record, left by a writer that was interrupted, is ignored.
+func Unmarshal(data []byte, dest interface{}) error {
+	switch dest.(type) {
+	case *Entries:
+		break
+	default:
+		return errors.New("must unmarshal to pointer of utmp.Entries")
+	}
+
+	e := dest.(*Entries)
+	for n := 0; n+RecordSize <= len(data); n += RecordSize {
+		var r record
+		if err := binary.Read(bytes.NewReader(data[n:n+RecordSize]), binary.LittleEndian, &r); err != nil {
+			return err
+		}
+
+		*e = append(*e, &Entry{
+			Type:    int(r.Type),
+			PID:     int(r.PID),
+			Line:    cstring(r.Line[:]),
+			ID:      cstring(r.ID[:]),
+			User:    cstring(r.User[:]),
+			Host:    cstring(r.Host[:]),
+			Session: int(r.Session),
+			Time:    time.Unix(int64(r.Sec), int64(r.Usec)*int64(time.Microsecond)),
+			Addr:    addr(r.Addr),
+		})
+	}
+
+	return nil
+}
+
+// Marshal is a helper for utmp.Marshal().
+func (e Entries) Marshal() ([]byte, error) {
+	return Marshal(e)
+}
+
+// Marshal will encode entries in the utmp binary format.
+func Marshal(in interface{}) ([]byte, error) {
+	var entries Entries
+	switch v := in.(type) {
+	case Entries:
+		entries = v
+	case *Entries:
+		entries = *v
+	default:
+		return nil, errors.New("must marshal utmp.Entries")
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		r := record{
+			Type:    int16(entry.Type),
+			PID:     int32(entry.PID),
+			Session: int32(entry.Session),
+		}
+		copy(r.Line[:], entry.Line)
+		copy(r.ID[:], entry.ID)
+		copy(r.User[:], entry.User)
+		copy(r.Host[:], entry.Host)
+
+		if !entry.Time.IsZero() {
+			r.Sec = int32(entry.Time.Unix())
+			r.Usec = int32(entry.Time.Nanosecond() / int(time.Microsecond))
+		}
+
+		if ip := entry.Addr.To4(); ip != nil {
+			r.Addr[0] = binary.LittleEndian.Uint32(ip)
+		} else if ip := entry.Addr.To16(); ip != nil {
+			for n := range r.Addr {
+				r.Addr[n] = binary.LittleEndian.Uint32(ip[n*4:])
+			}
+		}
+
+		if err := binary.Write(&buf, binary.LittleEndian, &r); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// LoadFromFile will read a utmp or wtmp file.
+func LoadFromFile(file string) (*Entries, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entries
+	if err := Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// Sessions returns the login sessions of user, which are the USER_PROCESS
+// records in utmp.
+func (e *Entries) Sessions(user string) Entries {
+	var found Entries
+	for _, entry := range *e {
+		if entry.Type == USER_PROCESS && entry.User == user {
+			found = append(found, entry)
+		}
+	}
+
+	return found
+}
+
+// cstring returns the string up to the first NUL byte.
+func cstring(b []byte) string {
+	if n := bytes.IndexByte(b, 0); n >= 0 {
+		b = b[:n]
+	}
+
+	return string(b)
+}
+
+// addr returns the address of a record. IPv4 addresses only use the first
+// word, and unset addresses are nil.
+func addr(words [4]uint32) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	for n, w := range words {
+		binary.LittleEndian.PutUint32(ip[n*4:], w)
+	}
+
+	if words[1] == 0 && words[2] == 0 && words[3] == 0 {
+		if words[0] == 0 {
+			return nil
+		}
+		return net.IP(ip[:4]).To16()
+	}
+
+	return ip
+}
+
+// LastLogin returns the most recent login of user, or nil. In wtmp every
+// login appends a USER_PROCESS record.
+func (e *Entries) LastLogin(user string) *Entry {
+	var last *Entry
+	for _, entry := range *e {
+		if entry.Type != USER_PROCESS || entry.User != user {
+			continue
+		}
+
+		if last == nil || entry.Time.After(last.Time) {
+			last = entry
+		}
+	}
+
+	return last
+}
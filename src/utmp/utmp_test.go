@@ -0,0 +1,75 @@
+package utmp
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	login := time.Unix(1600000000, 500000000)
+	in := Entries{
+		{Type: BOOT_TIME, Line: "~", User: "reboot", Time: login},
+		{Type: USER_PROCESS, PID: 4242, Line: "pts/0", ID: "ts/0", User: "alice", Host: "10.0.0.1", Time: login, Addr: net.ParseIP("10.0.0.1")},
+		{Type: DEAD_PROCESS, PID: 4243, Line: "pts/1", User: "alice"},
+	}
+
+	b, err := in.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) != 3*RecordSize {
+		t.Fatalf("expected %d bytes, got %d", 3*RecordSize, len(b))
+	}
+
+	// A partial trailing record is ignored.
+	var out Entries
+	if err := Unmarshal(append(b, 0, 0, 0), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != len(in) {
+		t.Fatalf("expected %d entries, got %d", len(in), len(out))
+	}
+
+	got := out[1]
+	if got.PID != 4242 || got.Line != "pts/0" || got.User != "alice" || !got.Time.Equal(login) || !got.Addr.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("unexpected entry %#v", got)
+	}
+
+	if sessions := out.Sessions("alice"); len(sessions) != 1 || sessions[0].PID != 4242 {
+		t.Errorf("expected one session, got %#v", sessions)
+	}
+}
+
+func TestLastLogin(t *testing.T) {
+	e, err := LoadFromFile(filepath.Join("..", "..", "testing", "fixtures", "var", "log", "wtmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Have string
+		Want int64
+	}{
+		{Have: "root", Want: 1600100000},
+		{Have: "games", Want: 1400000000},
+		{Have: "nobody", Want: 0},
+	}
+
+	for testNum, test := range tests {
+		last := e.LastLogin(test.Have)
+		if test.Want == 0 {
+			if last != nil {
+				t.Errorf("%d) expected no login, got %#v", testNum, last)
+			}
+			continue
+		}
+
+		if last == nil || last.Time.Unix() != test.Want {
+			t.Errorf("%d) expected %d, got %#v", testNum, test.Want, last)
+		}
+	}
+}
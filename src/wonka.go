@@ -1,25 +1,86 @@
 package wonka
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mikemackintosh/wonka/src/groups"
+	"github.com/mikemackintosh/wonka/src/gshadow"
+	"github.com/mikemackintosh/wonka/src/lastlog"
+	"github.com/mikemackintosh/wonka/src/logindefs"
+	"github.com/mikemackintosh/wonka/src/managed"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/procs"
+	"github.com/mikemackintosh/wonka/src/shadow"
+	"github.com/mikemackintosh/wonka/src/subid"
+	"github.com/mikemackintosh/wonka/src/useradd"
+	"github.com/mikemackintosh/wonka/src/utmp"
 )
 
 const (
-	defaultFilePasswd = "/etc/passwd"
-	defaultFileGroups = "/etc/groups"
-	defaultFileShadow = "/etc/shadow"
+	defaultFilePasswd  = "/etc/passwd"
+	defaultFileGroups  = "/etc/group"
+	defaultFileShadow  = "/etc/shadow"
+	defaultFileSubuid  = "/etc/subuid"
+	defaultFileSubgid  = "/etc/subgid"
+	defaultFileGshadow = "/etc/gshadow"
+	defaultFileShells  = "/etc/shells"
 )
 
+// errNotLoaded is returned when the databases are used before Load.
+var errNotLoaded = errors.New("instance must be loaded first")
+
 type Options struct {
-	filePasswd string
-	fileGroups string
-	fileShadow string
-	expiry     int
+	// Root is the directory account files are read from, "/" by default.
+	Root string
+
+	filePasswd  string
+	fileGroups  string
+	fileShadow  string
+	fileSubuid  string
+	fileSubgid  string
+	fileGshadow string
+	fileUtmp    string
+	fileWtmp    string
+	fileLastlog string
+	fileManaged string
+	expiry      int
+
+	// procDir is where running processes are looked up. It is only set
+	// when Root is "/".
+	procDir string
 }
 
 type Instance struct {
-	Options Options
+	Options  Options
+	Policy   *logindefs.Policy
+	Defaults *useradd.Defaults
+	Passwd   *passwd.Entries
+	Shadow   *shadow.Entries
+	Groups   *groups.Entries
+
+	// Subuid and Subgid are nil when the files do not exist, in which case
+	// no subordinate IDs are handed out.
+	Subuid *subid.Entries
+	Subgid *subid.Entries
+
+	// Gshadow is nil when the file does not exist.
+	Gshadow *gshadow.Entries
+
+	// Managed records the users and groups created from specs. It is nil
+	// until the first one is, so the file is only written once needed.
+	Managed *managed.Entries
+
+	// prepare holds changes which cannot be undone, run by Save before it
+	// writes anything.
+	prepare []func() error
+
+	// pending holds filesystem changes run by Save once the databases have
+	// been written.
+	pending []action
 }
 
 func New() Instance {
@@ -32,7 +93,156 @@ func New() Instance {
 }
 
 func NewWithOptions(options Options) Instance {
-	return Instance{}
+	if len(options.Root) == 0 {
+		options.Root = "/"
+	}
+
+	if len(options.filePasswd) == 0 {
+		options.filePasswd = defaultFilePasswd
+	}
+
+	if len(options.fileGroups) == 0 {
+		options.fileGroups = defaultFileGroups
+	}
+
+	if len(options.fileShadow) == 0 {
+		options.fileShadow = defaultFileShadow
+	}
+
+	if len(options.fileSubuid) == 0 {
+		options.fileSubuid = defaultFileSubuid
+	}
+
+	if len(options.fileSubgid) == 0 {
+		options.fileSubgid = defaultFileSubgid
+	}
+
+	if len(options.fileGshadow) == 0 {
+		options.fileGshadow = defaultFileGshadow
+	}
+
+	if len(options.fileUtmp) == 0 {
+		options.fileUtmp = utmp.FILE_UTMP
+	}
+
+	if len(options.fileWtmp) == 0 {
+		options.fileWtmp = utmp.FILE_WTMP
+	}
+
+	if len(options.fileLastlog) == 0 {
+		options.fileLastlog = lastlog.FILE_LASTLOG
+	}
+
+	if len(options.fileManaged) == 0 {
+		options.fileManaged = managed.FILE_MANAGED
+	}
+
+	if len(options.procDir) == 0 && filepath.Clean(options.Root) == "/" {
+		options.procDir = procs.DIR_PROC
+	}
+
+	return Instance{
+		Options:  options,
+		Policy:   logindefs.Default(),
+		Defaults: useradd.Default(),
+	}
+}
+
+// LoadPolicy will read login.defs below the instance root. The policy
+// provides defaults for creating users, groups and shadow entries.
+func (i *Instance) LoadPolicy() error {
+	policy, err := logindefs.Load(i.Options.Root)
+	if err != nil {
+		return err
+	}
+
+	i.Policy = policy
+	return nil
+}
+
+// path returns file below the instance root.
+func (i *Instance) path(file string) string {
+	return filepath.Join(i.Options.Root, file)
+}
+
+// LoadDefaults will read /etc/default/useradd below the instance root.
+func (i *Instance) LoadDefaults() error {
+	defaults, err := useradd.Load(i.Options.Root)
+	if err != nil {
+		return err
+	}
+
+	i.Defaults = defaults
+	return nil
+}
+
+// Load will read login.defs, the useradd defaults, passwd, shadow, group,
+// gshadow, the subordinate ID files and the managed state below the
+// instance root. The last four are optional.
+func (i *Instance) Load() error {
+	if err := i.LoadPolicy(); err != nil {
+		return err
+	}
+
+	if err := i.LoadDefaults(); err != nil {
+		return err
+	}
+
+	pwd, err := passwd.LoadFromFile(i.path(i.Options.filePasswd))
+	if err != nil {
+		return err
+	}
+
+	shd, err := shadow.LoadFromFile(i.path(i.Options.fileShadow))
+	if err != nil {
+		return err
+	}
+
+	grp, err := groups.LoadFromFile(i.path(i.Options.fileGroups))
+	if err != nil {
+		return err
+	}
+
+	subuid, err := loadSubids(i.path(i.Options.fileSubuid))
+	if err != nil {
+		return err
+	}
+
+	subgid, err := loadSubids(i.path(i.Options.fileSubgid))
+	if err != nil {
+		return err
+	}
+
+	gshd, err := gshadow.LoadFromFile(i.path(i.Options.fileGshadow))
+	if os.IsNotExist(err) {
+		gshd = nil
+	} else if err != nil {
+		return err
+	}
+
+	mgd, err := managed.LoadFromFile(i.path(i.Options.fileManaged))
+	if os.IsNotExist(err) {
+		mgd = nil
+	} else if err != nil {
+		return err
+	}
+
+	i.Passwd, i.Shadow, i.Groups = pwd, shd, grp
+	i.Subuid, i.Subgid = subuid, subgid
+	i.Gshadow = gshd
+	i.Managed = mgd
+	return nil
+}
+
+// loadSubids reads a subuid or subgid file, returning nil if it does not
+// exist.
+func loadSubids(file string) (*subid.Entries, error) {
+	e, err := subid.LoadFromFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return e, err
 }
 
 type ErrListFileFailed struct {
@@ -0,0 +1,1675 @@
+package wonka
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mikemackintosh/wonka/src/cloudinit"
+	"github.com/mikemackintosh/wonka/src/export"
+	"github.com/mikemackintosh/wonka/src/gshadow"
+	"github.com/mikemackintosh/wonka/src/ignition"
+	"github.com/mikemackintosh/wonka/src/importer"
+	"github.com/mikemackintosh/wonka/src/managed"
+	"github.com/mikemackintosh/wonka/src/passwd"
+	"github.com/mikemackintosh/wonka/src/reap"
+	"github.com/mikemackintosh/wonka/src/shadow"
+	"github.com/mikemackintosh/wonka/src/spec"
+	"github.com/mikemackintosh/wonka/src/subid"
+	"github.com/mikemackintosh/wonka/src/sysusers"
+	"github.com/mikemackintosh/wonka/src/userdb"
+	"github.com/mikemackintosh/wonka/src/utmp"
+)
+
+// newTestInstance copies the fixtures into a temporary root and loads it.
+func newTestInstance(t *testing.T) (*Instance, func()) {
+	root, err := ioutil.TempDir("", "wonka")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"passwd", "shadow", "group"} {
+		b, err := ioutil.ReadFile(filepath.Join("..", "testing", "fixtures", "etc", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(root, "etc", name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	i := NewWithOptions(Options{Root: root})
+	if err := i.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &i, func() { os.RemoveAll(root) }
+}
+
+func TestAddUser(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	entry, err := i.AddUser(User{Name: "alice", Info: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.UID != 1000 || entry.GID != 100 || entry.HomeDir != "/home/alice" || entry.Shell != "/bin/sh" {
+		t.Errorf("unexpected entry %#v", entry)
+	}
+
+	system, err := i.AddUser(User{Name: "svc", System: true, Group: "nogroup"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if system.UID != 999 || system.GID != 65534 {
+		t.Errorf("unexpected system entry %#v", system)
+	}
+
+	if _, err := i.AddUser(User{Name: "alice"}); err == nil {
+		t.Error("expected duplicate user to fail")
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewWithOptions(i.Options)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if reloaded.Passwd.GetUser("alice") == nil || reloaded.Shadow.GetUserEntry("svc") == nil {
+		t.Error("expected new users to be saved")
+	}
+}
+
+func TestAddUserCreateHome(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	create := true
+	if _, err := i.AddUser(User{Name: "alice", CreateHome: &create, UserGroup: &create}); err != nil {
+		t.Fatal(err)
+	}
+
+	home := filepath.Join(i.Options.Root, "home", "alice")
+	if _, err := os.Stat(home); !os.IsNotExist(err) {
+		t.Fatal("expected home to be created on save only")
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("expected mode 0755 from the default umask, got %s", info.Mode())
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	create := true
+	if _, err := i.AddUser(User{Name: "alice", CreateHome: &create, UserGroup: &create}); err != nil {
+		t.Fatal(err)
+	}
+	i.Groups.GetGroup("staff").AddUser("alice")
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Homes outside of the home base are refused, and nothing changes.
+	if err := i.MoveHome("alice", "/srv/alice", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.DeleteUser("alice", DeleteOptions{RemoveHome: true}); err == nil {
+		t.Fatal("expected removal outside of the home base to be refused")
+	}
+
+	if err := i.MoveHome("alice", "/home/alice", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.DeleteUser("alice", DeleteOptions{RemoveHome: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if i.Passwd.GetUser("alice") != nil || i.Shadow.GetUserEntry("alice") != nil {
+		t.Error("expected entries to be removed")
+	}
+
+	for _, user := range i.Groups.GetGroup("staff").Users {
+		if user == "alice" {
+			t.Error("expected group membership to be removed")
+		}
+	}
+
+	if _, err := os.Lstat(filepath.Join(i.Options.Root, "home", "alice")); !os.IsNotExist(err) {
+		t.Error("expected home to be removed")
+	}
+}
+
+func TestDeleteUserBusy(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	entry, err := i.AddUser(User{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake a process owned by alice.
+	i.Options.procDir = filepath.Join(i.Options.Root, "proc")
+	status := fmt.Sprintf("Name:\tbash\nState:\tS (sleeping)\nUid:\t%d\t%d\t%d\t%d\n", entry.UID, entry.UID, entry.UID, entry.UID)
+	if err := os.MkdirAll(filepath.Join(i.Options.procDir, "4242"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(i.Options.procDir, "4242", "status"), []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.DeleteUser("alice", DeleteOptions{}); err == nil {
+		t.Fatal("expected deleting a user with processes to be refused")
+	} else if _, ok := err.(*ErrBusy); !ok {
+		t.Fatalf("unexpected error %T", err)
+	}
+
+	if _, err := i.Rename("alice", "bob", RenameOptions{}); err == nil {
+		t.Fatal("expected renaming a user with processes to be refused")
+	}
+
+	// A utmp session is enough to refuse.
+	if err := os.RemoveAll(filepath.Join(i.Options.procDir, "4242")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := utmp.Entries{{Type: utmp.USER_PROCESS, PID: 4242, Line: "pts/0", User: "alice"}}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(i.path(i.Options.fileUtmp)), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(i.path(i.Options.fileUtmp), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.DeleteUser("alice", DeleteOptions{}); err == nil {
+		t.Fatal("expected deleting a logged in user to be refused")
+	}
+
+	if i.Passwd.GetUser("alice") == nil {
+		t.Fatal("expected a refused delete to leave the user")
+	}
+
+	if err := i.DeleteUser("alice", DeleteOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteUserKillRefused(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	entry, err := i.AddUser(User{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Accounts sharing a UID, like those made with useradd -o.
+	i.Passwd.NewEntry(passwd.Entry{Username: "toor", Password: "x", UID: 0, GID: 0, HomeDir: "/root", Shell: "/bin/sh"})
+	i.Passwd.NewEntry(passwd.Entry{Username: "alias", Password: "x", UID: entry.UID, GID: entry.GID, HomeDir: "/home/alias", Shell: "/bin/sh"})
+
+	var tests = []struct {
+		name string
+	}{
+		{"toor"},
+		{"alice"},
+		{"alias"},
+	}
+
+	for testNum, test := range tests {
+		if err := i.DeleteUser(test.name, DeleteOptions{Kill: true}); err == nil {
+			t.Errorf("%d) expected killing the processes of %s to be refused", testNum, test.name)
+		} else if _, ok := err.(*ErrBusy); !ok {
+			t.Errorf("%d) unexpected error %T", testNum, err)
+		}
+
+		if i.Passwd.GetUser(test.name) == nil {
+			t.Errorf("%d) expected %s to be kept", testNum, test.name)
+		}
+	}
+}
+
+func TestAddUserMailSpool(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	spool := true
+	i.Defaults.CreateMailSpool = &spool
+
+	if _, err := i.AddUser(User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(filepath.Join(i.Options.Root, "var", "mail", "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode() != 0660 {
+		t.Errorf("expected mode 0660, got %s", info.Mode())
+	}
+
+	if err := i.DeleteUser("alice", DeleteOptions{RemoveHome: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(i.Options.Root, "var", "mail", "alice")); !os.IsNotExist(err) {
+		t.Error("expected the spool to be removed")
+	}
+}
+
+func TestAddUserExistingSpool(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	spool := true
+	i.Defaults.CreateMailSpool = &spool
+
+	// A leftover mailbox of the UID the new user gets is kept, and a failed
+	// save must not remove it.
+	path := filepath.Join(i.Options.Root, "var", "mail", "alice")
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("From old mail\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chown(path, 1000, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := i.AddUser(User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	i.after(func() error { return fmt.Errorf("failed") }, nil)
+
+	if err := i.Save(); err == nil {
+		t.Fatal("expected the save to fail")
+	}
+
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != "From old mail\n" {
+		t.Errorf("expected the existing spool to be kept, got %q %v", b, err)
+	}
+
+	// A spool of another UID is refused.
+	if err := os.Chown(path, 2000, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	i, cleanup2 := newTestInstance(t)
+	defer cleanup2()
+	i.Defaults.CreateMailSpool = &spool
+	if err := os.MkdirAll(filepath.Join(i.Options.Root, "var", "mail"), 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(path, filepath.Join(i.Options.Root, "var", "mail", "alice")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := i.AddUser(User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.Save(); err == nil {
+		t.Error("expected a spool of another uid to be refused")
+	}
+}
+
+func TestAddUserSubids(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	if err := ioutil.WriteFile(filepath.Join(i.Options.Root, "etc", "subuid"), []byte("root:100000:65536\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := i.AddUser(User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ranges := i.Subuid.GetRanges("alice")
+	if len(ranges) != 1 || ranges[0].Start != 165536 {
+		t.Fatalf("unexpected ranges %#v", ranges)
+	}
+
+	if i.Subgid != nil {
+		t.Error("expected no subgid without the file")
+	}
+
+	if err := i.DeleteUser("alice", DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(i.Subuid.GetRanges("alice")) != 0 {
+		t.Error("expected the range to be released")
+	}
+}
+
+func TestUserPrivateGroup(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+	i.Policy.UserGroupsEnab = true
+
+	// Take 1000 as a GID only, so the pair must skip it.
+	gid := 1000
+	if _, err := i.AddGroup(Group{Name: "taken", GID: &gid}); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := i.AddUser(User{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := i.Groups.GetGroup("alice")
+	if group == nil || alice.UID != 1001 || group.GID != alice.UID || alice.GID != group.GID {
+		t.Fatalf("unexpected user %#v and group %#v", alice, group)
+	}
+
+	// A user sharing the private group keeps it around.
+	if _, err := i.AddUser(User{Name: "bob", Group: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.DeleteUser("alice", DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if i.Groups.GetGroup("alice") == nil {
+		t.Fatal("expected the group to be kept while it is bob's primary group")
+	}
+
+	if err := i.DeleteGroup("alice"); err == nil {
+		t.Error("expected removing bob's primary group to fail")
+	}
+
+	// Without other users it goes with its user.
+	if _, err := i.AddUser(User{Name: "carol"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.DeleteUser("carol", DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if i.Groups.GetGroup("carol") != nil {
+		t.Error("expected the private group to be removed")
+	}
+}
+
+func TestRename(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+	root := i.Options.Root
+
+	files := map[string]string{
+		"etc/gshadow":                   "staff:!:alice:alice,bob\n",
+		"etc/subuid":                    "root:100000:65536\n",
+		"var/spool/cron/crontabs/alice": "* * * * * true\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := i.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	spool, create := true, true
+	i.Defaults.CreateMailSpool = &spool
+	if _, err := i.AddUser(User{Name: "alice", CreateHome: &create}); err != nil {
+		t.Fatal(err)
+	}
+	i.Groups.GetGroup("staff").AddUser("alice")
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := i.Rename("alice", "alicia", RenameOptions{MoveHome: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// passwd, shadow, group, gshadow, subuid, spool, crontab and home.
+	if len(changes) != 8 {
+		t.Errorf("expected 8 changes, got %v", changes)
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewWithOptions(i.Options)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	user := reloaded.Passwd.GetUser("alicia")
+	if user == nil || user.HomeDir != "/home/alicia" || reloaded.Shadow.GetUserEntry("alicia") == nil {
+		t.Fatalf("expected alicia in passwd and shadow, got %#v", user)
+	}
+
+	if !reloaded.Groups.GetGroup("staff").HasUser("alicia") {
+		t.Error("expected group membership to be renamed")
+	}
+
+	gshd := reloaded.Gshadow.GetEntry("staff")
+	if gshd.Admins[0] != "alicia" || gshd.Members[0] != "alicia" {
+		t.Errorf("expected gshadow lists to be renamed, got %#v", gshd)
+	}
+
+	if len(reloaded.Subuid.GetRanges("alicia")) != 1 {
+		t.Error("expected subordinate ranges to be renamed")
+	}
+
+	for _, path := range []string{"home/alicia", "var/mail/alicia", "var/spool/cron/crontabs/alicia"} {
+		if _, err := os.Lstat(filepath.Join(root, path)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err := i.Rename("alicia", "root", RenameOptions{}); err == nil {
+		t.Error("expected renaming onto an existing user to fail")
+	}
+}
+
+func TestSaveRollback(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	before, err := ioutil.ReadFile(filepath.Join(i.Options.Root, "etc", "passwd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := i.AddUser(User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	undone := false
+	i.after(func() error { return nil }, func() error { undone = true; return nil })
+	i.after(func() error { return os.ErrPermission }, nil)
+
+	if err := i.Save(); err != os.ErrPermission {
+		t.Fatalf("expected the queued error, got %v", err)
+	}
+
+	after, err := ioutil.ReadFile(filepath.Join(i.Options.Root, "etc", "passwd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(before) != string(after) || !undone {
+		t.Error("expected the save to be rolled back")
+	}
+}
+
+func TestRenumberUser(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	create := true
+	if _, err := i.AddUser(User{Name: "alice", CreateHome: &create, UserGroup: &create}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	dry, err := i.RenumberUser("alice", 2000, RenumberOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dry) < 2 || i.Passwd.GetUser("alice").UID != 1000 {
+		t.Fatalf("unexpected dry run %v", dry)
+	}
+
+	if _, err := i.RenumberUser("alice", 0, RenumberOptions{}); err == nil {
+		t.Error("expected a used uid to fail")
+	}
+
+	if _, err := i.RenumberUser("alice", 2000, RenumberOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(filepath.Join(i.Options.Root, "home", "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Sys().(*syscall.Stat_t).Uid != 2000 {
+		t.Error("expected the home to be chowned")
+	}
+}
+
+func TestLastLogins(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	if err := os.MkdirAll(filepath.Join(i.Options.Root, "var", "log"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"lastlog", "wtmp"} {
+		b, err := ioutil.ReadFile(filepath.Join("..", "testing", "fixtures", "var", "log", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(i.Options.Root, "var", "log", name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logins, err := i.LastLogins()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(logins) != len(*i.Passwd) {
+		t.Fatalf("expected %d logins, got %d", len(*i.Passwd), len(logins))
+	}
+
+	tests := []struct {
+		Have string
+		Want int64
+		Line string
+	}{
+		// wtmp is newer than lastlog.
+		{Have: "root", Want: 1600100000, Line: "pts/1"},
+		// Only in lastlog.
+		{Have: "www-data", Want: 1500000000, Line: "tty1"},
+		// Only in wtmp.
+		{Have: "games", Want: 1400000000, Line: "tty2"},
+	}
+
+	for testNum, test := range tests {
+		login, err := i.LastLogin(test.Have)
+		if err != nil {
+			t.Fatalf("%d) %s", testNum, err)
+		}
+
+		if login.Time.Unix() != test.Want || login.Line != test.Line {
+			t.Errorf("%d) expected %d on %s, got %#v", testNum, test.Want, test.Line, login)
+		}
+	}
+
+	login, err := i.LastLogin("daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !login.Time.IsZero() {
+		t.Errorf("expected daemon to never have logged in, got %s", login.Time)
+	}
+}
+
+func TestReap(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := i.AddUser(User{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// alice has not changed her password, or logged in, for 100 days.
+	i.Shadow.GetUserEntry("alice").LastPasswordChange = shadow.Today().AddDays(-100)
+
+	policy := reap.Default()
+	policy.Action = reap.ActionLock
+
+	stale, err := i.Reap(policy, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stale) != 1 || stale[0].User != "alice" {
+		t.Fatalf("unexpected stale accounts %#v", stale)
+	}
+
+	if shd := i.Shadow.GetUserEntry("alice"); !shd.IsLocked() || shd.AccountExpiration.Days() != 1 {
+		t.Errorf("expected alice to be locked, got %#v", shd)
+	}
+
+	// Locked accounts are not locked again.
+	if stale, err := i.Stale(policy, time.Now()); err != nil || len(stale) != 0 {
+		t.Errorf("expected nothing left to lock, got %#v %v", stale, err)
+	}
+
+	policy.Action = reap.ActionDelete
+	if _, err := i.Reap(policy, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if i.Passwd.GetUser("alice") != nil || i.Passwd.GetUser("bob") == nil {
+		t.Error("expected only alice to be deleted")
+	}
+}
+
+func TestReapBusy(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := i.AddUser(User{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+		i.Shadow.GetUserEntry(name).LastPasswordChange = shadow.Today().AddDays(-100)
+	}
+
+	// alice is logged in, so she cannot be deleted.
+	i.Options.procDir = filepath.Join(i.Options.Root, "proc")
+	if err := os.MkdirAll(i.Options.procDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := utmp.Entries{{Type: utmp.USER_PROCESS, PID: 4242, Line: "pts/0", User: "alice"}}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(i.path(i.Options.fileUtmp)), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(i.path(i.Options.fileUtmp), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := reap.Default()
+	policy.Action = reap.ActionDelete
+
+	stale, err := i.Reap(policy, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stale) != 2 || len(stale[0].Error) == 0 || len(stale[1].Error) != 0 {
+		t.Fatalf("unexpected stale accounts %#v", stale)
+	}
+
+	if i.Passwd.GetUser("alice") == nil || i.Passwd.GetUser("bob") != nil {
+		t.Error("expected bob to be deleted while alice is kept")
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	for _, name := range []string{"bob", "carol"} {
+		if _, err := i.AddUser(User{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	i.Groups.GetGroup("staff").AddUser("bob")
+
+	gid := 2000
+	s := &spec.Spec{
+		Groups: []spec.Group{{Name: "developers", GID: &gid}},
+		Users: []spec.User{
+			{Name: "alice", Groups: []string{"developers"}, Shell: "/bin/bash"},
+			{Name: "bob", Groups: []string{"developers"}, Shell: "/bin/bash", Group: "developers"},
+			{Name: "carol", State: spec.StateAbsent},
+		},
+	}
+
+	plan, err := i.Plan(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"create group developers", "create user alice", "update user bob", "update group staff", "delete user carol"}
+	if len(plan.Steps) != len(want) {
+		t.Fatalf("unexpected plan\n%s", plan)
+	}
+
+	for n, step := range plan.Steps {
+		if got := step.Action + " " + step.Kind + " " + step.Name; got != want[n] {
+			t.Errorf("%d) expected %q, got %q", n, want[n], got)
+		}
+	}
+
+	if err := i.Apply(plan); err != nil {
+		t.Fatal(err)
+	}
+
+	bob := i.Passwd.GetUser("bob")
+	if bob.Shell != "/bin/bash" || bob.GID != gid {
+		t.Errorf("unexpected bob %#v", bob)
+	}
+
+	if i.Groups.GetGroup("staff").HasUser("bob") || !i.Groups.GetGroup("developers").HasUser("alice") {
+		t.Error("expected memberships to match the spec")
+	}
+
+	if i.Passwd.GetUser("carol") != nil {
+		t.Error("expected carol to be removed")
+	}
+
+	// Applying twice changes nothing.
+	plan, err = i.Plan(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !plan.Empty() {
+		t.Errorf("expected an empty plan, got\n%s", plan)
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlanOwnership(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	create := true
+	if _, err := i.AddUser(User{Name: "alice", CreateHome: &create, UserGroup: &create}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	uid, gid := 2500, 2500
+	s := &spec.Spec{
+		Groups: []spec.Group{{Name: "alice", GID: &gid}},
+		Users:  []spec.User{{Name: "alice", UID: &uid}},
+	}
+
+	plan, err := i.Plan(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Steps) != 2 {
+		t.Fatalf("unexpected plan\n%s", plan)
+	}
+
+	for n, step := range plan.Steps {
+		if len(step.Files) == 0 || !strings.HasPrefix(step.Files[0], "/home/alice: ") {
+			t.Errorf("%d) expected the home of alice in %q", n, step.Files)
+			continue
+		}
+
+		if !strings.Contains(plan.String(), "    "+step.Files[0]) {
+			t.Errorf("%d) expected %q in the plan\n%s", n, step.Files[0], plan)
+		}
+	}
+
+	if i.Passwd.GetUser("alice").UID == uid {
+		t.Error("expected planning to leave the uid alone")
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	changed, changes, err := i.EnsureGroup(spec.Group{Name: "developers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !changed || len(changes) != 1 || changes[0].Field != "gid" {
+		t.Errorf("unexpected group changes %v", changes)
+	}
+
+	u := spec.User{Name: "alice", Shell: "/bin/bash", Groups: []string{"developers"}}
+	changed, changes, err = i.EnsureUser(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !changed || changes[len(changes)-1].String() != "groups: (none) -> developers" {
+		t.Errorf("unexpected user changes %v", changes)
+	}
+
+	// Nothing changes the second time.
+	if changed, changes, err := i.EnsureUser(u); err != nil || changed || len(changes) != 0 {
+		t.Errorf("expected no changes, got %v %v", changes, err)
+	}
+
+	u.Shell = "/bin/zsh"
+	u.Groups = []string{"staff"}
+	_, changes, err = i.EnsureUser(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Have FieldChange
+		Want string
+	}{
+		{Have: changes[0], Want: "shell: /bin/bash -> /bin/zsh"},
+		{Have: changes[1], Want: "groups: developers -> staff"},
+	}
+
+	for testNum, test := range tests {
+		if got := test.Have.String(); got != test.Want {
+			t.Errorf("%d) expected %q, got %q", testNum, test.Want, got)
+		}
+	}
+
+	changed, changes, err = i.EnsureGroup(spec.Group{Name: "staff", Members: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !changed || len(changes) != 1 || changes[0].Field != "members" {
+		t.Errorf("unexpected group changes %v", changes)
+	}
+
+	if changed, _, err := i.EnsureUser(spec.User{Name: "alice", State: spec.StateAbsent}); err != nil || !changed {
+		t.Errorf("expected alice to be removed, got %v", err)
+	}
+
+	if changed, _, err := i.EnsureUser(spec.User{Name: "alice", State: spec.StateAbsent}); err != nil || changed {
+		t.Errorf("expected no changes, got %v", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	// bob exists before wonka manages anything, so it is never pruned.
+	if _, err := i.AddUser(User{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &spec.Spec{
+		Groups: []spec.Group{{Name: "developers"}},
+		Users:  []spec.User{{Name: "alice", Group: "developers"}, {Name: "bob"}},
+	}
+
+	plan, err := i.Plan(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.Apply(plan); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The managed state survives a reload.
+	if err := i.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if i.Managed == nil || !i.Managed.Has(managed.KindUser, "alice") || i.Managed.Has(managed.KindUser, "bob") {
+		t.Fatalf("unexpected managed state %#v", i.Managed)
+	}
+
+	s = &spec.Spec{}
+	if plan, err := i.Plan(s); err != nil || !plan.Empty() {
+		t.Fatalf("expected nothing to change without pruning, got %v %v", plan, err)
+	}
+
+	plan, err = i.PlanWithOptions(s, PlanOptions{Prune: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Steps) != 2 || plan.Steps[0].Name != "alice" || plan.Steps[1].Name != "developers" {
+		t.Fatalf("unexpected plan\n%s", plan)
+	}
+
+	if err := i.Apply(plan); err != nil {
+		t.Fatal(err)
+	}
+
+	if i.Passwd.GetUser("alice") != nil || i.Groups.GetGroup("developers") != nil || i.Passwd.GetUser("bob") == nil {
+		t.Error("expected only alice and developers to be pruned")
+	}
+
+	if len(*i.Managed) != 0 {
+		t.Errorf("expected the managed state to be empty, got %#v", *i.Managed)
+	}
+}
+
+func TestApplySysusers(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	files := map[string]string{
+		"usr/lib/sysusers.d/base.conf": `# base accounts
+g input -
+u systemd-network - "systemd Network Management"
+u svc 180:input
+u! locked 190 - /var/lib/locked
+m svc adm
+m helper extra
+`,
+		"usr/lib/sysusers.d/masked.conf":   "u masked -\n",
+		"usr/lib/sysusers.d/override.conf": "u over 400\n",
+		"etc/sysusers.d/override.conf":     "u over 300\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(i.Options.Root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink(os.DevNull, filepath.Join(i.Options.Root, "etc", "sysusers.d", "masked.conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := sysusers.Load(i.Options.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := i.ApplySysusers(*entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := []struct {
+		Name  string
+		UID   int
+		GID   int
+		Home  string
+		Shell string
+	}{
+		{"systemd-network", 997, 997, "/", "/usr/sbin/nologin"},
+		{"svc", 180, 999, "/", "/usr/sbin/nologin"},
+		{"locked", 190, 190, "/var/lib/locked", "/usr/sbin/nologin"},
+		{"over", 300, 300, "/", "/usr/sbin/nologin"},
+		{"helper", 996, 996, "/", "/usr/sbin/nologin"},
+	}
+
+	for testNum, test := range users {
+		entry := i.Passwd.GetUser(test.Name)
+		if entry == nil {
+			t.Errorf("%d) expected user %s", testNum, test.Name)
+			continue
+		}
+
+		if entry.UID != test.UID || entry.GID != test.GID || entry.HomeDir != test.Home || entry.Shell != test.Shell {
+			t.Errorf("%d) unexpected entry %#v", testNum, entry)
+		}
+
+		if shd := i.Shadow.GetUserEntry(test.Name); shd == nil || shd.Password != "!*" {
+			t.Errorf("%d) expected a locked shadow entry, got %#v", testNum, shd)
+		}
+	}
+
+	if i.Passwd.GetUser("masked") != nil {
+		t.Error("expected masked.conf to be skipped")
+	}
+
+	if i.Shadow.GetUserEntry("locked").AccountExpiration.Days() != 1 {
+		t.Error("expected u! to expire the account")
+	}
+
+	if !i.Groups.GetGroup("adm").HasUser("svc") || !i.Groups.GetGroup("extra").HasUser("helper") {
+		t.Error("expected m lines to add members")
+	}
+
+	if group := i.Groups.GetGroup("input"); group == nil || group.GID != 999 {
+		t.Errorf("unexpected group %#v", group)
+	}
+
+	if len(changes) != 13 {
+		t.Errorf("expected 13 changes, got %d: %v", len(changes), changes)
+	}
+
+	// Applying again changes nothing.
+	if changes, err := i.ApplySysusers(*entries); err != nil || len(changes) != 0 {
+		t.Errorf("expected no changes, got %v %v", changes, err)
+	}
+}
+
+func TestApplySysusersIDs(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	// Subordinate ranges at the top of the system range are skipped, like
+	// NextUID does.
+	i.Subuid = &subid.Entries{{Name: "alice", Start: 995, Count: 5}}
+	i.Subgid = &subid.Entries{{Name: "alice", Start: 995, Count: 5}}
+
+	entries := sysusers.Entries{
+		{Type: sysusers.TypeUser, Name: "daemon2"},
+		{Type: sysusers.TypeUser, Name: "mailer", ID: "150:8"},
+	}
+
+	if _, err := i.ApplySysusers(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry := i.Passwd.GetUser("daemon2"); entry == nil || entry.UID != 994 || entry.GID != 994 {
+		t.Errorf("unexpected entry %#v", entry)
+	}
+
+	// A GID an existing group has makes it the primary group.
+	if entry := i.Passwd.GetUser("mailer"); entry == nil || entry.UID != 150 || entry.GID != 8 {
+		t.Errorf("unexpected entry %#v", entry)
+	}
+
+	if i.Groups.GetGroup("mailer") != nil {
+		t.Error("expected no group to be made for mailer")
+	}
+}
+
+func TestUserdb(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	if _, err := i.AddUser(User{Name: "alice", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	i.Groups.GetGroup("staff").AddUser("alice")
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.ExportUserdb(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := userdb.LoadDir(i.path(userdb.DIR_USERDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records.Users) != len(*i.Passwd) || len(records.Groups) != len(*i.Groups) {
+		t.Fatalf("expected every entry to be exported, got %d users and %d groups", len(records.Users), len(records.Groups))
+	}
+
+	other, cleanupOther := newTestInstance(t)
+	defer cleanupOther()
+
+	alice := records.GetUser("alice")
+	if _, err := other.ImportUserdb(&userdb.Records{Users: []*userdb.User{alice}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, want := other.Passwd.GetUser("alice"), i.Passwd.GetUser("alice")
+	if got == nil || got.UID != want.UID || got.GID != want.GID || got.HomeDir != want.HomeDir || got.Shell != want.Shell {
+		t.Errorf("expected %#v, got %#v", want, got)
+	}
+
+	if other.Shadow.GetUserEntry("alice").Password != i.Shadow.GetUserEntry("alice").Password {
+		t.Error("expected the hashed password to be imported")
+	}
+
+	if !other.Groups.GetGroup("staff").HasUser("alice") {
+		t.Error("expected memberships to be imported")
+	}
+}
+
+func TestUserdbReimport(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	if _, err := i.AddUser(User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	shd := i.Shadow.GetUserEntry("alice")
+	shd.Password = "$6$salt$hash"
+	shd.AccountExpiration = shadow.DateFromDays(20000)
+	max := 90 * 24 * time.Hour
+	shd.MaximumPasswordAge = &max
+	before := *shd
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.ExportUserdb(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without root the privileged sections cannot be read, so the records
+	// have no hash.
+	dir := i.path(userdb.DIR_USERDB)
+	privileged, _ := filepath.Glob(filepath.Join(dir, "*-privileged"))
+	for _, file := range privileged {
+		if err := os.Remove(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := userdb.LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := records.GetUser("alice")
+	if alice.Privileged != nil {
+		t.Fatal("expected no privileged section")
+	}
+	alice.NotAfterUSec = nil
+	alice.PasswordChangeMaxUSec = nil
+
+	if _, err := i.ImportUserdb(&userdb.Records{Users: []*userdb.User{alice}}); err != nil {
+		t.Fatal(err)
+	}
+
+	after := i.Shadow.GetUserEntry("alice")
+	if after.Password != before.Password {
+		t.Errorf("expected the hash to be kept, got %q", after.Password)
+	}
+
+	if after.AccountExpiration != before.AccountExpiration || after.LastPasswordChange != before.LastPasswordChange {
+		t.Errorf("expected the dates the record does not set to be kept, got %#v", after)
+	}
+
+	if after.MaximumPasswordAge == nil || *after.MaximumPasswordAge != max {
+		t.Errorf("expected the aging to be kept, got %v", after.MaximumPasswordAge)
+	}
+}
+
+func TestUserdbUpdateSparse(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	if _, err := i.AddUser(User{Name: "alice", Group: "users", Info: "Alice,Room 1", HomeDir: "/srv/alice", Shell: "/bin/bash"}); err != nil {
+		t.Fatal(err)
+	}
+
+	staff := i.Groups.GetGroup("staff")
+	staff.Users = []string{"alice", "bob"}
+	i.Gshadow = &gshadow.Entries{{Name: "staff", Password: "$6$salt$group", Admins: []string{"alice"}, Members: []string{"alice", "bob"}}}
+	before := *i.Passwd.GetUser("alice")
+
+	// Records which only name the user and group change nothing.
+	r := &userdb.Records{
+		Users:  []*userdb.User{{UserName: "alice"}},
+		Groups: []*userdb.Group{{GroupName: "staff"}},
+	}
+	if _, err := i.ImportUserdb(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if after := *i.Passwd.GetUser("alice"); !reflect.DeepEqual(after, before) {
+		t.Errorf("expected %#v, got %#v", before, after)
+	}
+
+	if group := i.Groups.GetGroup("staff"); !reflect.DeepEqual(group.Users, []string{"alice", "bob"}) {
+		t.Errorf("expected the members to be kept, got %q", group.Users)
+	}
+
+	gshd := i.Gshadow.GetEntry("staff")
+	if gshd.Password != "$6$salt$group" || !reflect.DeepEqual(gshd.Admins, []string{"alice"}) || !reflect.DeepEqual(gshd.Members, []string{"alice", "bob"}) {
+		t.Errorf("expected the gshadow entry to be kept, got %#v", gshd)
+	}
+
+	// Set fields replace only their own part.
+	r = &userdb.Records{
+		Users:  []*userdb.User{{UserName: "alice", RealName: "Alice Smith"}},
+		Groups: []*userdb.Group{{GroupName: "staff", Members: []string{"alice"}}},
+	}
+	if _, err := i.ImportUserdb(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if alice := i.Passwd.GetUser("alice"); alice.Info != "Alice Smith,Room 1" || alice.Shell != "/bin/bash" {
+		t.Errorf("unexpected user %#v", alice)
+	}
+
+	if gshd := i.Gshadow.GetEntry("staff"); !reflect.DeepEqual(gshd.Members, []string{"alice"}) || !reflect.DeepEqual(gshd.Admins, []string{"alice"}) {
+		t.Errorf("unexpected gshadow entry %#v", gshd)
+	}
+}
+
+func TestApplyCloudInit(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	c := &cloudinit.Config{}
+	err := cloudinit.Unmarshal([]byte(`#cloud-config
+groups:
+  - admins: [root, nobody-here]
+users:
+  - default
+  - name: alice
+    gecos: Alice
+    primary_group: staff
+    groups: [admins, developers]
+    shell: /bin/bash
+    passwd: $6$salt$hash
+    ssh_authorized_keys: ["ssh-ed25519 AAAA alice"]
+    sudo: ALL=(ALL) NOPASSWD:ALL
+    uid: 1500
+  - name: svc
+    system: true
+    lock_passwd: false
+`), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := i.ApplyCloudInit(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := i.Passwd.GetUser("alice")
+	if alice == nil || alice.UID != 1500 || alice.GID != i.Groups.GetGroup("staff").GID || alice.Info != "Alice" || alice.Shell != "/bin/bash" {
+		t.Fatalf("unexpected user %#v", alice)
+	}
+
+	if shd := i.Shadow.GetUserEntry("alice"); shd.Password != "!$6$salt$hash" {
+		t.Errorf("expected a locked hash, got %s", shd.Password)
+	}
+
+	admins := i.Groups.GetGroup("admins")
+	if admins == nil || !admins.HasUser("root") || !admins.HasUser("alice") || admins.HasUser("nobody-here") {
+		t.Errorf("unexpected group %#v", admins)
+	}
+
+	if developers := i.Groups.GetGroup("developers"); developers == nil || !developers.HasUser("alice") {
+		t.Error("expected a missing supplementary group to be created")
+	}
+
+	if svc := i.Passwd.GetUser("svc"); svc == nil || svc.UID >= i.Policy.UIDMin {
+		t.Errorf("expected a system user, got %#v", svc)
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ioutil.ReadFile(filepath.Join(i.Options.Root, "home", "alice", ".ssh", "authorized_keys"))
+	if err != nil || string(keys) != "ssh-ed25519 AAAA alice\n" {
+		t.Errorf("unexpected authorized keys %q %v", keys, err)
+	}
+
+	sudoers, err := ioutil.ReadFile(filepath.Join(i.Options.Root, cloudinit.FILE_SUDOERS))
+	if err != nil || string(sudoers) != "alice ALL=(ALL) NOPASSWD:ALL\n" {
+		t.Errorf("unexpected sudoers %q %v", sudoers, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(i.Options.Root, "home", "svc")); !os.IsNotExist(err) {
+		t.Error("expected no home for a system user")
+	}
+
+	// Applying again only adds what is missing.
+	again, err := i.ApplyCloudInit(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(again) >= len(changes) {
+		t.Errorf("expected fewer changes the second time, got %v", again)
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	sudoers, _ = ioutil.ReadFile(filepath.Join(i.Options.Root, cloudinit.FILE_SUDOERS))
+	if string(sudoers) != "alice ALL=(ALL) NOPASSWD:ALL\n" {
+		t.Errorf("expected the rule once, got %q", sudoers)
+	}
+
+	// A rule with a line break is refused before any user is created.
+	bad := &cloudinit.Config{Users: cloudinit.Users{
+		{Name: "carol"},
+		{Name: "dave", Sudo: cloudinit.List{"ALL=(ALL) ALL\nALL ALL=(ALL) NOPASSWD:ALL"}},
+	}}
+	if _, err := i.ApplyCloudInit(bad); err == nil {
+		t.Error("expected a sudo rule with a line break to be refused")
+	}
+
+	if i.Passwd.GetUser("carol") != nil {
+		t.Error("expected no user to be created")
+	}
+}
+
+func TestApplyIgnition(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	if err := os.MkdirAll(filepath.Join(i.Options.Root, "home", "games"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &ignition.Config{}
+	err := ignition.Unmarshal([]byte(`{
+  "ignition": {"version": "3.4.0"},
+  "passwd": {
+    "groups": [
+      {"name": "developers", "gid": 2000, "passwordHash": "$6$group$hash"},
+      {"name": "fax", "shouldExist": false}
+    ],
+    "users": [
+      {"name": "core", "uid": 1500, "gecos": "CoreOS Admin", "groups": ["developers", "sudo"], "passwordHash": "$6$salt$hash", "sshAuthorizedKeys": ["ssh-ed25519 AAAA core"]},
+      {"name": "games", "shell": "/bin/bash", "homeDir": "/home/games", "groups": ["developers"], "sshAuthorizedKeys": ["ssh-ed25519 BBBB games"]},
+      {"name": "news", "shouldExist": false}
+    ]
+  }
+}`), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := i.ApplyIgnition(c); err != nil {
+		t.Fatal(err)
+	}
+
+	developers := i.Groups.GetGroup("developers")
+	if developers == nil || developers.GID != 2000 || developers.Password != "$6$group$hash" {
+		t.Fatalf("unexpected group %#v", developers)
+	}
+
+	if i.Groups.GetGroup("fax") != nil || i.Passwd.GetUser("news") != nil {
+		t.Error("expected entries with shouldExist false to be removed")
+	}
+
+	core := i.Passwd.GetUser("core")
+	if core == nil || core.UID != 1500 || core.Info != "CoreOS Admin" || core.HomeDir != "/home/core" {
+		t.Fatalf("unexpected user %#v", core)
+	}
+
+	if i.Shadow.GetUserEntry("core").Password != "$6$salt$hash" {
+		t.Error("expected the password hash to be set")
+	}
+
+	if !developers.HasUser("core") || !i.Groups.GetGroup("sudo").HasUser("core") || !developers.HasUser("games") {
+		t.Error("expected the memberships to be set")
+	}
+
+	if games := i.Passwd.GetUser("games"); games.Shell != "/bin/bash" || games.HomeDir != "/home/games" {
+		t.Errorf("expected an existing user to be updated, got %#v", games)
+	}
+
+	if err := i.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, key := range map[string]string{"core": "ssh-ed25519 AAAA core\n", "games": "ssh-ed25519 BBBB games\n"} {
+		keys, err := ioutil.ReadFile(filepath.Join(i.Options.Root, "home", name, ".ssh", "authorized_keys"))
+		if err != nil || string(keys) != key {
+			t.Errorf("unexpected authorized keys of %s %q %v", name, keys, err)
+		}
+	}
+
+	// A user in a group which does not exist is refused.
+	c.Passwd.Users = []ignition.User{{Name: "bob", Groups: []string{"missing"}}}
+	if _, err := i.ApplyIgnition(c); err == nil {
+		t.Error("expected a missing group to fail")
+	}
+}
+
+func TestExport(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	for _, db := range []string{ExportPasswd, ExportShadow, ExportGroup, ExportUsers} {
+		table, err := i.Export(db, export.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(table.Rows) == 0 {
+			t.Errorf("expected rows for %s", db)
+		}
+	}
+
+	if _, err := i.Export("gshadow", export.Options{}); err == nil {
+		t.Error("expected an unknown database to fail")
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	m := importer.DefaultMapping()
+	records, err := m.ReadCSV([]byte(`name,uid,group,groups,password,expires
+root,,,,,
+alice,1000,,sudo,$6$salt$hash,2030-01-31
+bob,1000,users,missing,,
+alice,,,,,
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = i.ImportUsers(records)
+	errs, ok := err.(importer.Errors)
+	if !ok {
+		t.Fatalf("expected row errors, got %v", err)
+	}
+
+	expected := `row 2: name: user root already exists
+row 4: uid: uid 1000 is also on row 3
+row 4: groups: group missing does not exist
+row 5: name: user alice is also on row 3`
+	if errs.Error() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, errs)
+	}
+
+	if i.Passwd.GetUser("alice") != nil {
+		t.Error("expected nothing to be imported when a row is invalid")
+	}
+
+	// Without the invalid rows, the user without a UID must not take the
+	// UID of a later row.
+	records, err = m.ReadCSV([]byte(`name,uid,group,groups,password,expires
+bob,,users,,,
+alice,1000,,sudo,$6$salt$hash,2030-01-31
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := i.ImportUsers(records); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := i.Passwd.GetUser("alice")
+	if alice == nil || alice.UID != 1000 || !i.Groups.GetGroup("sudo").HasUser("alice") {
+		t.Fatalf("unexpected user %#v", alice)
+	}
+
+	if shd := i.Shadow.GetUserEntry("alice"); shd.Password != "$6$salt$hash" || shd.AccountExpiration.Time().Format("2006-01-02") != "2030-01-31" {
+		t.Errorf("unexpected shadow entry %#v", shd)
+	}
+
+	if bob := i.Passwd.GetUser("bob"); bob == nil || bob.UID == 1000 {
+		t.Errorf("unexpected user %#v", bob)
+	}
+}
+
+func TestImportUsersRollback(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	// Only one UID is left, so the last user fails after the checks.
+	i.Policy.UIDMin, i.Policy.UIDMax = 5000, 5000
+
+	m := importer.DefaultMapping()
+	records, err := m.ReadCSV([]byte(`name,uid,group,groups
+alice,1000,users,sudo
+bob,,users,
+carol,,users,
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, groups := len(*i.Passwd), len(*i.Groups)
+	if _, err := i.ImportUsers(records); err == nil {
+		t.Fatal("expected the import to fail once the UIDs ran out")
+	}
+
+	if len(*i.Passwd) != users || len(*i.Groups) != groups || i.Shadow.GetUserEntry("alice") != nil {
+		t.Error("expected the users already created to be dropped")
+	}
+
+	if i.Groups.GetGroup("sudo").HasUser("alice") {
+		t.Error("expected the group memberships to be dropped")
+	}
+
+	if len(i.pending) != 0 {
+		t.Errorf("expected no queued changes, got %d", len(i.pending))
+	}
+}
+
+func TestCheckImport(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	if err := ioutil.WriteFile(i.path(defaultFileShells), []byte("# valid shells\n/bin/sh\n/bin/bash\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Homes are made for the imported users.
+	i.Policy.CreateHome = true
+	if err := os.MkdirAll(i.path("/home/dave"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	m := importer.DefaultMapping()
+	records, parsed := m.ReadCSV([]byte(`name,uid,home,shell
+alice,abc,,/bin/zsh
+bob,,/root,/usr/sbin/nologin
+carol,,/srv/shared,/bin/bash
+erin,,/srv/shared,/bin/sh
+dave,,,
+`))
+	errs, ok := parsed.(importer.Errors)
+	if !ok {
+		t.Fatalf("expected row errors, got %v", parsed)
+	}
+
+	expected := `row 2: uid: invalid uid "abc"
+row 2: shell: shell /bin/zsh is not listed in /etc/shells
+row 3: home: home /root is used by root
+row 5: home: home /srv/shared is also on row 4
+row 6: home: home directory /home/dave already exists`
+
+	if got := i.CheckImport(records, errs); got.Error() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestGetent(t *testing.T) {
+	i, cleanup := newTestInstance(t)
+	defer cleanup()
+
+	var tests = []struct {
+		db      string
+		keys    []string
+		lines   []string
+		missing []string
+	}{
+		{"passwd", []string{"root", "33", "nope"}, []string{"root:x:0:0:root:/root:/bin/bash", "www-data:x:33:33:www-data:/var/www:/usr/sbin/nologin"}, []string{"nope"}},
+		{"group", []string{"sudo", "0"}, []string{"sudo:x:27:", "root:x:0:"}, nil},
+		{"shadow", []string{"games", "0"}, []string{"games:*:18198:0:99999:7:::"}, []string{"0"}},
+		{"gshadow", []string{"root"}, nil, []string{"root"}},
+	}
+
+	for testNum, test := range tests {
+		lines, missing, err := i.Getent(test.db, test.keys)
+		if err != nil {
+			t.Errorf("%d) unexpected error %s", testNum, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(lines, test.lines) || !reflect.DeepEqual(missing, test.missing) {
+			t.Errorf("%d) expected %q and %q missing, got %q and %q", testNum, test.lines, test.missing, lines, missing)
+		}
+	}
+
+	lines, _, err := i.Getent("passwd", nil)
+	if err != nil || len(lines) != len(*i.Passwd) {
+		t.Errorf("expected every entry, got %d %v", len(lines), err)
+	}
+
+	if _, _, err := i.Getent("hosts", nil); err == nil {
+		t.Error("expected an unknown database to fail")
+	}
+}